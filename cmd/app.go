@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+
+	"L0/internal/archive"
+	"L0/internal/audit"
+	"L0/internal/cache"
+	"L0/internal/config"
+	"L0/internal/db"
+	"L0/internal/kafka"
+	"L0/internal/lifecycle"
+	"L0/internal/metrics"
+	"L0/internal/order"
+	"L0/internal/tracing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// app holds the components shared by all subcommands.
+type app struct {
+	cfg     config.Config
+	pool    *pgxpool.Pool
+	cluster *db.Cluster
+	cache   *cache.CacheOrder
+	repo    *order.OrderRepository
+	writer  *kafkago.Writer
+	codecs  *kafka.Codecs
+	service *order.OrderService
+	// archiver is nil when ARCHIVE_STORAGE is not set.
+	archiver *archive.Archiver
+	// lc closes the components in order; serve adds the intake and drain
+	// steps of the roles it starts.
+	lc *lifecycle.Manager
+}
+
+// newApp connects to Postgres, makes sure the schema is current and wires the
+// order service.
+func newApp(ctx context.Context, cfg config.Config) (*app, error) {
+	policy, err := order.ParseConflictPolicy(cfg.ConflictPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	// The writer does not connect until the first write; building it first
+	// only checks the TLS and SASL settings.
+	wr, err := kafka.NewWriter(cfg.Kafka)
+	if err != nil {
+		return nil, err
+	}
+	codecs, err := kafka.NewCodecs(cfg.Kafka, cfg.StrictPayloads)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := slog.Default()
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		return nil, err
+	}
+
+	// Migrations, pool metrics and the audit log use the primary directly.
+	cluster, p, err := db.Open(ctx, cfg.DB, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ensureSchema(ctx, p, cfg.DB.MigrateOnStart); err != nil {
+		cluster.Close()
+		return nil, err
+	}
+
+	if err := metrics.RegisterPool(p); err != nil {
+		cluster.Close()
+		return nil, err
+	}
+
+	lc := lifecycle.NewManager(logger)
+	lc.Add(lifecycle.PhaseClose, "postgres", func(context.Context) error {
+		cluster.Close()
+		return nil
+	})
+	// Spans of the last queries are exported once the pool is closed.
+	lc.Add(lifecycle.PhaseClose, "tracing", shutdownTracing)
+
+	lc.Add(lifecycle.PhaseFlush, "kafka writer", func(context.Context) error { return wr.Close() })
+	c := cache.NewCache(cfg.CacheSize)
+	orderRepo := order.NewOrderRepository(cluster, logger)
+	auditStore := audit.NewStore(p)
+	s := order.NewOrderService(orderRepo, c, wr, auditStore, logger)
+	s.SetConflictPolicy(policy)
+	s.SetEncoder(codecs)
+
+	a := &app{cfg: cfg, pool: p, cluster: cluster, cache: c, repo: orderRepo, writer: wr, codecs: codecs, service: s, lc: lc}
+	if cfg.Archive.Storage != "" {
+		storage, err := archive.NewStorage(cfg.Archive)
+		if err != nil {
+			a.close()
+			return nil, err
+		}
+		if a.archiver, err = archive.New(p, orderRepo, storage, cfg.Archive, logger); err != nil {
+			a.close()
+			return nil, err
+		}
+		s.SetArchive(a.archiver)
+	}
+	return a, nil
+}
+
+// warmCache restores the cache snapshot when one is configured and fresh, and
+// otherwise runs the warm-up query.
+func (a *app) warmCache(ctx context.Context) (int, error) {
+	if path := a.cfg.CacheSnapshotPath; path != "" {
+		n, err := a.cache.LoadSnapshot(ctx, path, a.cfg.CacheSnapshotMaxAge, a.repo.LiveIDs)
+		if err == nil {
+			slog.InfoContext(ctx, "cache restored from snapshot", "path", path, "orders", n)
+			return n, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.WarnContext(ctx, "cache snapshot not used", "path", path, "error", err)
+		}
+	}
+	return a.warmCacheFromDB(ctx)
+}
+
+// warmCacheFromDB loads the most recent orders into the cache.
+func (a *app) warmCacheFromDB(ctx context.Context) (int, error) {
+	lastOrders, err := a.repo.GetLimit(ctx, a.cfg.CacheSize)
+	if err != nil {
+		return 0, err
+	}
+	a.cache.Load(lastOrders)
+	return len(lastOrders), nil
+}
+
+// saveCacheSnapshot writes the cache to CACHE_SNAPSHOT_PATH, if set.
+func (a *app) saveCacheSnapshot(ctx context.Context) error {
+	if a.cfg.CacheSnapshotPath == "" {
+		return nil
+	}
+	n, err := a.cache.SaveSnapshot(a.cfg.CacheSnapshotPath)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "cache snapshot saved", "path", a.cfg.CacheSnapshotPath, "orders", n)
+	return nil
+}
+
+// close runs the shutdown steps within SHUTDOWN_TIMEOUT.
+func (a *app) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), a.cfg.ShutdownTimeout)
+	defer cancel()
+	if err := a.lc.Shutdown(ctx); err != nil {
+		slog.Error("shutdown incomplete", "error", err)
+	}
+}
@@ -2,104 +2,136 @@ package main
 
 import (
 	"context"
-	"log"
-	"net/http"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	_ "L0/docs"
-	"L0/internal/api"
-	"L0/internal/cache"
 	"L0/internal/config"
-	"L0/internal/db"
-	"L0/internal/kafka"
-	"L0/internal/order"
+	"L0/internal/logger"
+)
+
+// command is a subcommand of the service binary. Every command gets the
+// loaded configuration and a context cancelled on SIGINT/SIGTERM.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, cfg config.Config, args []string) error
+}
 
-	kafkago "github.com/segmentio/kafka-go"
+var commands = []command{
+	{"serve", "run HTTP API and Kafka consumer (default)", runServe},
+	{"api-only", "run HTTP API only", runAPIOnly},
+	{"consume-only", "run Kafka consumer only", runConsumeOnly},
+	{"migrate", "manage database schema: status | up | down [N] | goto VERSION | force VERSION", runMigrate},
+	{"replay", "re-ingest orders from the Kafka topic", runReplay},
+	{"export", "write orders as NDJSON, CSV or JSON", runExport},
+	{"import", "save orders from an NDJSON or CSV file", runImport},
+	{"cache-warm", "run the cache warm-up query, report what would be cached and write the cache snapshot", runCacheWarm},
+	{"check-config", "print the effective configuration", runCheckConfig},
+	{"partitions", "create upcoming partitions and detach expired ones now", runPartitions},
+	{"archive", "move orders older than the cutoff to archive files now", runArchive},
+}
 
-	"github.com/jackc/pgx/v5/pgxpool"
+var (
+	// loader keeps the config flags so that serve can reload on SIGHUP.
+	loader = config.NewLoader()
+	// logLevel is the level of the default logger; reload changes it.
+	logLevel slog.LevelVar
 )
 
+// @title                       Orders service API
+// @version                     1.0
+// @securityDefinitions.apikey  ApiKeyAuth
+// @in                          header
+// @name                        X-API-Key
+// @securityDefinitions.apikey  BearerAuth
+// @in                          header
+// @name                        Authorization
+// @description                 JWT as "Bearer <token>"
 func main() {
-	cfg, err := config.Load()
+	loader.FlagSet().Usage = usage
+	rest, err := loader.Parse(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		log.Fatalf("config load failed: %v", err)
+		os.Exit(2)
+	}
+	name, args := "serve", rest
+	if len(rest) > 0 {
+		name, args = rest[0], rest[1:]
+	}
+	switch name {
+	case "help":
+		usage()
+		return
+	case "config-docs":
+		if err := config.WriteDocs(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	cmd, ok := findCommand(name)
+	if !ok {
+		usage()
+		os.Exit(2)
 	}
-	log.Printf("config loaded: http_port=%s db=%s:%s/%s", cfg.HTTPPort, cfg.DB.Host, cfg.DB.Port, cfg.DB.DbName)
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 
-	pool, orderServ, kafkaConsumer, router, err := setup(ctx, cfg)
+	cfg, err := loader.Load()
 	if err != nil {
-		log.Fatalf("setup failed: %v", err)
+		fmt.Fprintf(os.Stderr, "config load failed:\n%v\n", err)
+		os.Exit(1)
 	}
-
-	server := http.Server{Addr: ":" + cfg.HTTPPort, Handler: router}
-
-	defer func() {
-		pool.Close()
-		log.Println("db pool closed")
-	}()
-
-	startHTTPServer(&server)
-	startKafkaConsumer(ctx, kafkaConsumer, orderServ)
-
-	log.Println("service started")
-
-	<-sigCh
-	log.Println("shutdown signal received, shutting down...")
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer shutdownCancel()
-
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("server shutdown error: %v", err)
+	lvl, err := logger.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logger: %v\n", err)
+		os.Exit(1)
 	}
-	cancel()
-	log.Println("service stopped")
-}
-
-func setup(ctx context.Context, cfg config.Config) (pool *pgxpool.Pool, orderServ *order.OrderService, kafkaConsumer *kafkago.Reader, router http.Handler, err error) {
-	p, err := db.NewClient(ctx, cfg.DB)
+	logLevel.Set(lvl)
+	l, err := logger.NewWithLevel(os.Stderr, &logLevel, cfg.LogFormat)
 	if err != nil {
-		return nil, nil, nil, nil, err
+		fmt.Fprintf(os.Stderr, "logger: %v\n", err)
+		os.Exit(1)
 	}
+	slog.SetDefault(l)
 
-	cons := kafka.NewConsumer(cfg.Kafka)
-	wr := kafka.NewWriter(cfg.Kafka)
-
-	c := cache.NewCache(cfg.CacheSize)
-	logger := log.Default()
-	orderRepo := order.NewOrderRepository(p, logger)
-	s := order.NewOrderService(orderRepo, c, wr, logger)
-
-	handler := api.NewHandler(s)
-	r := handler.RegisterOrderRouter()
-
-	lastOrders, err := s.GetOrdersLimit(ctx, cfg.CacheSize)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err = cmd.run(ctx, cfg, args)
+	stop()
 	if err != nil {
-		p.Close()
-		return nil, nil, nil, nil, err
+		slog.Error("command failed", "command", cmd.name, "error", err)
+		os.Exit(1)
 	}
-	c.Load(lastOrders)
-
-	return p, s, cons, r, nil
 }
 
-func startHTTPServer(server *http.Server) {
-	go func() {
-		log.Printf("http server listening on %s", server.Addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("http server error: %v", err)
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
 		}
-	}()
+	}
+	return command{}, false
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [config flags] <command> [flags]\n\ncommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "  %-14s %s\n", "config-docs", "print the configuration reference as Markdown")
+	fmt.Fprintf(os.Stderr, "\nconfig flags:\n")
+	loader.FlagSet().PrintDefaults()
 }
 
-func startKafkaConsumer(ctx context.Context, reader *kafkago.Reader, svc *order.OrderService) {
-	go kafka.RunConsumer(ctx, reader, svc)
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
 }
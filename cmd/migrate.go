@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"L0/internal/config"
+	"L0/internal/db"
+	"L0/internal/migrations"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const migrateUsage = "usage: migrate status | up | down [N] | goto VERSION | force VERSION"
+
+// runMigrate handles `main migrate <subcommand>`.
+func runMigrate(ctx context.Context, cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	pool, err := db.NewClient(ctx, cfg.DB, slog.Default())
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	m, err := migrations.NewMigrator(pool)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "status":
+		st, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(st)
+	case "up":
+		err = m.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil {
+				return fmt.Errorf("invalid steps %q", args[1])
+			}
+		}
+		err = m.Down(ctx, steps)
+	case "goto", "force":
+		if len(args) < 2 {
+			return errors.New(migrateUsage)
+		}
+		v, convErr := strconv.ParseUint(args[1], 10, 32)
+		if convErr != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if args[0] == "goto" {
+			err = m.Goto(ctx, uint(v))
+		} else {
+			err = m.Force(ctx, uint(v))
+		}
+	default:
+		return fmt.Errorf("unknown command %q, %s", args[0], migrateUsage)
+	}
+	if err != nil {
+		return err
+	}
+
+	st, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	slog.Info("schema status", "version", st.Version, "latest", st.Latest)
+	return nil
+}
+
+// ensureSchema applies pending migrations when enabled and refuses to start
+// if the schema is still behind the binary.
+func ensureSchema(ctx context.Context, pool *pgxpool.Pool, migrate bool) error {
+	m, err := migrations.NewMigrator(pool)
+	if err != nil {
+		return err
+	}
+	if migrate {
+		if err := m.Up(ctx); err != nil {
+			return fmt.Errorf("apply migrations: %w", err)
+		}
+	}
+	return m.Check(ctx)
+}
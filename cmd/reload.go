@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"L0/internal/cache"
+	"L0/internal/config"
+	"L0/internal/logger"
+	"L0/internal/ratelimit"
+)
+
+// reloader applies the settings tagged reload in config.Config while the
+// service runs: log level, rate limits and cache size.
+type reloader struct {
+	cfg             config.Config
+	cache           *cache.CacheOrder
+	ip, read, write *ratelimit.Limiter
+}
+
+// watch reloads the configuration on every SIGHUP until ctx is done.
+func (r *reloader) watch(ctx context.Context) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	defer signal.Stop(sig)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+			r.reload(ctx)
+		}
+	}
+}
+
+// reload keeps the current settings when the new configuration is invalid.
+func (r *reloader) reload(ctx context.Context) {
+	cfg, err := loader.Load()
+	if err != nil {
+		slog.ErrorContext(ctx, "config reload failed, keeping current settings", "error", err)
+		return
+	}
+	changed, restart := config.Diff(r.cfg, cfg)
+	r.apply(cfg)
+	if len(restart) > 0 {
+		slog.WarnContext(ctx, "changed settings need a restart", "settings", restart)
+	}
+	slog.InfoContext(ctx, "config reloaded", "applied", changed)
+}
+
+func (r *reloader) apply(cfg config.Config) {
+	if lvl, err := logger.ParseLevel(cfg.LogLevel); err == nil {
+		logLevel.Set(lvl)
+	}
+	if r.ip != nil {
+		r.ip.SetLimit(cfg.RateLimit.IPRPS, cfg.RateLimit.IPBurst)
+	}
+	if r.read != nil {
+		r.read.SetLimit(cfg.RateLimit.ReadRPS, cfg.RateLimit.ReadBurst)
+	}
+	if r.write != nil {
+		r.write.SetLimit(cfg.RateLimit.WriteRPS, cfg.RateLimit.WriteBurst)
+	}
+	r.cache.SetSize(cfg.CacheSize)
+	// Only reloadable settings take effect; the others stay as started.
+	r.cfg.LogLevel = cfg.LogLevel
+	r.cfg.RateLimit.IPRPS, r.cfg.RateLimit.IPBurst = cfg.RateLimit.IPRPS, cfg.RateLimit.IPBurst
+	r.cfg.RateLimit.ReadRPS, r.cfg.RateLimit.ReadBurst = cfg.RateLimit.ReadRPS, cfg.RateLimit.ReadBurst
+	r.cfg.RateLimit.WriteRPS, r.cfg.RateLimit.WriteBurst = cfg.RateLimit.WriteRPS, cfg.RateLimit.WriteBurst
+	r.cfg.CacheSize = cfg.CacheSize
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"L0/internal/config"
+	"L0/internal/kafka"
+	"L0/internal/order"
+	"L0/internal/transfer"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func runReplay(ctx context.Context, cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	partition := fs.Int("partition", -1, "partition to replay, -1 for every partition")
+	offset := fs.Int64("offset", kafkago.FirstOffset, "offset to start from, -2 for the earliest retained message")
+	from := fs.String("from", "", "replay messages produced at or after this time (YYYY-MM-DD or RFC3339; overrides -offset)")
+	to := fs.String("to", "", "stop at messages produced after this time (YYYY-MM-DD or RFC3339)")
+	group := fs.String("group", cfg.Kafka.GroupID+"-replay", "consumer group the replay commits its progress to and resumes from, empty to disable")
+	checkpoint := fs.String("checkpoint", "", "file also keeping the next offset of each partition, for when the group is disabled or a commit fails")
+	dryRun := fs.Bool("dry-run", false, "validate and save in rolled back transactions")
+	policy := fs.String("policy", cfg.ConflictPolicy, "conflict policy: skip or overwrite")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := kafka.ReplayOptions{Offset: *offset, GroupID: *group, Checkpoint: *checkpoint, DryRun: *dryRun}
+	if *partition >= 0 {
+		opts.Partitions = []int{*partition}
+	}
+	var err error
+	if opts.From, err = parseTime("from", *from); err != nil {
+		return err
+	}
+	if opts.To, err = parseTime("to", *to); err != nil {
+		return err
+	}
+	if opts.Policy, err = order.ParseConflictPolicy(*policy); err != nil {
+		return err
+	}
+
+	a, err := newApp(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	replayer := kafka.NewReplayer(cfg.Kafka, a.service, opts, slog.Default())
+	replayer.SetCodecs(a.codecs)
+	report, err := replayer.Run(ctx)
+	if printErr := printJSON(report); printErr != nil && err == nil {
+		err = printErr
+	}
+	return err
+}
+
+// parseTime reads a date flag; see transfer.ParseTime.
+func parseTime(flagName, value string) (time.Time, error) {
+	t, err := transfer.ParseTime(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("-%s: %w", flagName, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"L0/internal/api"
+	"L0/internal/auth"
+	"L0/internal/config"
+	"L0/internal/health"
+	"L0/internal/kafka"
+	"L0/internal/lifecycle"
+	"L0/internal/migrations"
+	"L0/internal/order"
+	"L0/internal/partition"
+	"L0/internal/ratelimit"
+)
+
+func runServe(ctx context.Context, cfg config.Config, args []string) error {
+	return serve(ctx, cfg, true, true)
+}
+
+func runAPIOnly(ctx context.Context, cfg config.Config, args []string) error {
+	return serve(ctx, cfg, true, false)
+}
+
+func runConsumeOnly(ctx context.Context, cfg config.Config, args []string) error {
+	return serve(ctx, cfg, false, true)
+}
+
+// serve runs the HTTP and/or Kafka roles until ctx is cancelled, so the two
+// can be scaled independently.
+func serve(ctx context.Context, cfg config.Config, withHTTP, withConsumer bool) error {
+	slog.Info("config loaded", "profile", cfg.Profile, "config", cfg.String())
+
+	a, err := newApp(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	live := health.NewChecker(cfg.HealthTimeout)
+	ready := health.NewChecker(cfg.HealthTimeout)
+	migrator, err := migrations.NewMigrator(a.pool)
+	if err != nil {
+		return err
+	}
+	ready.Add("postgres", a.pool.Ping)
+	// Reads fall back to the primary, so a lagging or lost replica is
+	// reported without taking the service out of rotation.
+	for _, name := range a.cluster.Replicas() {
+		ready.AddOptional("postgres replica "+name, a.cluster.ReplicaCheck(name))
+	}
+	go a.cluster.Monitor(ctx, cfg.DB.ReplicaCheckInterval)
+	// Every instance runs maintenance; an advisory lock lets one at a time
+	// do the work.
+	if cfg.Partition.Interval > 0 {
+		go partition.NewMaintainer(a.pool, cfg.Partition, slog.Default()).Run(ctx, cfg.Partition.Interval)
+	}
+	if a.archiver != nil && cfg.Archive.Interval > 0 {
+		go a.archiver.Run(ctx, cfg.Archive.Interval)
+	}
+	ready.Add("migrations", migrator.Check)
+	brokerCheck, err := kafka.BrokerCheck(cfg.Kafka)
+	if err != nil {
+		return err
+	}
+	ready.Add("kafka", brokerCheck)
+
+	switch {
+	case withHTTP && !withConsumer:
+		// The consume-only instances write the orders and this cache would
+		// never hear of it, so reads go to the database.
+		a.service.SetCacheReads(false)
+	case withHTTP:
+		if _, err := a.warmCache(ctx); err != nil {
+			return err
+		}
+		a.lc.Add(lifecycle.PhasePersist, "cache snapshot", a.saveCacheSnapshot)
+		ready.Add("cache", a.cache.CheckWarm)
+	}
+	if withConsumer {
+		var dlq order.Writer
+		w, err := kafka.NewDeadLetterWriter(cfg.Kafka)
+		if err != nil {
+			return err
+		}
+		if w != nil {
+			a.lc.Add(lifecycle.PhaseFlush, "dead-letter writer", func(context.Context) error { return w.Close() })
+			dlq = w
+		}
+		newReader := func() (kafka.MessageReader, error) { return kafka.NewReader(cfg.Kafka) }
+		supervisor := kafka.NewSupervisor(newReader, a.service, dlq, slog.Default(), cfg.Kafka.RestartBackoffMin, cfg.Kafka.RestartBackoffMax)
+		supervisor.SetCodecs(a.codecs)
+		live.Add("consumer", supervisor.LiveCheck(3*kafka.HeartbeatInterval))
+		ready.Add("consumer", supervisor.Check(3*kafka.HeartbeatInterval))
+
+		// The consumer outlives ctx: fetching stops in the intake phase and
+		// the message in flight is finished in the drain phase.
+		consumerCtx, stopConsumer := context.WithCancel(context.WithoutCancel(ctx))
+		go supervisor.Run(consumerCtx)
+		a.lc.Add(lifecycle.PhaseIntake, "kafka consumer", func(context.Context) error {
+			stopConsumer()
+			return nil
+		})
+		a.lc.Add(lifecycle.PhaseDrain, "kafka consumer", supervisor.Wait)
+	}
+
+	reload := &reloader{cfg: cfg, cache: a.cache}
+	if withHTTP {
+		reload.ip = ratelimit.New(cfg.RateLimit.IPRPS, cfg.RateLimit.IPBurst)
+		reload.read = ratelimit.New(cfg.RateLimit.ReadRPS, cfg.RateLimit.ReadBurst)
+		reload.write = ratelimit.New(cfg.RateLimit.WriteRPS, cfg.RateLimit.WriteBurst)
+		authenticator, err := auth.New(cfg.Auth)
+		if err != nil {
+			return err
+		}
+		opts := []api.HandlerOption{
+			api.WithLogger(slog.Default()),
+			api.WithHealth(live, ready),
+			api.WithIPRateLimit(reload.ip),
+			api.WithRateLimits(reload.read, reload.write),
+			api.WithTrustedProxies(cfg.RateLimit.TrustedProxies),
+			api.WithStrictPayloads(cfg.StrictPayloads),
+		}
+		if authenticator != nil {
+			opts = append(opts, api.WithAuth(authenticator))
+		} else {
+			slog.Warn("authentication is disabled, the orders API is open")
+		}
+		handler := api.NewHandler(a.service, opts...)
+		server := &http.Server{
+			Addr:      ":" + cfg.HTTPPort,
+			Handler:   handler.RegisterOrderRouter(),
+			TLSConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+		}
+		startHTTPServer(server, cfg.HTTPTLSCertFile, cfg.HTTPTLSKeyFile)
+		// Shutdown stops accepting connections and waits for active requests.
+		a.lc.Add(lifecycle.PhaseIntake, "http server", server.Shutdown)
+	} else {
+		// Without the API the probes still need a port to be reached on.
+		handler := api.NewHandler(a.service, api.WithLogger(slog.Default()), api.WithHealth(live, ready))
+		server := &http.Server{
+			Addr:      ":" + cfg.HTTPPort,
+			Handler:   handler.RegisterProbeRouter(),
+			TLSConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+		}
+		startHTTPServer(server, cfg.HTTPTLSCertFile, cfg.HTTPTLSKeyFile)
+		// Probes keep answering until the consumer has drained.
+		a.lc.Add(lifecycle.PhaseFlush, "probe server", server.Shutdown)
+	}
+
+	go reload.watch(ctx)
+	slog.Info("service started", "http", withHTTP, "consumer", withConsumer)
+
+	<-ctx.Done()
+	slog.Info("shutdown signal received, shutting down", "timeout", cfg.ShutdownTimeout)
+	a.close()
+	slog.Info("service stopped")
+	return nil
+}
+
+func startHTTPServer(server *http.Server, certFile, keyFile string) {
+	go func() {
+		tlsOn := certFile != "" || keyFile != ""
+		slog.Info("http server listening", "addr", server.Addr, "tls", tlsOn)
+		var err error
+		if tlsOn {
+			err = server.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			slog.Error("http server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"time"
+
+	"L0/internal/config"
+	"L0/internal/partition"
+)
+
+func runCacheWarm(ctx context.Context, cfg config.Config, args []string) error {
+	a, err := newApp(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	start := time.Now()
+	n, err := a.warmCacheFromDB(ctx)
+	if err != nil {
+		return err
+	}
+	slog.Info("cache warm-up done", "orders", n, "cache_size", cfg.CacheSize, "duration", time.Since(start))
+	return a.saveCacheSnapshot(ctx)
+}
+
+func runCheckConfig(ctx context.Context, cfg config.Config, args []string) error {
+	return printJSON(cfg.Redacted())
+}
+
+func runPartitions(ctx context.Context, cfg config.Config, args []string) error {
+	a, err := newApp(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	report, err := partition.NewMaintainer(a.pool, cfg.Partition, slog.Default()).RunOnce(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	return printJSON(report)
+}
+
+func runArchive(ctx context.Context, cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("archive", flag.ContinueOnError)
+	before := fs.String("before", "", "archive orders created before this date (YYYY-MM-DD or RFC3339); default keeps ARCHIVE_AFTER_MONTHS months")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	a, err := newApp(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+	if a.archiver == nil {
+		return errors.New("archival is disabled, set ARCHIVE_STORAGE")
+	}
+
+	cutoff := a.archiver.Cutoff(time.Now())
+	if *before != "" {
+		if cutoff, err = parseTime("before", *before); err != nil {
+			return err
+		}
+	}
+	report, err := a.archiver.RunOnce(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	return printJSON(report)
+}
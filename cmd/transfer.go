@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"L0/internal/audit"
+	"L0/internal/config"
+	"L0/internal/order"
+	"L0/internal/transfer"
+)
+
+func runExport(ctx context.Context, cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	limit := fs.Int("limit", 1000, "number of most recent orders to export, 0 for all")
+	from := fs.String("from", "", "earliest date_created (YYYY-MM-DD or RFC3339)")
+	to := fs.String("to", "", "date_created before (YYYY-MM-DD or RFC3339)")
+	formatName := fs.String("format", "ndjson", "ndjson, csv or json")
+	out := fs.String("out", "-", "output file, - for stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	format, err := transfer.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	filter := order.ListFilter{Limit: *limit}
+	for _, f := range []struct {
+		name  string
+		value string
+		dst   *time.Time
+	}{{"from", *from, &filter.From}, {"to", *to, &filter.To}} {
+		if *f.dst, err = parseTime(f.name, f.value); err != nil {
+			return err
+		}
+	}
+
+	a, err := newApp(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	enc := transfer.NewEncoder(bw, format)
+	var n int
+	err = a.repo.Stream(ctx, filter, func(o order.Order) error {
+		n++
+		return enc.Encode(o)
+	})
+	if err == nil {
+		err = enc.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	slog.Info("export done", "orders", n, "format", string(format))
+	return nil
+}
+
+func runImport(ctx context.Context, cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	file := fs.String("file", "-", "file to import, - for stdin")
+	formatName := fs.String("format", "ndjson", "ndjson or csv")
+	dryRun := fs.Bool("dry-run", false, "validate and save every batch, then roll it back")
+	fromLine := fs.Int("from-line", 0, "skip the orders starting before this line, to resume an import")
+	batchSize := fs.Int("batch-size", transfer.DefaultBatchSize, "orders saved per transaction")
+	policy := fs.String("policy", "", "skip or overwrite existing orders; ORDER_CONFLICT_POLICY by default")
+	strict := fs.Bool("strict", cfg.StrictPayloads, "reject NDJSON orders with fields unknown to their payload version")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	format, err := transfer.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	opts := transfer.ImportOptions{DryRun: *dryRun, FromLine: *fromLine, BatchSize: *batchSize}
+	if *policy != "" {
+		if opts.Policy, err = order.ParseConflictPolicy(*policy); err != nil {
+			return err
+		}
+	}
+
+	var r io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	dec, err := transfer.NewDecoder(bufio.NewReader(r), format, *strict)
+	if err != nil {
+		return err
+	}
+
+	a, err := newApp(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer a.close()
+
+	opts.OnError = func(le transfer.LineError) {
+		slog.Warn("import line failed", "line", le.Line, "order_uid", le.OrderUID, "error", le.Error)
+	}
+	src := audit.Source{Kind: audit.SourceSystem, Actor: "import", Ref: *file}
+	report, err := transfer.Import(audit.WithSource(ctx, src), dec, a.service, opts)
+	attrs := []any{"orders", report.Orders, "inserted", report.Inserted, "updated", report.Updated,
+		"skipped", report.Skipped, "failed", report.Failed, "dry_run", report.DryRun}
+	if err != nil {
+		if report.NextLine > 0 {
+			attrs = append(attrs, "resume_with", fmt.Sprintf("-from-line %d", report.NextLine))
+		}
+		slog.Error("import stopped", append(attrs, "error", err)...)
+		return err
+	}
+	slog.Info("import done", attrs...)
+	return nil
+}
@@ -1,9 +1,23 @@
 package api
 
 import (
+	"L0/internal/audit"
+	"L0/internal/auth"
+	"L0/internal/db"
+	"L0/internal/health"
+	"L0/internal/logger"
+	"L0/internal/metrics"
 	"L0/internal/order"
+	"L0/internal/ratelimit"
+	"L0/internal/tracing"
+	"L0/internal/transfer"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -12,30 +26,98 @@ import (
 
 type OrderHandler struct {
 	service order.Service
+	logger  *slog.Logger
+	live    *health.Checker
+	ready   *health.Checker
+	auth    auth.Authenticator
+
+	ipLimit        *ratelimit.Limiter
+	readLimit      *ratelimit.Limiter
+	writeLimit     *ratelimit.Limiter
+	trustedProxies []string
+	strictPayloads bool
+}
+
+// HandlerOption configures optional dependencies of the handler.
+type HandlerOption func(*OrderHandler)
+
+// WithLogger sets the logger used for request logs; slog.Default() otherwise.
+func WithLogger(logger *slog.Logger) HandlerOption {
+	return func(o *OrderHandler) { o.logger = logger }
+}
+
+// WithHealth sets the checks behind /livez and /readyz. Without them both
+// probes report up with no components.
+func WithHealth(live, ready *health.Checker) HandlerOption {
+	return func(o *OrderHandler) {
+		o.live = live
+		o.ready = ready
+	}
 }
 
-func NewHandler(orderService order.Service) *OrderHandler {
-	return &OrderHandler{service: orderService}
+// WithStrictPayloads makes imports reject NDJSON orders with fields unknown
+// to their payload version unless the request says otherwise.
+func WithStrictPayloads(strict bool) HandlerOption {
+	return func(o *OrderHandler) { o.strictPayloads = strict }
+}
+
+func NewHandler(orderService order.Service, opts ...HandlerOption) *OrderHandler {
+	o := &OrderHandler{
+		service: orderService,
+		logger:  slog.Default(),
+		live:    health.NewChecker(0),
+		ready:   health.NewChecker(0),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
 }
 
 func (o *OrderHandler) RegisterOrderRouter() http.Handler {
-	router := gin.Default()
+	router := gin.New()
+	if err := router.SetTrustedProxies(o.trustedProxies); err != nil {
+		o.logger.Error("invalid trusted proxies, trusting none", "error", err)
+		_ = router.SetTrustedProxies(nil)
+	}
+	router.Use(gin.Recovery(), requestID(), tracing.GinMiddleware(), o.requestLog(), metrics.GinMiddleware(), auditSource(), dbSession())
 
 	router.GET("/healthcheck", o.Health)
+	router.GET("/livez", o.Livez)
+	router.GET("/readyz", o.Readyz)
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
 	router.Static("/static", "./internal/web")
 	router.StaticFile("/", "./internal/web/index.html")
 	router.GET("/docs/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	orderGroup := router.Group("/orders")
+	orderGroup := router.Group("/orders", o.ipRateLimit(), o.authenticate(), o.rateLimit())
 	{
-		orderGroup.GET("/:id", o.GetOrder)
-		orderGroup.GET("/", o.GetOrders)
-		orderGroup.POST("/", o.CreateOrder)
+		orderGroup.GET("/:id", o.require(auth.RoleViewer), o.GetOrder)
+		orderGroup.GET("/", o.require(auth.RoleViewer), o.GetOrders)
+		orderGroup.GET("/export", o.require(auth.RoleViewer), o.ExportOrders)
+		orderGroup.POST("/import", o.require(auth.RoleOperator), o.ImportOrders)
+		orderGroup.POST("/", o.require(auth.RoleOperator), o.CreateOrder)
+		orderGroup.DELETE("/:id", o.require(auth.RoleAdmin), o.DeleteOrder)
+		orderGroup.POST("/:id/erase", o.require(auth.RoleAdmin), o.EraseOrder)
+		orderGroup.PATCH("/:id/status", o.require(auth.RoleOperator), o.UpdateOrderStatus)
+		orderGroup.GET("/:id/audit", o.require(auth.RoleOperator), o.GetOrderAudit)
 	}
 
 	return router
 }
 
+// RegisterProbeRouter serves only the health probes and metrics, for
+// instances that run the consumer without the orders API.
+func (o *OrderHandler) RegisterProbeRouter() http.Handler {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.GET("/healthcheck", o.Health)
+	router.GET("/livez", o.Livez)
+	router.GET("/readyz", o.Readyz)
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	return router
+}
+
 // Health godoc
 // @Summary      Health check
 // @Description  Returns service health status
@@ -47,64 +129,309 @@ func (o *OrderHandler) Health(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
+// Livez godoc
+// @Summary      Liveness probe
+// @Description  Reports whether the process should be restarted: the Kafka consumer loop must keep beating
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  health.Report
+// @Failure      503  {object}  health.Report
+// @Router       /livez [get]
+func (o *OrderHandler) Livez(c *gin.Context) {
+	writeReport(c, o.live.Run(c.Request.Context()))
+}
+
+// Readyz godoc
+// @Summary      Readiness probe
+// @Description  Checks Postgres, Kafka brokers, the consumer loop, cache warm-up and schema version
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  health.Report
+// @Failure      503  {object}  health.Report
+// @Router       /readyz [get]
+func (o *OrderHandler) Readyz(c *gin.Context) {
+	writeReport(c, o.ready.Run(c.Request.Context()))
+}
+
+func writeReport(c *gin.Context, report health.Report) {
+	code := http.StatusOK
+	if report.Status != health.StatusUp {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, report)
+}
+
 // GetOrder godoc
 // @Summary      Get order by id
-// @Description  Get order details by order UID
+// @Description  Get order details by order UID. Requires role viewer; personal data is masked without the pii:read scope
 // @Tags         orders
 // @Produce      json
 // @Param        id   path      string  true  "Order UID"
 // @Success      200  {object}  order.Order
 // @Failure      404  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      429  {object}  map[string]string
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
 // @Router       /orders/{id} [get]
 func (o *OrderHandler) GetOrder(c *gin.Context) {
 	id := c.Param("id")
 	order, err := o.service.GetOrderById(c.Request.Context(), id)
 	if err != nil {
-		if err.Error() == "no rows in result set" || err.Error() == "order not found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		o.writeError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, order)
+	c.JSON(http.StatusOK, o.maskOrder(c, order))
 }
 
 // GetOrders godoc
 // @Summary      Get list of orders
-// @Description  Returns list of orders. Query param `limit` optional (default 10)
+// @Description  Returns the newest orders. Query param `limit` optional (default 10). `from` and `to` (RFC 3339 or YYYY-MM-DD) bound date_created, `to` exclusive. Requires role viewer; personal data is masked without the pii:read scope
 // @Tags         orders
 // @Produce      json
-// @Param        limit  query    int  false  "Limit of ids to return"
+// @Param        limit  query    int     false  "Limit of ids to return"
+// @Param        from   query    string  false  "Earliest date_created"
+// @Param        to     query    string  false  "date_created before"
 // @Success      200  {array}   string
+// @Failure      400  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      429  {object}  map[string]string
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
 // @Router       /orders/ [get]
 func (o *OrderHandler) GetOrders(c *gin.Context) {
-	q := c.Query("limit")
-	limit := 10
-	if q != "" {
-		if v, err := strconv.Atoi(q); err == nil && v > 0 {
-			limit = v
-		}
+	filter, ok := listFilter(c, 10)
+	if !ok {
+		return
 	}
 
-	ids, err := o.service.GetOrdersLimit(c.Request.Context(), limit)
+	ids, err := o.service.ListOrders(c.Request.Context(), filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, ids)
+	c.JSON(http.StatusOK, o.maskOrders(c, ids))
+}
+
+// listFilter reads the limit, from and to query params. An absent or invalid
+// limit gives defaultLimit; invalid dates are answered with 400 and false.
+func listFilter(c *gin.Context, defaultLimit int) (order.ListFilter, bool) {
+	filter := order.ListFilter{Limit: defaultLimit}
+	if q := c.Query("limit"); q != "" {
+		if v, err := strconv.Atoi(q); err == nil && v > 0 {
+			filter.Limit = v
+		}
+	}
+	var err error
+	if filter.From, err = transfer.ParseTime(c.Query("from")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: " + err.Error()})
+		return filter, false
+	}
+	if filter.To, err = transfer.ParseTime(c.Query("to")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: " + err.Error()})
+		return filter, false
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return filter, false
+	}
+	return filter, true
+}
+
+// exportErrorTrailer carries the error that cut an export short once the
+// response has started.
+const exportErrorTrailer = "X-Export-Error"
+
+// ExportOrders godoc
+// @Summary      Export orders
+// @Description  Streams the orders matching the filters, newest first, as they are read from the database. The format follows `format` (ndjson, csv or json) or else the Accept header (application/x-ndjson, text/csv, application/json), NDJSON by default. CSV has one row per item with the delivery and payment flattened into columns. `limit` is optional, all matching orders by default; `from` and `to` work as in the list. An error after the response has started is reported in the X-Export-Error trailer. Requires role viewer; personal data is masked without the pii:read scope
+// @Tags         orders
+// @Produce      application/x-ndjson,text/csv,json
+// @Param        format  query    string  false  "ndjson, csv or json; overrides Accept"
+// @Param        limit   query    int     false  "Most orders to export"
+// @Param        from    query    string  false  "Earliest date_created"
+// @Param        to      query    string  false  "date_created before"
+// @Success      200  {array}   order.Order
+// @Failure      400  {object}  map[string]string
+// @Failure      406  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      429  {object}  map[string]string
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /orders/export [get]
+func (o *OrderHandler) ExportOrders(c *gin.Context) {
+	var format transfer.Format
+	if name := c.Query("format"); name != "" {
+		var err error
+		if format, err = transfer.ParseFormat(name); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		var ok bool
+		if format, ok = transfer.Negotiate(c.GetHeader("Accept")); !ok {
+			c.JSON(http.StatusNotAcceptable, gin.H{"error": "acceptable types are application/x-ndjson, text/csv and application/json"})
+			return
+		}
+	}
+	filter, ok := listFilter(c, 0)
+	if !ok {
+		return
+	}
+
+	w := &exportWriter{c: c, format: format}
+	enc := transfer.NewEncoder(w, format)
+	err := o.service.ExportOrders(c.Request.Context(), filter, func(ord order.Order) error {
+		return enc.Encode(o.maskOrder(c, ord))
+	})
+	if err == nil {
+		err = enc.Close()
+	}
+	if err == nil {
+		return
+	}
+	if !w.started {
+		o.writeError(c, err)
+		return
+	}
+	_ = c.Error(err)
+	c.Writer.Header().Set(exportErrorTrailer, err.Error())
+}
+
+// exportWriter sends the export headers with the first bytes, so an error
+// before any order is read still gets a plain error response.
+type exportWriter struct {
+	c       *gin.Context
+	format  transfer.Format
+	started bool
+}
+
+func (w *exportWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		h := w.c.Writer.Header()
+		h.Set("Content-Type", w.format.ContentType())
+		h.Set("Content-Disposition", `attachment; filename="orders.`+string(w.format)+`"`)
+		h.Set("Trailer", exportErrorTrailer)
+		w.c.Status(http.StatusOK)
+	}
+	return w.c.Writer.Write(p)
+}
+
+// importResult is the import report with the error that stopped it, if any.
+type importResult struct {
+	transfer.ImportReport
+	Error string `json:"error,omitempty"`
+}
+
+// ImportOrders godoc
+// @Summary      Import orders
+// @Description  Reads orders from the request body as NDJSON (one order payload of any known version per line, e.g. as exported) or CSV (as exported, columns in any order, consecutive rows of one order_uid make one order). The format follows `format` or else the Content-Type (application/x-ndjson or text/csv), NDJSON by default. Every order is validated; orders that fail to decode, validate or save are reported with their line and skipped. Valid orders are saved in batches of `batch_size`, each in one transaction. `dry_run` saves and rolls back every batch. `from_line` skips the orders starting before that line, e.g. the next_line of a report cut short by an error, which comes with status 500. Requires role operator
+// @Tags         orders
+// @Accept       application/x-ndjson,text/csv
+// @Produce      json
+// @Param        format      query    string  false  "ndjson or csv; overrides Content-Type"
+// @Param        dry_run     query    bool    false  "Validate and roll back"
+// @Param        from_line   query    int     false  "First line to import"
+// @Param        batch_size  query    int     false  "Orders per transaction, 500 by default"
+// @Param        policy      query    string  false  "skip or overwrite existing orders; the configured policy by default"
+// @Param        strict      query    bool    false  "Reject NDJSON orders with fields unknown to their payload version; ORDER_PAYLOAD_STRICT by default"
+// @Success      200  {object}  importResult
+// @Failure      400  {object}  map[string]string
+// @Failure      415  {object}  map[string]string
+// @Failure      500  {object}  importResult
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      429  {object}  map[string]string
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /orders/import [post]
+func (o *OrderHandler) ImportOrders(c *gin.Context) {
+	format := transfer.NDJSON
+	if name := c.Query("format"); name != "" {
+		var err error
+		if format, err = transfer.ParseFormat(name); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else if ct := c.ContentType(); ct != "" {
+		f, ok := transfer.MediaFormat(ct)
+		if !ok {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "supported types are application/x-ndjson and text/csv"})
+			return
+		}
+		format = f
+	}
+
+	var opts transfer.ImportOptions
+	var err error
+	strict := o.strictPayloads
+	for _, p := range []struct {
+		name string
+		dst  *bool
+	}{{"dry_run", &opts.DryRun}, {"strict", &strict}} {
+		q := c.Query(p.name)
+		if q == "" {
+			continue
+		}
+		if *p.dst, err = strconv.ParseBool(q); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + p.name + ": " + q})
+			return
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"from_line", &opts.FromLine}, {"batch_size", &opts.BatchSize}} {
+		q := c.Query(p.name)
+		if q == "" {
+			continue
+		}
+		if *p.dst, err = strconv.Atoi(q); err != nil || *p.dst < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + p.name + ": " + q})
+			return
+		}
+	}
+	if q := c.Query("policy"); q != "" {
+		if opts.Policy, err = order.ParseConflictPolicy(q); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	dec, err := transfer.NewDecoder(c.Request.Body, format, strict)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	report, err := transfer.Import(c.Request.Context(), dec, o.service, opts)
+	if err != nil {
+		_ = c.Error(err)
+		c.JSON(http.StatusInternalServerError, importResult{ImportReport: report, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, importResult{ImportReport: report})
 }
 
 // CreateOrder godoc
 // @Summary      Create random order and publish to Kafka
-// @Description  Generates a random order, publishes it to Kafka and returns the created order
+// @Description  Generates a random order, publishes it to Kafka and returns the created order. Requires role operator
 // @Tags         orders
 // @Produce      json
 // @Success      201  {object}  order.Order
 // @Failure      500  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      429  {object}  map[string]string
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
 // @Router       /orders/ [post]
 func (o *OrderHandler) CreateOrder(c *gin.Context) {
 	order, err := o.service.CreateOrder(c.Request.Context())
@@ -112,5 +439,185 @@ func (o *OrderHandler) CreateOrder(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusCreated, order)
+	c.JSON(http.StatusCreated, o.maskOrder(c, order))
+}
+
+// DeleteOrder godoc
+// @Summary      Delete order
+// @Description  Soft-deletes the order: it is kept in the database but no longer returned by the API. Requires role admin
+// @Tags         orders
+// @Param        id   path      string  true  "Order UID"
+// @Success      204
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      429  {object}  map[string]string
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /orders/{id} [delete]
+func (o *OrderHandler) DeleteOrder(c *gin.Context) {
+	if err := o.service.DeleteOrder(c.Request.Context(), c.Param("id")); err != nil {
+		o.writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// EraseOrder godoc
+// @Summary      Erase personal data of order
+// @Description  Scrubs delivery contacts and customer id of the order (GDPR erasure) and soft-deletes it. Payments and items are kept. Requires role admin
+// @Tags         orders
+// @Param        id   path      string  true  "Order UID"
+// @Success      204
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      429  {object}  map[string]string
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /orders/{id}/erase [post]
+func (o *OrderHandler) EraseOrder(c *gin.Context) {
+	if err := o.service.EraseOrder(c.Request.Context(), c.Param("id")); err != nil {
+		o.writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type statusRequest struct {
+	Status *int `json:"status" binding:"required"`
+}
+
+// UpdateOrderStatus godoc
+// @Summary      Change status of order items
+// @Description  Sets the status of every item of the order. Requires role operator
+// @Tags         orders
+// @Accept       json
+// @Param        id    path      string         true  "Order UID"
+// @Param        body  body      statusRequest  true  "New status"
+// @Success      204
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      429  {object}  map[string]string
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /orders/{id}/status [patch]
+func (o *OrderHandler) UpdateOrderStatus(c *gin.Context) {
+	var req statusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := o.service.UpdateOrderStatus(c.Request.Context(), c.Param("id"), *req.Status); err != nil {
+		o.writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetOrderAudit godoc
+// @Summary      Get audit history of order
+// @Description  Returns every recorded mutation of the order, oldest first, with source and before/after diff. Requires role operator; personal data is masked without the pii:read scope
+// @Tags         orders
+// @Produce      json
+// @Param        id   path      string  true  "Order UID"
+// @Success      200  {array}   audit.Entry
+// @Failure      500  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      429  {object}  map[string]string
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /orders/{id}/audit [get]
+func (o *OrderHandler) GetOrderAudit(c *gin.Context) {
+	entries, err := o.service.GetOrderAudit(c.Request.Context(), c.Param("id"))
+	if err == nil {
+		entries, err = o.maskAudit(c, entries)
+	}
+	if err != nil {
+		o.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// auditSource tags the request context with the HTTP caller, so mutations made
+// through the service are attributed in the audit log.
+func auditSource() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor := c.GetHeader("X-Actor")
+		if actor == "" {
+			actor = c.ClientIP()
+		}
+		src := audit.Source{Kind: audit.SourceHTTP, Actor: actor, Ref: c.GetString(requestIDKey)}
+		c.Request = c.Request.WithContext(audit.WithSource(c.Request.Context(), src))
+		c.Next()
+	}
+}
+
+// dbSession scopes read-your-writes to the request: once it changes an order,
+// its later reads go to the primary instead of a possibly lagging replica.
+func dbSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(db.WithSession(c.Request.Context()))
+		c.Next()
+	}
+}
+
+const requestIDKey = "request_id"
+
+// requestID takes X-Request-ID from the caller or generates one, echoes it in
+// the response and tags log records of the request with it.
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if id == "" {
+			var b [8]byte
+			_, _ = rand.Read(b[:])
+			id = hex.EncodeToString(b[:])
+		}
+		c.Set(requestIDKey, id)
+		c.Header("X-Request-ID", id)
+		c.Request = c.Request.WithContext(logger.With(c.Request.Context(), requestIDKey, id))
+		c.Next()
+	}
+}
+
+// requestLog logs every request once it is served; server errors at error
+// level, the rest at info.
+func (o *OrderHandler) requestLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []any{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", status,
+			"duration", time.Since(start),
+			"client_ip", c.ClientIP(),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "error", c.Errors.String())
+		}
+		o.logger.Log(c.Request.Context(), level, "http request", attrs...)
+	}
+}
+
+func (o *OrderHandler) writeError(c *gin.Context, err error) {
+	if errors.Is(err, order.ErrOrderNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	_ = c.Error(err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 }
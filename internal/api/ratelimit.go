@@ -0,0 +1,80 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"L0/internal/auth"
+	"L0/internal/metrics"
+	"L0/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WithRateLimits limits /orders requests per client: read for GET requests,
+// write for the rest. A client is its principal once authenticated, its IP
+// when authentication is disabled. A nil limiter leaves that class unlimited.
+func WithRateLimits(read, write *ratelimit.Limiter) HandlerOption {
+	return func(o *OrderHandler) {
+		o.readLimit = read
+		o.writeLimit = write
+	}
+}
+
+// WithIPRateLimit limits all /orders requests per client IP before they are
+// authenticated. A nil limiter leaves IPs unlimited.
+func WithIPRateLimit(l *ratelimit.Limiter) HandlerOption {
+	return func(o *OrderHandler) { o.ipLimit = l }
+}
+
+// WithTrustedProxies sets the proxies whose X-Forwarded-For is believed when
+// resolving the client IP. By default none is, so clients cannot pick their
+// own rate limit key.
+func WithTrustedProxies(proxies []string) HandlerOption {
+	return func(o *OrderHandler) { o.trustedProxies = proxies }
+}
+
+// ipRateLimit runs before authentication, so that guessing credentials is
+// limited too, and keys clients by IP: nothing they send is verified yet.
+func (o *OrderHandler) ipRateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if o.ipLimit == nil {
+			c.Next()
+			return
+		}
+		limit(c, "ip", o.ipLimit, "ip:"+c.ClientIP())
+	}
+}
+
+// rateLimit runs after authentication and keys clients by principal, so
+// that callers sharing an IP behind a NAT keep their own buckets and a key
+// shared across hosts has one.
+func (o *OrderHandler) rateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class, limiter := "write", o.writeLimit
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			class, limiter = "read", o.readLimit
+		}
+		if limiter == nil {
+			c.Next()
+			return
+		}
+		key := "ip:" + c.ClientIP()
+		if p, ok := auth.PrincipalFrom(c.Request.Context()); ok {
+			key = p.Method + ":" + p.Subject
+		}
+		limit(c, class, limiter, key)
+	}
+}
+
+// limit answers 429 with Retry-After once the key's bucket is empty.
+func limit(c *gin.Context, class string, limiter *ratelimit.Limiter, key string) {
+	if ok, retryAfter := limiter.Allow(key); !ok {
+		metrics.RateLimited.WithLabelValues(class).Inc()
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+		return
+	}
+	c.Next()
+}
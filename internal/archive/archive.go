@@ -0,0 +1,392 @@
+// Package archive moves orders older than a cutoff out of Postgres into
+// compressed files and reads them back by order_uid.
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"L0/internal/config"
+	"L0/internal/db"
+	"L0/internal/metrics"
+	"L0/internal/order"
+	"L0/internal/partition"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockKey serializes archival between instances; it differs from the
+// migration and partition maintenance locks.
+const lockKey int64 = 5_337_100_046
+
+// Lister reads live orders; *order.OrderRepository satisfies it.
+type Lister interface {
+	List(ctx context.Context, filter order.ListFilter) ([]order.Order, error)
+}
+
+// Report sums up an archival run.
+type Report struct {
+	Before time.Time `json:"before"`
+	// Orders were written to Files and removed from Postgres.
+	Orders int `json:"orders"`
+	Files  int `json:"files"`
+	// Purged counts deleted orders of the archived months, removed without
+	// being archived.
+	Purged int `json:"purged"`
+	// Skipped is set when another instance held the archival lock.
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// Archiver writes the orders of each month before a cutoff to storage in
+// chunks of ChunkSize, records every archived order_uid in the
+// order_archive index and deletes the orders from Postgres. Archived orders
+// can only be read or removed: their order_uids stay in the order_uids
+// registry, so the repository does not save them again.
+type Archiver struct {
+	pool    *pgxpool.Pool
+	orders  Lister
+	storage Storage
+	format  Format
+	after   int
+	chunk   int
+	prefix  string
+	logger  *slog.Logger
+}
+
+func New(pool *pgxpool.Pool, orders Lister, storage Storage, cfg config.ArchiveConf, logger *slog.Logger) (*Archiver, error) {
+	format, err := ParseFormat(cfg.Format)
+	if err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Archiver{
+		pool:    pool,
+		orders:  orders,
+		storage: storage,
+		format:  format,
+		after:   cfg.AfterMonths,
+		chunk:   cfg.ChunkSize,
+		prefix:  cfg.Prefix,
+		logger:  logger,
+	}, nil
+}
+
+// Cutoff is the start of the oldest month kept in Postgres as of now.
+func (a *Archiver) Cutoff(now time.Time) time.Time {
+	return partition.Month(now).AddDate(0, -a.after, 0)
+}
+
+// Run archives the orders before Cutoff now and then every interval until
+// ctx is done. Failures are logged and retried on the next tick.
+func (a *Archiver) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		report, err := a.RunOnce(ctx, a.Cutoff(time.Now()))
+		switch {
+		case err != nil && ctx.Err() == nil:
+			a.logger.ErrorContext(ctx, "order archival failed", "error", err)
+		case report.Orders+report.Purged > 0:
+			a.logger.InfoContext(ctx, "order archival done", "before", report.Before, "orders", report.Orders, "files", report.Files, "purged", report.Purged)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// RunOnce archives the live orders created before before, month by month,
+// and purges the deleted ones. It does nothing when another instance is
+// archiving. A run that fails part way leaves the orders not yet indexed in
+// Postgres; the next run picks them up.
+func (a *Archiver) RunOnce(ctx context.Context, before time.Time) (Report, error) {
+	report := Report{Before: before.UTC()}
+	conn, err := a.pool.Acquire(ctx)
+	if err != nil {
+		return report, err
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, lockKey).Scan(&locked); err != nil {
+		return report, fmt.Errorf("acquire archival lock: %w", err)
+	}
+	if !locked {
+		report.Skipped = true
+		return report, nil
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey); err != nil {
+			conn.Conn().Close(context.Background())
+		}
+	}()
+
+	var oldest *time.Time
+	if err := conn.QueryRow(ctx, `SELECT min(date_created) FROM orders WHERE date_created < $1`, before).Scan(&oldest); err != nil {
+		return report, err
+	}
+	if oldest == nil {
+		return report, nil
+	}
+	// Keys of one run are unique, so a file left by a failed run is never
+	// overwritten; it is just not referenced by the index.
+	run := time.Now().UTC().Format("20060102T150405Z")
+	for month := partition.Month(*oldest); month.Before(before); month = month.AddDate(0, 1, 0) {
+		to := month.AddDate(0, 1, 0)
+		if to.After(before) {
+			to = before
+		}
+		if err := a.archiveMonth(ctx, conn, month, to, run, &report); err != nil {
+			return report, fmt.Errorf("archive %s: %w", month.Format("2006-01"), err)
+		}
+	}
+	return report, nil
+}
+
+// archiveMonth archives the orders created in [from, to), one chunk per
+// file. Each chunk is indexed and deleted in one transaction after its file
+// is stored, so an order is always either in Postgres or in the index.
+func (a *Archiver) archiveMonth(ctx context.Context, conn *pgxpool.Conn, from, to time.Time, run string, report *Report) error {
+	// Deleted rows must not come back from a lagging replica.
+	readCtx := db.WithPrimary(ctx)
+	for part := 0; ; part++ {
+		orders, err := a.orders.List(readCtx, order.ListFilter{From: from, To: to, Limit: a.chunk})
+		if err != nil {
+			return err
+		}
+		if len(orders) == 0 {
+			break
+		}
+		data, err := a.format.Encode(orders)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("%s/%04d/%02d/%s-%05d%s", a.prefix, from.Year(), int(from.Month()), run, part, a.format.Ext())
+		if err := a.storage.Put(ctx, key, data); err != nil {
+			return fmt.Errorf("store %s: %w", key, err)
+		}
+		if err := indexChunk(ctx, conn, key, orders, from, to); err != nil {
+			return fmt.Errorf("index %s: %w", key, err)
+		}
+		report.Orders += len(orders)
+		report.Files++
+		metrics.ArchivedOrders.WithLabelValues("archived").Add(float64(len(orders)))
+	}
+
+	purged, err := purgeDeleted(ctx, conn, from, to)
+	if err != nil {
+		return fmt.Errorf("purge deleted orders: %w", err)
+	}
+	report.Purged += purged
+	metrics.ArchivedOrders.WithLabelValues("purged").Add(float64(purged))
+	return nil
+}
+
+// indexChunk records the orders of the file key and deletes them with their
+// children. The bounds of the month keep the deletes to its partitions.
+func indexChunk(ctx context.Context, conn *pgxpool.Conn, key string, orders []order.Order, from, to time.Time) error {
+	uids := make([]string, len(orders))
+	dates := make([]time.Time, len(orders))
+	for i, o := range orders {
+		uids[i], dates[i] = o.OrderUID, o.DateCreated
+	}
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		// Saves of these orders wait for the archive to commit and then
+		// find them in the index.
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended(u, 0)) FROM unnest($1::text[]) AS u ORDER BY u`, uids); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO order_archive (order_uid, date_created, object_key)
+			SELECT u, d, $3 FROM unnest($1::text[], $2::timestamptz[]) AS a(u, d)
+			ON CONFLICT (order_uid) DO UPDATE SET
+				date_created = EXCLUDED.date_created,
+				object_key = EXCLUDED.object_key,
+				archived_at = now()
+		`, uids, dates, key); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `
+			WITH gone AS (
+				DELETE FROM orders o
+				USING unnest($1::text[], $2::timestamptz[]) AS a(u, d)
+				WHERE o.order_uid = a.u AND o.date_created = a.d
+					AND o.date_created >= $3 AND o.date_created < $4
+				RETURNING o.order_uid, o.track_number, o.date_created
+			), d AS (
+				DELETE FROM deliveries x USING gone
+				WHERE x.order_uid = gone.order_uid AND x.date_created = gone.date_created
+					AND x.date_created >= $3 AND x.date_created < $4
+			), p AS (
+				DELETE FROM payments x USING gone
+				WHERE x.order_uid = gone.order_uid AND x.date_created = gone.date_created
+					AND x.date_created >= $3 AND x.date_created < $4
+			)
+			DELETE FROM products x USING gone
+			WHERE x.track_number = gone.track_number AND x.date_created = gone.date_created
+				AND x.date_created >= $3 AND x.date_created < $4
+		`, uids, dates, from, to)
+		return err
+	})
+}
+
+// purgeDeleted removes the soft-deleted orders created in [from, to) with
+// their children.
+func purgeDeleted(ctx context.Context, conn *pgxpool.Conn, from, to time.Time) (int, error) {
+	var n int
+	err := conn.QueryRow(ctx, `
+		WITH gone AS (
+			DELETE FROM orders
+			WHERE deleted_at IS NOT NULL AND date_created >= $1 AND date_created < $2
+			RETURNING order_uid, track_number, date_created
+		), d AS (
+			DELETE FROM deliveries x USING gone
+			WHERE x.order_uid = gone.order_uid AND x.date_created = gone.date_created
+				AND x.date_created >= $1 AND x.date_created < $2
+		), p AS (
+			DELETE FROM payments x USING gone
+			WHERE x.order_uid = gone.order_uid AND x.date_created = gone.date_created
+				AND x.date_created >= $1 AND x.date_created < $2
+		), pr AS (
+			DELETE FROM products x USING gone
+			WHERE x.track_number = gone.track_number AND x.date_created = gone.date_created
+				AND x.date_created >= $1 AND x.date_created < $2
+		)
+		SELECT count(*) FROM gone
+	`, from, to).Scan(&n)
+	return n, err
+}
+
+// Get reads an archived order from its file. It returns
+// order.ErrOrderNotFound for order_uids missing from the index.
+func (a *Archiver) Get(ctx context.Context, orderId string) (order.Order, error) {
+	var key string
+	err := a.pool.QueryRow(ctx, `SELECT object_key FROM order_archive WHERE order_uid = $1`, orderId).Scan(&key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return order.Order{}, order.ErrOrderNotFound
+	}
+	if err != nil {
+		return order.Order{}, err
+	}
+	format, err := formatOf(key)
+	if err != nil {
+		return order.Order{}, err
+	}
+	data, err := a.storage.Get(ctx, key)
+	if err != nil {
+		return order.Order{}, fmt.Errorf("read %s: %w", key, err)
+	}
+	orders, err := format.Decode(data)
+	if err != nil {
+		return order.Order{}, fmt.Errorf("decode %s: %w", key, err)
+	}
+	for _, o := range orders {
+		if o.OrderUID == orderId {
+			metrics.ArchivedOrders.WithLabelValues("read").Inc()
+			return o, nil
+		}
+	}
+	return order.Order{}, fmt.Errorf("order %s is indexed in %s but missing from it", orderId, key)
+}
+
+// Remove takes an archived order out of the archive, for deletes and erasure
+// of personal data. The other orders of its file are written to a new file,
+// the index is moved to it in one transaction with dropping the order, and
+// the old file is deleted once that commits, so no copy of the order is left
+// in storage. audit gets the removed order as before. Remove returns
+// order.ErrOrderNotFound for order_uids missing from the index.
+func (a *Archiver) Remove(ctx context.Context, orderId string, audit order.AuditFunc) error {
+	var key string
+	err := pgx.BeginFunc(ctx, a.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, orderId); err != nil {
+			return err
+		}
+		// Locking the order's row first and then the rest of its file
+		// serializes removals from one file; a removal that waited reads the
+		// key its predecessor moved the file to.
+		err := tx.QueryRow(ctx, `SELECT object_key FROM order_archive WHERE order_uid = $1 FOR UPDATE`, orderId).Scan(&key)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return order.ErrOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `SELECT 1 FROM order_archive WHERE object_key = $1 FOR UPDATE`, key); err != nil {
+			return err
+		}
+
+		format, err := formatOf(key)
+		if err != nil {
+			return err
+		}
+		data, err := a.storage.Get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", key, err)
+		}
+		orders, err := format.Decode(data)
+		if err != nil {
+			return fmt.Errorf("decode %s: %w", key, err)
+		}
+		var removed *order.Order
+		rest := make([]order.Order, 0, len(orders))
+		for i := range orders {
+			if orders[i].OrderUID == orderId {
+				removed = &orders[i]
+			} else {
+				rest = append(rest, orders[i])
+			}
+		}
+		if removed == nil {
+			return fmt.Errorf("order %s is indexed in %s but missing from it", orderId, key)
+		}
+
+		if len(rest) > 0 {
+			data, err := format.Encode(rest)
+			if err != nil {
+				return err
+			}
+			next := rewrittenKey(key, format.Ext(), time.Now())
+			if err := a.storage.Put(ctx, next, data); err != nil {
+				return fmt.Errorf("store %s: %w", next, err)
+			}
+			if _, err := tx.Exec(ctx, `UPDATE order_archive SET object_key = $2 WHERE object_key = $1`, key, next); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM order_archive WHERE order_uid = $1`, orderId); err != nil {
+			return err
+		}
+		if audit != nil {
+			return audit(ctx, tx, removed, nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	metrics.ArchivedOrders.WithLabelValues("removed").Inc()
+	if err := a.storage.Delete(ctx, key); err != nil {
+		return fmt.Errorf("delete %s: %w", key, err)
+	}
+	return nil
+}
+
+// rewrittenKey names the file replacing key after a removal: the key of the
+// original chunk with the time of the rewrite, so rewrites never overwrite a
+// file the index may still reference.
+func rewrittenKey(key, ext string, now time.Time) string {
+	stem := strings.TrimSuffix(key, ext)
+	if i := strings.LastIndex(stem, "~"); i > strings.LastIndex(stem, "/") {
+		stem = stem[:i]
+	}
+	return stem + "~" + now.UTC().Format("20060102T150405.000000000Z") + ext
+}
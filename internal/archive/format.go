@@ -0,0 +1,136 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"L0/internal/order"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Format encodes a chunk of orders into one archive file. The extension of
+// the file names its format, so files stay readable after ARCHIVE_FORMAT
+// changes.
+type Format interface {
+	Ext() string
+	Encode(orders []order.Order) ([]byte, error)
+	Decode(data []byte) ([]order.Order, error)
+}
+
+var formats = []Format{ndjsonFormat{}, parquetFormat{}}
+
+// ParseFormat returns the format named ndjson or parquet.
+func ParseFormat(name string) (Format, error) {
+	switch name {
+	case "ndjson":
+		return ndjsonFormat{}, nil
+	case "parquet":
+		return parquetFormat{}, nil
+	default:
+		return nil, fmt.Errorf("unknown archive format %q", name)
+	}
+}
+
+// formatOf returns the format of the file named key.
+func formatOf(key string) (Format, error) {
+	for _, f := range formats {
+		if strings.HasSuffix(key, f.Ext()) {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown format of archive file %s", key)
+}
+
+// ndjsonFormat is one order per line as the API returns it, with the
+// payload version the API leaves out, gzip-compressed.
+type ndjsonFormat struct{}
+
+// ndjsonOrder is a line of an ndjson file.
+type ndjsonOrder struct {
+	order.Order
+	PayloadVersion int `json:"payload_version,omitempty"`
+}
+
+func (ndjsonFormat) Ext() string { return ".ndjson.gz" }
+
+func (ndjsonFormat) Encode(orders []order.Order) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, o := range orders {
+		if err := enc.Encode(ndjsonOrder{Order: o, PayloadVersion: o.PayloadVersion}); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (ndjsonFormat) Decode(data []byte) ([]order.Order, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var orders []order.Order
+	sc := bufio.NewScanner(zr)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var o ndjsonOrder
+		if err := json.Unmarshal(sc.Bytes(), &o); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		o.Order.PayloadVersion = o.PayloadVersion
+		orders = append(orders, o.Order)
+	}
+	return orders, sc.Err()
+}
+
+// parquetFormat stores the orders in one row group with the delivery and
+// payment as groups and the items as a repeated group, so analytics tools
+// can read the archive directly.
+type parquetFormat struct{}
+
+func (parquetFormat) Ext() string { return ".parquet" }
+
+func (parquetFormat) Encode(orders []order.Order) ([]byte, error) {
+	var buf bytes.Buffer
+	w := parquet.NewGenericWriter[order.Order](&buf, parquet.Compression(&parquet.Zstd))
+	if _, err := w.Write(orders); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (parquetFormat) Decode(data []byte) ([]order.Order, error) {
+	r := parquet.NewGenericReader[order.Order](bytes.NewReader(data))
+	defer r.Close()
+	orders := make([]order.Order, r.NumRows())
+	n, err := r.Read(orders)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	orders = orders[:n]
+	// Parquet does not tell an empty list from a missing one.
+	for i := range orders {
+		if orders[i].Products == nil {
+			orders[i].Products = []order.Product{}
+		}
+	}
+	return orders, nil
+}
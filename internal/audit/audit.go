@@ -0,0 +1,202 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+type Action string
+
+const (
+	ActionCreate       Action = "create"
+	ActionUpdate       Action = "update"
+	ActionDelete       Action = "delete"
+	ActionErase        Action = "erase"
+	ActionStatusChange Action = "status_change"
+)
+
+const (
+	SourceKafka  = "kafka"
+	SourceHTTP   = "http"
+	SourceSystem = "system"
+)
+
+// Source describes where a mutation came from: a Kafka message (Ref holds
+// topic/partition/offset) or an HTTP request (Actor holds the caller identity).
+type Source struct {
+	Kind  string `json:"kind"`
+	Actor string `json:"actor,omitempty"`
+	Ref   string `json:"ref,omitempty"`
+}
+
+type Change struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+type Entry struct {
+	ID        int64             `json:"id"`
+	OrderUID  string            `json:"order_uid"`
+	Action    Action            `json:"action"`
+	Source    Source            `json:"source"`
+	Before    json.RawMessage   `json:"before,omitempty" swaggertype:"object"`
+	After     json.RawMessage   `json:"after,omitempty" swaggertype:"object"`
+	Diff      map[string]Change `json:"diff,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type sourceKey struct{}
+
+func WithSource(ctx context.Context, src Source) context.Context {
+	return context.WithValue(ctx, sourceKey{}, src)
+}
+
+// SourceFrom returns the source stored in ctx, or a "system" source when the
+// mutation was not triggered by Kafka or HTTP.
+func SourceFrom(ctx context.Context) Source {
+	if src, ok := ctx.Value(sourceKey{}).(Source); ok {
+		return src
+	}
+	return Source{Kind: SourceSystem}
+}
+
+func KafkaSource(topic string, partition int, offset int64) Source {
+	return Source{Kind: SourceKafka, Ref: fmt.Sprintf("%s/%d/%d", topic, partition, offset)}
+}
+
+// NewEntry snapshots before and after (either may be nil) and computes the diff
+// between them. The source is taken from ctx.
+func NewEntry(ctx context.Context, orderUID string, action Action, before, after any) (Entry, error) {
+	entry := Entry{OrderUID: orderUID, Action: action, Source: SourceFrom(ctx)}
+	var err error
+	if before != nil {
+		if entry.Before, err = json.Marshal(before); err != nil {
+			return Entry{}, err
+		}
+	}
+	if after != nil {
+		if entry.After, err = json.Marshal(after); err != nil {
+			return Entry{}, err
+		}
+	}
+	if entry.Diff, err = Diff(entry.Before, entry.After); err != nil {
+		return Entry{}, err
+	}
+	return entry, nil
+}
+
+// Mask returns a copy of e with the values at paths replaced by mask in both
+// snapshots and in the diff.
+func Mask(e Entry, paths []string, mask string) (Entry, error) {
+	var err error
+	if e.Before, err = maskDoc(e.Before, paths, mask); err != nil {
+		return Entry{}, err
+	}
+	if e.After, err = maskDoc(e.After, paths, mask); err != nil {
+		return Entry{}, err
+	}
+	if len(e.Diff) > 0 {
+		diff := make(map[string]Change, len(e.Diff))
+		for path, ch := range e.Diff {
+			if slices.Contains(paths, path) {
+				ch = Change{Before: maskValue(ch.Before, mask), After: maskValue(ch.After, mask)}
+			}
+			diff[path] = ch
+		}
+		e.Diff = diff
+	}
+	return e, nil
+}
+
+func maskDoc(doc json.RawMessage, paths []string, mask string) (json.RawMessage, error) {
+	if len(doc) == 0 {
+		return doc, nil
+	}
+	var v map[string]any
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		keys := strings.Split(path, ".")
+		obj := v
+		for _, k := range keys[:len(keys)-1] {
+			obj, _ = obj[k].(map[string]any)
+		}
+		if cur, ok := obj[keys[len(keys)-1]]; ok {
+			obj[keys[len(keys)-1]] = maskValue(cur, mask)
+		}
+	}
+	return json.Marshal(v)
+}
+
+func maskValue(v any, mask string) any {
+	if v == nil || v == "" {
+		return v
+	}
+	return mask
+}
+
+// Diff compares two JSON documents and returns changed leaves keyed by their
+// dotted path (e.g. "delivery.phone"). Arrays are compared as a whole.
+func Diff(before, after json.RawMessage) (map[string]Change, error) {
+	b, err := flatten(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := flatten(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string]Change)
+	for path, bv := range b {
+		av, ok := a[path]
+		if !ok || !reflect.DeepEqual(bv, av) {
+			diff[path] = Change{Before: bv, After: av}
+		}
+	}
+	for path, av := range a {
+		if _, ok := b[path]; !ok {
+			diff[path] = Change{Before: nil, After: av}
+		}
+	}
+	if len(diff) == 0 {
+		return nil, nil
+	}
+	return diff, nil
+}
+
+func flatten(doc json.RawMessage) (map[string]any, error) {
+	res := make(map[string]any)
+	if len(doc) == 0 {
+		return res, nil
+	}
+	var v any
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return nil, err
+	}
+	flattenInto(res, "", v)
+	return res, nil
+}
+
+func flattenInto(res map[string]any, prefix string, v any) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		if prefix != "" {
+			res[prefix] = v
+		}
+		return
+	}
+	for k, child := range obj {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		flattenInto(res, path, child)
+	}
+}
@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"L0/internal/db"
+)
+
+type Store struct {
+	client db.Client
+}
+
+func NewStore(client db.Client) *Store {
+	return &Store{client: client}
+}
+
+// Record inserts entry through client, normally the transaction of the change
+// it describes, so the change and its entry are committed together.
+func (s *Store) Record(ctx context.Context, client db.Client, entry Entry) error {
+	var diff []byte
+	if len(entry.Diff) > 0 {
+		var err error
+		if diff, err = json.Marshal(entry.Diff); err != nil {
+			return err
+		}
+	}
+	query := `
+		INSERT INTO order_audit (
+			order_uid, action, source_kind, actor, source_ref, before, after, diff
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+	`
+	_, err := client.Exec(ctx, query,
+		entry.OrderUID,
+		string(entry.Action),
+		entry.Source.Kind,
+		entry.Source.Actor,
+		entry.Source.Ref,
+		nullJSON(entry.Before),
+		nullJSON(entry.After),
+		nullJSON(diff),
+	)
+	return err
+}
+
+func (s *Store) History(ctx context.Context, orderUID string) ([]Entry, error) {
+	query := `
+		SELECT id, order_uid, action, source_kind, COALESCE(actor, ''), COALESCE(source_ref, ''),
+			before, after, diff, created_at
+		FROM order_audit
+		WHERE order_uid = $1
+		ORDER BY created_at, id
+	`
+	rows, err := s.client.Query(ctx, query, orderUID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]Entry, 0)
+	for rows.Next() {
+		var (
+			e      Entry
+			action string
+			diff   []byte
+		)
+		if err := rows.Scan(&e.ID, &e.OrderUID, &action, &e.Source.Kind, &e.Source.Actor, &e.Source.Ref,
+			&e.Before, &e.After, &diff, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Action = Action(action)
+		if len(diff) > 0 {
+			if err := json.Unmarshal(diff, &e.Diff); err != nil {
+				return nil, fmt.Errorf("decode audit diff %d: %w", e.ID, err)
+			}
+		}
+		result = append(result, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Redact blanks the given dotted paths in every stored snapshot of the order
+// and drops them from the diffs, so erased personal data does not survive in
+// the audit history. It runs through client, like Record.
+func (s *Store) Redact(ctx context.Context, client db.Client, orderUID string, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	before, after := "before", "after"
+	args := []any{orderUID, paths}
+	for _, path := range paths {
+		args = append(args, strings.Split(path, "."))
+		n := len(args)
+		before = fmt.Sprintf(`jsonb_set(%s, $%d::text[], '""', false)`, before, n)
+		after = fmt.Sprintf(`jsonb_set(%s, $%d::text[], '""', false)`, after, n)
+	}
+	query := fmt.Sprintf(`
+		UPDATE order_audit SET
+			before = CASE WHEN jsonb_typeof(before) = 'object' THEN %s ELSE before END,
+			after = CASE WHEN jsonb_typeof(after) = 'object' THEN %s ELSE after END,
+			diff = diff - $2::text[]
+		WHERE order_uid = $1
+	`, before, after)
+	_, err := client.Exec(ctx, query, args...)
+	return err
+}
+
+func nullJSON(doc []byte) any {
+	if len(doc) == 0 {
+		return nil
+	}
+	return doc
+}
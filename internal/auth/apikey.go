@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type apiKey struct {
+	key       []byte
+	principal Principal
+}
+
+// APIKeys authenticates requests by the X-API-Key header or an
+// "Authorization: ApiKey <key>" header.
+type APIKeys struct {
+	keys []apiKey
+}
+
+// ParseAPIKeys parses a comma separated list of name:role:key entries, e.g.
+// "ci:operator:s3cr3t,ops:admin:t0ps3cr3t".
+func ParseAPIKeys(spec string) (*APIKeys, error) {
+	a := &APIKeys{}
+	for i, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("api key entry %d: want name:role:key", i+1)
+		}
+		role, err := ParseRole(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("api key %q: %w", parts[0], err)
+		}
+		a.Add(parts[0], parts[2], role)
+	}
+	return a, nil
+}
+
+func (a *APIKeys) Add(name, key string, role Role) {
+	a.keys = append(a.keys, apiKey{
+		key:       []byte(key),
+		principal: Principal{Subject: name, Role: role, Method: "api_key"},
+	})
+}
+
+func (a *APIKeys) Len() int {
+	return len(a.keys)
+}
+
+func (a *APIKeys) Authenticate(r *http.Request) (Principal, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		scheme, value, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "ApiKey") {
+			return Principal{}, ErrNoCredentials
+		}
+		key = strings.TrimSpace(value)
+	}
+	// Compare against every key so timing does not reveal which one matched.
+	var found *Principal
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(a.keys[i].key, []byte(key)) == 1 {
+			found = &a.keys[i].principal
+		}
+	}
+	if found == nil {
+		return Principal{}, ErrInvalidCredentials
+	}
+	return *found, nil
+}
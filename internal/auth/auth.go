@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"L0/internal/config"
+)
+
+var (
+	// ErrNoCredentials means the request carries no credentials this
+	// authenticator understands, so the next one may try.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials means credentials were presented but rejected.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Role grants access to routes; each role includes the ones below it.
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleOperator
+	RoleAdmin
+)
+
+func ParseRole(s string) (Role, error) {
+	switch s {
+	case "viewer":
+		return RoleViewer, nil
+	case "operator":
+		return RoleOperator, nil
+	case "admin":
+		return RoleAdmin, nil
+	}
+	return RoleNone, fmt.Errorf("unknown role %q (want viewer, operator or admin)", s)
+}
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	}
+	return "none"
+}
+
+// ScopePIIRead allows reading personal data of orders unmasked.
+const ScopePIIRead = "pii:read"
+
+// Principal is the authenticated caller.
+type Principal struct {
+	Subject string
+	Role    Role
+	Scopes  []string
+	// Method is how the caller authenticated: "api_key" or "jwt".
+	Method string
+}
+
+// HasScope reports whether the principal holds scope. Admins hold every scope.
+func (p Principal) HasScope(scope string) bool {
+	return p.Role == RoleAdmin || slices.Contains(p.Scopes, scope)
+}
+
+// Authenticator extracts a principal from a request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+// Chain tries authenticators in order; the first one that finds credentials
+// decides.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+	return Principal{}, ErrNoCredentials
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the principal stored by WithPrincipal.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// New builds the authenticator described by cfg: API keys first, then JWT.
+// It returns nil when authentication is disabled.
+func New(cfg config.AuthConf) (Authenticator, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	var chain Chain
+	if cfg.APIKeys != "" {
+		keys, err := ParseAPIKeys(cfg.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, keys)
+	}
+	if cfg.JWTSecret != "" || cfg.JWKSFile != "" {
+		j, err := NewJWT(JWTOptions{
+			HS256Secret: []byte(cfg.JWTSecret),
+			JWKSFile:    cfg.JWKSFile,
+			Issuer:      cfg.JWTIssuer,
+			Audience:    cfg.JWTAudience,
+			RoleClaim:   cfg.RoleClaim,
+		})
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, j)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("auth is enabled but no API keys, JWT secret or JWKS file are configured")
+	}
+	return chain, nil
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type JWTOptions struct {
+	// HS256Secret enables HS256 tokens signed with this shared secret.
+	HS256Secret []byte
+	// JWKSFile enables RS256 tokens signed by keys of this local JWKS file.
+	JWKSFile string
+	// Issuer and Audience, when set, must match the iss and aud claims.
+	Issuer   string
+	Audience string
+	// RoleClaim names the claim holding the role; "role" by default.
+	RoleClaim string
+}
+
+// JWT authenticates "Authorization: Bearer <token>" requests. The role comes
+// from the role claim and scopes from a space separated "scope" claim or a
+// "scopes" array.
+type JWT struct {
+	parser    *jwt.Parser
+	secret    []byte
+	keys      map[string]*rsa.PublicKey
+	roleClaim string
+}
+
+func NewJWT(opts JWTOptions) (*JWT, error) {
+	j := &JWT{secret: opts.HS256Secret, roleClaim: opts.RoleClaim}
+	if j.roleClaim == "" {
+		j.roleClaim = "role"
+	}
+	var methods []string
+	if len(opts.HS256Secret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if opts.JWKSFile != "" {
+		keys, err := LoadJWKS(opts.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		j.keys = keys
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("jwt: neither an HS256 secret nor a JWKS file is configured")
+	}
+
+	parserOpts := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired()}
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+	j.parser = jwt.NewParser(parserOpts...)
+	return j, nil
+}
+
+func (j *JWT) Authenticate(r *http.Request) (Principal, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return Principal{}, ErrNoCredentials
+	}
+	claims := jwt.MapClaims{}
+	if _, err := j.parser.ParseWithClaims(strings.TrimSpace(token), claims, j.key); err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		return Principal{}, fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+	}
+	roleName, _ := claims[j.roleClaim].(string)
+	role, err := ParseRole(roleName)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	return Principal{Subject: sub, Role: role, Scopes: scopes(claims), Method: "jwt"}, nil
+}
+
+func (j *JWT) key(t *jwt.Token) (any, error) {
+	switch t.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return j.secret, nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := t.Header["kid"].(string)
+		if key, ok := j.keys[kid]; ok {
+			return key, nil
+		}
+		if kid == "" && len(j.keys) == 1 {
+			for _, key := range j.keys {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+}
+
+func scopes(claims jwt.MapClaims) []string {
+	if s, ok := claims["scope"].(string); ok {
+		return strings.Fields(s)
+	}
+	list, _ := claims["scopes"].([]any)
+	res := make([]string, 0, len(list))
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// LoadJWKS reads the RSA signing keys of a JWKS file, indexed by key id.
+func LoadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set jwks
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("decode jwks %s: %w", path, err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("jwks key %q: modulus: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("jwks key %q: exponent: %w", k.Kid, err)
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("jwks %s has no RSA signing keys", path)
+	}
+	return keys, nil
+}
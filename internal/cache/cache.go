@@ -1,8 +1,12 @@
 package cache
 
 import (
+	"L0/internal/metrics"
 	"L0/internal/order"
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 )
 
 type CacheOrder struct {
@@ -10,6 +14,8 @@ type CacheOrder struct {
 	Size     int
 	Orders   map[string]order.Order
 	OrderIds []string
+
+	warmed atomic.Bool
 }
 
 func NewCache(size int) *CacheOrder {
@@ -31,6 +37,20 @@ func (cache *CacheOrder) Set(instance order.Order) {
 			cache.OrderIds = append([]string{instance.OrderUID}, cache.OrderIds[:cache.Size-1]...)
 		}
 	}
+	metrics.CacheSize.Set(float64(len(cache.Orders)))
+}
+
+// SetSize changes the capacity, evicting the oldest orders beyond it.
+func (cache *CacheOrder) SetSize(size int) {
+	cache.Mu.Lock()
+	defer cache.Mu.Unlock()
+	cache.Size = size
+	for len(cache.OrderIds) > max(size, 0) {
+		last := len(cache.OrderIds) - 1
+		delete(cache.Orders, cache.OrderIds[last])
+		cache.OrderIds = cache.OrderIds[:last]
+	}
+	metrics.CacheSize.Set(float64(len(cache.Orders)))
 }
 
 func (cache *CacheOrder) Get(key string) (*order.Order, bool) {
@@ -38,15 +58,48 @@ func (cache *CacheOrder) Get(key string) (*order.Order, bool) {
 	defer cache.Mu.Unlock()
 	v, ok := cache.Orders[key]
 	if !ok {
+		metrics.CacheMiss()
 		return nil, false
 	}
+	metrics.CacheHit()
 	return &v, true
 }
 
+func (cache *CacheOrder) Delete(key string) {
+	cache.Mu.Lock()
+	defer cache.Mu.Unlock()
+	if _, ok := cache.Orders[key]; !ok {
+		return
+	}
+	delete(cache.Orders, key)
+	ids := cache.OrderIds[:0]
+	for _, id := range cache.OrderIds {
+		if id != key {
+			ids = append(ids, id)
+		}
+	}
+	cache.OrderIds = ids
+	metrics.CacheSize.Set(float64(len(cache.Orders)))
+}
+
+// Load fills the cache with orders and marks it warmed up.
 func (cache *CacheOrder) Load(orders []order.Order) {
 	for _, order := range orders {
 		cache.Set(order)
 	}
+	cache.warmed.Store(true)
+}
+
+func (cache *CacheOrder) Warmed() bool {
+	return cache.warmed.Load()
+}
+
+// CheckWarm is a readiness check that fails until Load has run.
+func (cache *CacheOrder) CheckWarm(ctx context.Context) error {
+	if !cache.Warmed() {
+		return errors.New("cache is not warmed up")
+	}
+	return nil
 }
 
 func (cache *CacheOrder) GetRecent(limit int) []order.Order {
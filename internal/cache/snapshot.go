@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"L0/internal/order"
+)
+
+// ErrSnapshotStale is returned by LoadSnapshot for a snapshot older than the
+// allowed age.
+var ErrSnapshotStale = errors.New("cache snapshot is stale")
+
+// LiveFunc returns the order_uids among ids of orders that are neither
+// deleted nor erased; (*order.OrderRepository).LiveIDs is one.
+type LiveFunc func(ctx context.Context, ids []string) ([]string, error)
+
+type snapshot struct {
+	SavedAt time.Time     `json:"saved_at"`
+	Orders  []order.Order `json:"orders"`
+}
+
+// SaveSnapshot writes the cached orders, most recent first, to path. The file
+// is replaced atomically so a crash never leaves a truncated snapshot, and is
+// readable by its owner only, as it holds personal data.
+func (cache *CacheOrder) SaveSnapshot(path string) (int, error) {
+	snap := snapshot{SavedAt: time.Now().UTC(), Orders: cache.GetRecent(cache.Size)}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, err
+	}
+	return len(snap.Orders), nil
+}
+
+// LoadSnapshot fills the cache from a snapshot written by SaveSnapshot no more
+// than maxAge ago and marks it warmed up. Orders deleted or erased since the
+// snapshot was taken, as live reports them, are left out. A missing file is
+// reported as fs.ErrNotExist.
+func (cache *CacheOrder) LoadSnapshot(ctx context.Context, path string, maxAge time.Duration, live LiveFunc) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return 0, fmt.Errorf("decode cache snapshot: %w", err)
+	}
+	if age := time.Since(snap.SavedAt); age > maxAge {
+		return 0, fmt.Errorf("%w: saved %s ago", ErrSnapshotStale, age.Round(time.Second))
+	}
+	ids := make([]string, len(snap.Orders))
+	for i, o := range snap.Orders {
+		ids[i] = o.OrderUID
+	}
+	liveIDs, err := live(ctx, ids)
+	if err != nil {
+		return 0, fmt.Errorf("check cache snapshot: %w", err)
+	}
+	keep := make(map[string]bool, len(liveIDs))
+	for _, id := range liveIDs {
+		keep[id] = true
+	}
+	// Set puts each order in front, so load oldest first to keep the order.
+	orders := make([]order.Order, 0, len(snap.Orders))
+	for i := len(snap.Orders) - 1; i >= 0; i-- {
+		if keep[snap.Orders[i].OrderUID] {
+			orders = append(orders, snap.Orders[i])
+		}
+	}
+	cache.Load(orders)
+	return len(orders), nil
+}
@@ -1,40 +1,175 @@
 package config
 
 import (
-	"github.com/joho/godotenv"
-	"github.com/kelseyhightower/envconfig"
+	"time"
 )
 
+// Every leaf field has an env tag naming its environment variable, an
+// optional default and a desc used for flags and the generated reference.
+
 type DbConf struct {
-	Host     string `envconfig:"DB_HOST" default:"localhost"`
-	Port     string `envconfig:"DB_PORT" default:"5432"`
-	User     string `envconfig:"DB_USER" default:"alan"`
-	Password string `envconfig:"DB_PASSWORD" default:"2005"`
-	DbName   string `envconfig:"DB_NAME" default:"orders_db"`
-	Retries  int    `envconfig:"DB_CONNECTION_RETRIES" default:"3"`
+	Host              string        `env:"DB_HOST" default:"localhost" desc:"Postgres host"`
+	Port              string        `env:"DB_PORT" default:"5432" desc:"Postgres port"`
+	User              string        `env:"DB_USER" default:"alan" desc:"Postgres user"`
+	Password          string        `env:"DB_PASSWORD" default:"2005" secret:"true" desc:"Postgres password"`
+	DbName            string        `env:"DB_NAME" default:"orders_db" desc:"Postgres database"`
+	Retries           int           `env:"DB_CONNECTION_RETRIES" default:"3" desc:"connection attempts on start"`
+	RetryBackoff      time.Duration `env:"DB_RETRY_BACKOFF" default:"1s" desc:"delay after the first failed connection attempt, doubled after each"`
+	DSN               string        `env:"PG_DSN" secret:"true" desc:"full connection URL or keyword/value string; overrides DB_HOST, DB_PORT, DB_USER, DB_PASSWORD, DB_NAME and DB_SSL*"`
+	MaxConns          int           `env:"DB_MAX_CONNS" default:"10" desc:"largest pool size"`
+	MinConns          int           `env:"DB_MIN_CONNS" default:"0" desc:"connections kept open when idle"`
+	MaxConnLifetime   time.Duration `env:"DB_MAX_CONN_LIFETIME" default:"1h" desc:"age after which a connection is replaced"`
+	MaxConnIdleTime   time.Duration `env:"DB_MAX_CONN_IDLE_TIME" default:"30m" desc:"idle time after which a connection is closed"`
+	HealthCheckPeriod time.Duration `env:"DB_HEALTH_CHECK_PERIOD" default:"1m" desc:"how often idle connections are checked"`
+	ConnectTimeout    time.Duration `env:"DB_CONNECT_TIMEOUT" default:"5s" desc:"bound of establishing one connection"`
+	StatementTimeout  time.Duration `env:"DB_STATEMENT_TIMEOUT" default:"30s" desc:"server-side statement_timeout, 0 disables"`
+	ApplicationName   string        `env:"DB_APPLICATION_NAME" default:"orders-service" desc:"application_name reported to Postgres"`
+	SSLMode           string        `env:"DB_SSLMODE" default:"prefer" desc:"disable, allow, prefer, require, verify-ca or verify-full"`
+	SSLRootCert       string        `env:"DB_SSLROOTCERT" desc:"CA certificate verifying the server"`
+	SSLCert           string        `env:"DB_SSLCERT" desc:"client certificate"`
+	SSLKey            string        `env:"DB_SSLKEY" desc:"client certificate key"`
+	MigrateOnStart    bool          `env:"DB_MIGRATE_ON_START" default:"true" desc:"apply pending migrations before serving"`
+	// Replicas share the credentials, TLS and pool settings of the primary.
+	ReplicaHosts         []string      `env:"DB_REPLICA_HOSTS" desc:"comma separated host or host:port of read replicas"`
+	ReplicaMaxLag        time.Duration `env:"DB_REPLICA_MAX_LAG" default:"10s" desc:"replication lag above which a replica stops serving reads"`
+	ReplicaCheckInterval time.Duration `env:"DB_REPLICA_CHECK_INTERVAL" default:"5s" desc:"how often replica lag is measured"`
+}
+
+// KafkaTLSConf enables TLS to the brokers. CAFile verifies the brokers;
+// CertFile and KeyFile authenticate the client.
+type KafkaTLSConf struct {
+	Enabled            bool   `env:"KAFKA_TLS_ENABLED" default:"false" desc:"connect to the brokers over TLS"`
+	CAFile             string `env:"KAFKA_TLS_CA_FILE" desc:"CA certificate verifying the brokers"`
+	CertFile           string `env:"KAFKA_TLS_CERT_FILE" desc:"client certificate"`
+	KeyFile            string `env:"KAFKA_TLS_KEY_FILE" desc:"client certificate key"`
+	InsecureSkipVerify bool   `env:"KAFKA_TLS_INSECURE_SKIP_VERIFY" default:"false" desc:"skip broker certificate verification (debugging only)"`
+}
+
+// KafkaSASLConf authenticates to the brokers. Mechanism is PLAIN,
+// SCRAM-SHA-256 or SCRAM-SHA-512; empty disables SASL.
+type KafkaSASLConf struct {
+	Mechanism string `env:"KAFKA_SASL_MECHANISM" desc:"PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512; empty disables SASL"`
+	Username  string `env:"KAFKA_SASL_USERNAME" desc:"SASL user"`
+	Password  string `env:"KAFKA_SASL_PASSWORD" secret:"true" desc:"SASL password"`
+}
+
+// SchemaRegistryConf points at a Confluent-compatible schema registry
+// holding the Avro schemas of the orders topic.
+type SchemaRegistryConf struct {
+	URL      string        `env:"SCHEMA_REGISTRY_URL" desc:"Confluent-compatible schema registry; required to read or publish Avro"`
+	Username string        `env:"SCHEMA_REGISTRY_USERNAME" desc:"basic auth user"`
+	Password string        `env:"SCHEMA_REGISTRY_PASSWORD" secret:"true" desc:"basic auth password"`
+	Timeout  time.Duration `env:"SCHEMA_REGISTRY_TIMEOUT" default:"5s" desc:"bound of each registry request"`
 }
 
 type KafkaConf struct {
-	Brokers   []string `envconfig:"KAFKA_BROKERS" default:"localhost:9092"`
-	Topic     string   `envconfig:"KAFKA_TOPIC" default:"orders"`
-	Partition int      `envconfig:"KAFKA_PARTITION" default:"0"`
-	GroupID   string   `envconfig:"KAFKA_GROUP_ID" default:"orders-consumer"`
-	Offset    int64    `envconfig:"KAFKA_OFFSET" default:"-1"`
+	Brokers         []string `env:"KAFKA_BROKERS" default:"localhost:9092" desc:"comma separated broker addresses"`
+	Topic           string   `env:"KAFKA_TOPIC" default:"orders" desc:"orders topic"`
+	GroupID         string   `env:"KAFKA_GROUP_ID" default:"orders-consumer" desc:"consumer group"`
+	Offset          int64    `env:"KAFKA_OFFSET" default:"-1" desc:"where a new group starts: -1 newest, -2 oldest"`
+	DeadLetterTopic string   `env:"KAFKA_DLQ_TOPIC" desc:"topic for messages that cannot be decoded or validated; empty disables dead-lettering"`
+	// MessageFormat is the codec of published orders. Consumed messages are
+	// decoded by their content-type header whatever it is.
+	MessageFormat string `env:"KAFKA_MESSAGE_FORMAT" default:"json" desc:"format of published orders: json, protobuf or avro"`
+	// RestartBackoffMin and RestartBackoffMax bound the delay before a failed
+	// consumer is restarted.
+	RestartBackoffMin time.Duration `env:"KAFKA_RESTART_BACKOFF_MIN" default:"1s" desc:"first delay before restarting a failed consumer"`
+	RestartBackoffMax time.Duration `env:"KAFKA_RESTART_BACKOFF_MAX" default:"30s" desc:"longest delay before restarting a failed consumer"`
+	TLS               KafkaTLSConf
+	SASL              KafkaSASLConf
+	SchemaRegistry    SchemaRegistryConf
+}
+
+// TracingConf configures OpenTelemetry trace export over OTLP/HTTP.
+type TracingConf struct {
+	Enabled     bool    `env:"TRACING_ENABLED" default:"false" desc:"export traces"`
+	Endpoint    string  `env:"TRACING_ENDPOINT" default:"localhost:4318" desc:"host:port or URL of the OTLP/HTTP collector"`
+	Insecure    bool    `env:"TRACING_INSECURE" default:"true" desc:"export over plain HTTP"`
+	ServiceName string  `env:"TRACING_SERVICE_NAME" default:"orders-service" desc:"service.name of exported spans"`
+	SampleRatio float64 `env:"TRACING_SAMPLE_RATIO" default:"1" desc:"share of new traces sampled, 0 to 1"`
+}
+
+// AuthConf configures authentication of the /orders API.
+type AuthConf struct {
+	Enabled     bool   `env:"AUTH_ENABLED" default:"true" desc:"require credentials for /orders; false is only allowed with APP_PROFILE=dev"`
+	APIKeys     string `env:"AUTH_API_KEYS" secret:"true" desc:"comma separated name:role:key entries"`
+	JWTSecret   string `env:"AUTH_JWT_SECRET" secret:"true" desc:"HS256 secret for JWTs"`
+	JWKSFile    string `env:"AUTH_JWKS_FILE" desc:"JWKS file with RS256 keys for JWTs"`
+	JWTIssuer   string `env:"AUTH_JWT_ISSUER" desc:"required iss of JWTs"`
+	JWTAudience string `env:"AUTH_JWT_AUDIENCE" desc:"required aud of JWTs"`
+	RoleClaim   string `env:"AUTH_JWT_ROLE_CLAIM" default:"role" desc:"JWT claim holding the role"`
+}
+
+// RateLimitConf sets per-client token buckets for the /orders API. A rate of
+// zero disables limiting for that class.
+type RateLimitConf struct {
+	IPRPS          float64  `env:"RATE_LIMIT_IP_RPS" default:"100" desc:"requests per second per client IP, checked before authentication, 0 for unlimited" reload:"true"`
+	IPBurst        int      `env:"RATE_LIMIT_IP_BURST" default:"200" desc:"request burst per client IP" reload:"true"`
+	ReadRPS        float64  `env:"RATE_LIMIT_READ_RPS" default:"50" desc:"reads per second per principal (per IP without auth), 0 for unlimited" reload:"true"`
+	ReadBurst      int      `env:"RATE_LIMIT_READ_BURST" default:"100" desc:"read burst per principal" reload:"true"`
+	WriteRPS       float64  `env:"RATE_LIMIT_WRITE_RPS" default:"5" desc:"writes per second per principal (per IP without auth), 0 for unlimited" reload:"true"`
+	WriteBurst     int      `env:"RATE_LIMIT_WRITE_BURST" default:"10" desc:"write burst per principal" reload:"true"`
+	TrustedProxies []string `env:"HTTP_TRUSTED_PROXIES" desc:"IPs or CIDRs allowed to set X-Forwarded-For"`
+}
+
+// PartitionConf drives the maintenance of the monthly partitions of the
+// orders tables.
+type PartitionConf struct {
+	Interval        time.Duration `env:"PARTITION_MAINTENANCE_INTERVAL" default:"1h" desc:"how often partitions are created and detached; 0 disables maintenance"`
+	MonthsAhead     int           `env:"PARTITION_MONTHS_AHEAD" default:"3" desc:"months after the current one whose partitions are created in advance"`
+	RetentionMonths int           `env:"ORDER_RETENTION_MONTHS" default:"0" desc:"months before the current one kept attached; older partitions move to PARTITION_ARCHIVE_SCHEMA; 0 keeps all"`
+	ArchiveSchema   string        `env:"PARTITION_ARCHIVE_SCHEMA" default:"orders_archive" desc:"schema receiving detached partitions, created when missing"`
+}
+
+// ArchiveConf configures archival of old orders to files outside Postgres.
+// An empty Storage disables it.
+type ArchiveConf struct {
+	Storage     string        `env:"ARCHIVE_STORAGE" desc:"local or s3; empty disables archival"`
+	AfterMonths int           `env:"ARCHIVE_AFTER_MONTHS" default:"12" desc:"months before the current one kept in Postgres; older orders are archived"`
+	Interval    time.Duration `env:"ARCHIVE_INTERVAL" default:"24h" desc:"how often orders are archived; 0 leaves it to the archive command"`
+	Format      string        `env:"ARCHIVE_FORMAT" default:"ndjson" desc:"ndjson (gzip-compressed) or parquet; files already written stay readable after a change"`
+	ChunkSize   int           `env:"ARCHIVE_CHUNK_SIZE" default:"1000" desc:"orders per archive file"`
+	Prefix      string        `env:"ARCHIVE_PREFIX" default:"orders" desc:"key prefix of archive files"`
+	Dir         string        `env:"ARCHIVE_DIR" default:"archive" desc:"directory of the local storage"`
+	S3Endpoint  string        `env:"ARCHIVE_S3_ENDPOINT" desc:"URL of the S3-compatible service, e.g. https://s3.eu-central-1.amazonaws.com"`
+	S3Bucket    string        `env:"ARCHIVE_S3_BUCKET" desc:"bucket of archive files"`
+	S3Region    string        `env:"ARCHIVE_S3_REGION" default:"us-east-1" desc:"region requests are signed for"`
+	S3AccessKey string        `env:"ARCHIVE_S3_ACCESS_KEY" desc:"access key ID"`
+	S3SecretKey string        `env:"ARCHIVE_S3_SECRET_KEY" secret:"true" desc:"secret access key"`
 }
 
+// Config is loaded by a Loader. Fields tagged secret may instead be read from
+// the file named by NAME_FILE and are redacted by String; fields tagged
+// reload are applied on SIGHUP without a restart.
 type Config struct {
-	DB        DbConf
-	Kafka     KafkaConf
-	CacheSize int    `envconfig:"CACHE_SIZE" default:"100"`
-	HTTPPort  string `envconfig:"HTTP_PORT" default:"8000"`
-	LogLevel  string `envconfig:"LOG_LEVEL" default:"debug"`
+	Profile             string `env:"APP_PROFILE" default:"prod" desc:"dev allows the built-in default credentials"`
+	DB                  DbConf
+	Kafka               KafkaConf
+	Tracing             TracingConf
+	Auth                AuthConf
+	RateLimit           RateLimitConf
+	Partition           PartitionConf
+	Archive             ArchiveConf
+	CacheSize           int           `env:"CACHE_SIZE" default:"100" desc:"orders kept in memory" reload:"true"`
+	HTTPPort            string        `env:"HTTP_PORT" default:"8000" desc:"HTTP listen port"`
+	HTTPTLSCertFile     string        `env:"HTTP_TLS_CERT_FILE" desc:"server certificate; with the key switches to HTTPS"`
+	HTTPTLSKeyFile      string        `env:"HTTP_TLS_KEY_FILE" desc:"server certificate key"`
+	LogLevel            string        `env:"LOG_LEVEL" default:"debug" desc:"debug, info, warn or error" reload:"true"`
+	LogFormat           string        `env:"LOG_FORMAT" default:"text" desc:"text or json"`
+	CacheSnapshotPath   string        `env:"CACHE_SNAPSHOT_PATH" desc:"file the cache is saved to on shutdown and restored from on start; empty disables snapshots"`
+	CacheSnapshotMaxAge time.Duration `env:"CACHE_SNAPSHOT_MAX_AGE" default:"10m" desc:"oldest snapshot restored on start"`
+	ShutdownTimeout     time.Duration `env:"SHUTDOWN_TIMEOUT" default:"15s" desc:"bound of the whole graceful shutdown"`
+	HealthTimeout       time.Duration `env:"HEALTH_CHECK_TIMEOUT" default:"2s" desc:"bound of each /livez and /readyz component check"`
+	// ConflictPolicy is what happens when an incoming order already exists:
+	// "skip" keeps the stored one, "overwrite" replaces it.
+	ConflictPolicy string `env:"ORDER_CONFLICT_POLICY" default:"skip" desc:"skip or overwrite an order that already exists"`
+	// StrictPayloads rejects JSON orders from Kafka and NDJSON imports that
+	// carry fields unknown to their payload version, instead of dropping them.
+	StrictPayloads bool `env:"ORDER_PAYLOAD_STRICT" default:"false" desc:"reject JSON orders with fields unknown to their payload version"`
 }
 
+// Load builds the configuration from defaults, the file named by CONFIG_FILE
+// and the environment, without flags.
 func Load() (Config, error) {
-	var cfg Config
-	_ = godotenv.Load()
-	if err := envconfig.Process("", &cfg); err != nil {
-		return Config{}, err
-	}
-	return cfg, nil
+	return NewLoader().Load()
 }
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// WriteDocs writes a Markdown reference of every setting, generated from the
+// struct tags.
+func WriteDocs(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# Configuration\n\n")
+	b.WriteString("Generated by `go run ./cmd config-docs`; do not edit.\n\n")
+	b.WriteString("Settings are layered, each overriding the ones before: the defaults below, ")
+	b.WriteString("a YAML or TOML file given by `-config` or `CONFIG_FILE`, the environment and command-line flags. ")
+	b.WriteString("In the file, nested tables are joined with underscores: `kafka: {tls: {ca_file: ...}}` sets `KAFKA_TLS_CA_FILE`. ")
+	b.WriteString("Secrets may be read from the file named by the variable with a `_FILE` suffix. ")
+	b.WriteString("Reloadable settings are applied on SIGHUP without a restart.\n\n")
+	b.WriteString("| Variable | Flag | Default | Description |\n")
+	b.WriteString("|----------|------|---------|-------------|\n")
+	_ = eachField(reflect.ValueOf(&Config{}).Elem(), func(f reflect.StructField, v reflect.Value) error {
+		name := f.Tag.Get("env")
+		def := f.Tag.Get("default")
+		if def != "" {
+			def = "`" + def + "`"
+		}
+		desc := f.Tag.Get("desc")
+		if isSecret(f) {
+			desc += "; secret, also `" + name + "_FILE`"
+		}
+		if f.Tag.Get("reload") == "true" {
+			desc += "; reloadable"
+		}
+		fmt.Fprintf(&b, "| `%s` | `-%s` | %s | %s |\n", name, FlagName(name), def, desc)
+		return nil
+	})
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,380 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Loader builds a Config from five layers, each overriding the ones before:
+// the defaults in the struct tags, a .env file, a YAML or TOML file, the
+// environment and command-line flags. Load may be called again to pick up
+// changes.
+type Loader struct {
+	fs     *flag.FlagSet
+	file   string
+	dotenv string
+	flags  map[string]string
+}
+
+// NewLoader registers -config and one flag per setting, named after its
+// variable: KAFKA_GROUP_ID becomes -kafka-group-id.
+func NewLoader() *Loader {
+	l := &Loader{fs: flag.NewFlagSet("config", flag.ContinueOnError), dotenv: ".env", flags: map[string]string{}}
+	l.fs.StringVar(&l.file, "config", "", "YAML or TOML config file (default $CONFIG_FILE)")
+	_ = eachField(reflect.ValueOf(&Config{}).Elem(), func(f reflect.StructField, v reflect.Value) error {
+		name := f.Tag.Get("env")
+		usage := f.Tag.Get("desc") + " (" + name
+		if def := f.Tag.Get("default"); def != "" {
+			usage += ", default " + def
+		}
+		l.fs.Var(&flagValue{name: name, set: l.flags, isBool: f.Type.Kind() == reflect.Bool}, FlagName(name), usage+")")
+		return nil
+	})
+	return l
+}
+
+// FlagName is the command-line flag of the variable name.
+func FlagName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+}
+
+// SetDotenv sets the .env file read below the config file; ".env" in the
+// working directory otherwise. It need not exist.
+func (l *Loader) SetDotenv(path string) {
+	l.dotenv = path
+}
+
+func (l *Loader) FlagSet() *flag.FlagSet {
+	return l.fs
+}
+
+// Parse reads flags up to the first non-flag argument and returns the rest.
+func (l *Loader) Parse(args []string) ([]string, error) {
+	if err := l.fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return l.fs.Args(), nil
+}
+
+// Load resolves every setting and validates the result, reporting all
+// problems at once.
+func (l *Loader) Load() (Config, error) {
+	values, err := l.values()
+	if err != nil {
+		return Config{}, err
+	}
+	var cfg Config
+	var errs []error
+	_ = eachField(reflect.ValueOf(&cfg).Elem(), func(f reflect.StructField, v reflect.Value) error {
+		name := f.Tag.Get("env")
+		if err := setValue(v, values[name]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		return nil
+	})
+	if len(errs) > 0 {
+		return Config{}, errors.Join(errs...)
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// values returns the raw value of every setting by variable name.
+func (l *Loader) values() (map[string]string, error) {
+	var fields []reflect.StructField
+	values := map[string]string{}
+	_ = eachField(reflect.ValueOf(&Config{}).Elem(), func(f reflect.StructField, v reflect.Value) error {
+		fields = append(fields, f)
+		values[f.Tag.Get("env")] = f.Tag.Get("default")
+		return nil
+	})
+
+	// .env is a layer of its own rather than part of the environment, so
+	// the config file still overrides it.
+	dotenv, err := readDotenv(l.dotenv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", l.dotenv, err)
+	}
+	if err := applyEnv(fields, values, dotenv); err != nil {
+		return nil, fmt.Errorf("%s: %w", l.dotenv, err)
+	}
+
+	path := l.file
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		path = dotenv["CONFIG_FILE"]
+	}
+	if path != "" {
+		file, err := readFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+		var errs []error
+		for _, key := range slices.Sorted(maps.Keys(file)) {
+			name := strings.ToUpper(key)
+			if _, ok := values[name]; !ok {
+				errs = append(errs, fmt.Errorf("config file %s: unknown setting %q", path, key))
+				continue
+			}
+			values[name] = file[key]
+		}
+		if err := errors.Join(errs...); err != nil {
+			return nil, err
+		}
+	}
+
+	environ := map[string]string{}
+	for _, kv := range os.Environ() {
+		if name, v, ok := strings.Cut(kv, "="); ok {
+			environ[name] = v
+		}
+	}
+	if err := applyEnv(fields, values, environ); err != nil {
+		return nil, err
+	}
+	for name, v := range l.flags {
+		values[name] = v
+	}
+	return values, nil
+}
+
+// applyEnv sets the values of fields found in env, by variable name or, for
+// secrets, through the file named by name_FILE.
+func applyEnv(fields []reflect.StructField, values, env map[string]string) error {
+	var errs []error
+	for _, f := range fields {
+		name := f.Tag.Get("env")
+		if v, ok := env[name]; ok {
+			values[name] = v
+		}
+		if !isSecret(f) {
+			continue
+		}
+		v, ok, err := secretFile(name, env)
+		if err != nil {
+			errs = append(errs, err)
+		} else if ok {
+			values[name] = v
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// readDotenv reads the variables of a .env file; a missing file has none.
+func readDotenv(path string) (map[string]string, error) {
+	if path == "" {
+		return map[string]string{}, nil
+	}
+	env, err := godotenv.Read(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	return env, err
+}
+
+// readFile decodes a YAML or TOML file into variable names in lower case.
+// Nested tables are joined with underscores, so kafka.tls.ca_file and
+// kafka_tls_ca_file name the same setting.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return nil, errors.New("want a .yaml, .yml or .toml file")
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]string{}
+	return out, flatten("", doc, out)
+}
+
+func flatten(prefix string, doc map[string]any, out map[string]string) error {
+	for k, v := range doc {
+		key := strings.ToLower(k)
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+		if m, ok := v.(map[string]any); ok {
+			if err := flatten(key, m, out); err != nil {
+				return err
+			}
+			continue
+		}
+		s, err := fileValue(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		out[key] = s
+	}
+	return nil
+}
+
+// fileValue renders a decoded value the way it would be written in the
+// environment; lists become comma separated.
+func fileValue(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := fileValue(item)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, s)
+		}
+		return strings.Join(parts, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", v)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setValue parses s into v. Strings are kept as given; for other types an
+// empty s leaves the zero value.
+func setValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.String {
+		v.SetString(s)
+		return nil
+	}
+	if s = strings.TrimSpace(s); s == "" {
+		return nil
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// eachField calls fn for every setting of the struct v, descending into
+// nested sections.
+func eachField(v reflect.Value, fn func(f reflect.StructField, v reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f, fv := t.Field(i), v.Field(i)
+		if f.Type.Kind() == reflect.Struct && f.Tag.Get("env") == "" {
+			if err := eachField(fv, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(f, fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flagValue records a flag by variable name; it is parsed with the other
+// layers in Load.
+type flagValue struct {
+	name   string
+	set    map[string]string
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	return ""
+}
+
+func (f *flagValue) Set(s string) error {
+	f.set[f.name] = s
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// Diff lists the variables whose values differ between a and b, split into
+// those applied on reload and those that need a restart.
+func Diff(a, b Config) (reloadable, restart []string) {
+	av, bv := reflect.ValueOf(&a).Elem(), reflect.ValueOf(&b).Elem()
+	var fields []reflect.StructField
+	var as, bs []reflect.Value
+	_ = eachField(av, func(f reflect.StructField, v reflect.Value) error {
+		fields, as = append(fields, f), append(as, v)
+		return nil
+	})
+	_ = eachField(bv, func(f reflect.StructField, v reflect.Value) error {
+		bs = append(bs, v)
+		return nil
+	})
+	for i, f := range fields {
+		if reflect.DeepEqual(as[i].Interface(), bs[i].Interface()) {
+			continue
+		}
+		if f.Tag.Get("reload") == "true" {
+			reloadable = append(reloadable, f.Tag.Get("env"))
+		} else {
+			restart = append(restart, f.Tag.Get("env"))
+		}
+	}
+	return reloadable, restart
+}
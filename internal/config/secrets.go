@@ -0,0 +1,77 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// ProfileDev allows the built-in default credentials.
+const ProfileDev = "dev"
+
+const redacted = "******"
+
+func isSecret(f reflect.StructField) bool {
+	return f.Tag.Get("secret") == "true" && f.Type.Kind() == reflect.String
+}
+
+// secretFile returns the contents of the file named by name_FILE in env,
+// without the trailing newline, and whether that variable is set.
+func secretFile(name string, env map[string]string) (string, bool, error) {
+	path, ok := env[name+"_FILE"]
+	if !ok || path == "" {
+		return "", false, nil
+	}
+	if _, set := env[name]; set {
+		return "", false, fmt.Errorf("both %s and %s_FILE are set", name, name)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// checkDefaults refuses secrets left at their built-in default outside the
+// dev profile.
+func checkDefaults(cfg Config) []error {
+	if cfg.Profile == ProfileDev {
+		return nil
+	}
+	var errs []error
+	_ = eachField(reflect.ValueOf(&cfg).Elem(), func(f reflect.StructField, v reflect.Value) error {
+		def := f.Tag.Get("default")
+		// PG_DSN replaces the password, so its default is never used.
+		if f.Tag.Get("env") == "DB_PASSWORD" && cfg.DB.DSN != "" {
+			return nil
+		}
+		if isSecret(f) && def != "" && v.String() == def {
+			errs = append(errs, fmt.Errorf("%s: the built-in default is only allowed with APP_PROFILE=%s", f.Tag.Get("env"), ProfileDev))
+		}
+		return nil
+	})
+	return errs
+}
+
+// Redacted returns a copy of c with every non-empty secret replaced, safe to
+// log or print.
+func (c Config) Redacted() Config {
+	_ = eachField(reflect.ValueOf(&c).Elem(), func(f reflect.StructField, v reflect.Value) error {
+		if isSecret(f) && v.String() != "" {
+			v.SetString(redacted)
+		}
+		return nil
+	})
+	return c
+}
+
+// String renders the redacted configuration as JSON.
+func (c Config) String() string {
+	b, err := json.Marshal(c.Redacted())
+	if err != nil {
+		return fmt.Sprintf("config: %v", err)
+	}
+	return string(b)
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	sslModes       = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+	saslMechanisms = []string{"PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512"}
+	messageFormats = []string{"json", "protobuf", "avro"}
+)
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	checkPort := func(name, port string) {
+		n, err := strconv.Atoi(port)
+		check(err == nil && n > 0 && n < 65536, "%s: %q is not a port", name, port)
+	}
+	checkPair := func(cert, key, certName, keyName string) {
+		check((cert == "") == (key == ""), "%s and %s must be set together", certName, keyName)
+	}
+
+	check(c.DB.Host != "", "DB_HOST: must be set")
+	checkPort("DB_PORT", c.DB.Port)
+	check(c.DB.DbName != "", "DB_NAME: must be set")
+	check(c.DB.Retries > 0, "DB_CONNECTION_RETRIES: must be positive, got %d", c.DB.Retries)
+	check(c.DB.RetryBackoff > 0, "DB_RETRY_BACKOFF: must be positive")
+	check(c.DB.MaxConns > 0, "DB_MAX_CONNS: must be positive, got %d", c.DB.MaxConns)
+	check(c.DB.MinConns >= 0 && c.DB.MinConns <= c.DB.MaxConns, "DB_MIN_CONNS: must be between 0 and DB_MAX_CONNS, got %d", c.DB.MinConns)
+	check(c.DB.MaxConnLifetime > 0, "DB_MAX_CONN_LIFETIME: must be positive")
+	check(c.DB.MaxConnIdleTime > 0, "DB_MAX_CONN_IDLE_TIME: must be positive")
+	check(c.DB.HealthCheckPeriod > 0, "DB_HEALTH_CHECK_PERIOD: must be positive")
+	check(c.DB.ConnectTimeout > 0, "DB_CONNECT_TIMEOUT: must be positive")
+	check(c.DB.StatementTimeout >= 0, "DB_STATEMENT_TIMEOUT: must not be negative")
+	check(slices.Contains(sslModes, c.DB.SSLMode), "DB_SSLMODE: %q is not one of %s", c.DB.SSLMode, strings.Join(sslModes, ", "))
+	checkPair(c.DB.SSLCert, c.DB.SSLKey, "DB_SSLCERT", "DB_SSLKEY")
+	if len(c.DB.ReplicaHosts) > 0 {
+		check(c.DB.ReplicaMaxLag > 0, "DB_REPLICA_MAX_LAG: must be positive")
+		check(c.DB.ReplicaCheckInterval > 0, "DB_REPLICA_CHECK_INTERVAL: must be positive")
+	}
+
+	check(len(c.Kafka.Brokers) > 0, "KAFKA_BROKERS: must list at least one broker")
+	check(c.Kafka.Topic != "", "KAFKA_TOPIC: must be set")
+	check(c.Kafka.GroupID != "", "KAFKA_GROUP_ID: must be set")
+	check(c.Kafka.Offset == -1 || c.Kafka.Offset == -2, "KAFKA_OFFSET: must be -1 (newest) or -2 (oldest), got %d", c.Kafka.Offset)
+	check(c.Kafka.DeadLetterTopic != c.Kafka.Topic, "KAFKA_DLQ_TOPIC: must differ from KAFKA_TOPIC")
+	check(c.Kafka.RestartBackoffMin > 0, "KAFKA_RESTART_BACKOFF_MIN: must be positive")
+	check(c.Kafka.RestartBackoffMax >= c.Kafka.RestartBackoffMin, "KAFKA_RESTART_BACKOFF_MAX: must not be below KAFKA_RESTART_BACKOFF_MIN")
+	checkPair(c.Kafka.TLS.CertFile, c.Kafka.TLS.KeyFile, "KAFKA_TLS_CERT_FILE", "KAFKA_TLS_KEY_FILE")
+	if mech := c.Kafka.SASL.Mechanism; mech != "" {
+		check(slices.Contains(saslMechanisms, strings.ToUpper(mech)), "KAFKA_SASL_MECHANISM: %q is not one of %s", mech, strings.Join(saslMechanisms, ", "))
+		check(c.Kafka.SASL.Username != "", "KAFKA_SASL_USERNAME: must be set with KAFKA_SASL_MECHANISM")
+	}
+	check(slices.Contains(messageFormats, c.Kafka.MessageFormat), "KAFKA_MESSAGE_FORMAT: %q is not one of %s", c.Kafka.MessageFormat, strings.Join(messageFormats, ", "))
+	if r := c.Kafka.SchemaRegistry; r.URL != "" {
+		u, err := url.Parse(r.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "SCHEMA_REGISTRY_URL: %q is not an http(s) URL", r.URL)
+		check(r.Timeout > 0, "SCHEMA_REGISTRY_TIMEOUT: must be positive")
+	} else {
+		check(c.Kafka.MessageFormat != "avro", "SCHEMA_REGISTRY_URL: must be set when KAFKA_MESSAGE_FORMAT is avro")
+	}
+
+	if c.Tracing.Enabled {
+		check(c.Tracing.Endpoint != "", "TRACING_ENDPOINT: must be set when tracing is enabled")
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "TRACING_SAMPLE_RATIO: must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+
+	if c.Auth.Enabled {
+		check(c.Auth.RoleClaim != "", "AUTH_JWT_ROLE_CLAIM: must be set when auth is enabled")
+	} else {
+		check(c.Profile == ProfileDev, "AUTH_ENABLED: may only be false with APP_PROFILE=%s", ProfileDev)
+	}
+
+	check(c.Partition.Interval >= 0, "PARTITION_MAINTENANCE_INTERVAL: must not be negative")
+	check(c.Partition.MonthsAhead >= 1, "PARTITION_MONTHS_AHEAD: must be at least 1, got %d", c.Partition.MonthsAhead)
+	check(c.Partition.RetentionMonths >= 0, "ORDER_RETENTION_MONTHS: must not be negative, got %d", c.Partition.RetentionMonths)
+	check(c.Partition.RetentionMonths == 0 || c.Partition.ArchiveSchema != "", "PARTITION_ARCHIVE_SCHEMA: must be set with ORDER_RETENTION_MONTHS")
+
+	if a := c.Archive; a.Storage != "" {
+		check(a.Storage == "local" || a.Storage == "s3", "ARCHIVE_STORAGE: %q is not local or s3", a.Storage)
+		check(a.Format == "ndjson" || a.Format == "parquet", "ARCHIVE_FORMAT: %q is not ndjson or parquet", a.Format)
+		check(a.AfterMonths >= 1, "ARCHIVE_AFTER_MONTHS: must be at least 1, got %d", a.AfterMonths)
+		check(a.Interval >= 0, "ARCHIVE_INTERVAL: must not be negative")
+		check(a.ChunkSize > 0, "ARCHIVE_CHUNK_SIZE: must be positive, got %d", a.ChunkSize)
+		// Detached partitions are out of reach of the archiver, so orders
+		// must be archived before retention detaches their month.
+		check(c.Partition.RetentionMonths == 0 || a.AfterMonths < c.Partition.RetentionMonths,
+			"ARCHIVE_AFTER_MONTHS: must be less than ORDER_RETENTION_MONTHS (%d), got %d", c.Partition.RetentionMonths, a.AfterMonths)
+		if a.Storage == "local" {
+			check(a.Dir != "", "ARCHIVE_DIR: must be set for local storage")
+		}
+		if a.Storage == "s3" {
+			u, err := url.Parse(a.S3Endpoint)
+			check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "ARCHIVE_S3_ENDPOINT: %q is not an http(s) URL", a.S3Endpoint)
+			check(a.S3Bucket != "", "ARCHIVE_S3_BUCKET: must be set for s3 storage")
+			check(a.S3Region != "", "ARCHIVE_S3_REGION: must be set for s3 storage")
+			check(a.S3AccessKey != "" && a.S3SecretKey != "", "ARCHIVE_S3_ACCESS_KEY, ARCHIVE_S3_SECRET_KEY: must be set for s3 storage")
+		}
+	}
+
+	check(c.RateLimit.IPRPS >= 0, "RATE_LIMIT_IP_RPS: must not be negative")
+	check(c.RateLimit.ReadRPS >= 0, "RATE_LIMIT_READ_RPS: must not be negative")
+	check(c.RateLimit.WriteRPS >= 0, "RATE_LIMIT_WRITE_RPS: must not be negative")
+	check(c.RateLimit.IPRPS == 0 || c.RateLimit.IPBurst > 0, "RATE_LIMIT_IP_BURST: must be positive")
+	check(c.RateLimit.ReadRPS == 0 || c.RateLimit.ReadBurst > 0, "RATE_LIMIT_READ_BURST: must be positive")
+	check(c.RateLimit.WriteRPS == 0 || c.RateLimit.WriteBurst > 0, "RATE_LIMIT_WRITE_BURST: must be positive")
+	for _, p := range c.RateLimit.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(p)
+		check(net.ParseIP(p) != nil || cidrErr == nil, "HTTP_TRUSTED_PROXIES: %q is not an IP or CIDR", p)
+	}
+
+	check(c.CacheSize > 0, "CACHE_SIZE: must be positive, got %d", c.CacheSize)
+	checkPort("HTTP_PORT", c.HTTPPort)
+	checkPair(c.HTTPTLSCertFile, c.HTTPTLSKeyFile, "HTTP_TLS_CERT_FILE", "HTTP_TLS_KEY_FILE")
+	var lvl slog.Level
+	check(lvl.UnmarshalText([]byte(c.LogLevel)) == nil, "LOG_LEVEL: %q is not debug, info, warn or error", c.LogLevel)
+	check(c.LogFormat == "text" || c.LogFormat == "json", "LOG_FORMAT: %q is not text or json", c.LogFormat)
+	check(c.CacheSnapshotMaxAge >= 0, "CACHE_SNAPSHOT_MAX_AGE: must not be negative")
+	check(c.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT: must be positive")
+	check(c.HealthTimeout > 0, "HEALTH_CHECK_TIMEOUT: must be positive")
+	check(c.ConflictPolicy == "skip" || c.ConflictPolicy == "overwrite", "ORDER_CONFLICT_POLICY: %q is not skip or overwrite", c.ConflictPolicy)
+
+	errs = append(errs, checkDefaults(c)...)
+	return errors.Join(errs...)
+}
@@ -2,10 +2,16 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
 	"time"
 
 	"L0/internal/config"
+	"L0/internal/tracing"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -17,22 +23,115 @@ type Client interface {
 	Query(ctx context.Context, sql string, arguments ...any) (pgx.Rows, error)
 	QueryRow(ctx context.Context, sql string, arguments ...any) pgx.Row
 	Begin(ctx context.Context) (pgx.Tx, error)
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
 }
 
-func NewClient(ctx context.Context, cfg config.DbConf) (*pgxpool.Pool, error) {
-	dsn := fmt.Sprintf("postgresql://%s:%s@%s:%s/%s", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DbName)
-	attempts := cfg.Retries
-	var lastErr error
-	for i := 1; i <= attempts; i++ {
-		pool, err := pgxpool.New(ctx, dsn)
+// DSN builds the connection URL for cfg, including the sslmode and
+// certificate parameters.
+func DSN(cfg config.DbConf) string {
+	q := url.Values{}
+	if cfg.SSLMode != "" {
+		q.Set("sslmode", cfg.SSLMode)
+	}
+	if cfg.SSLRootCert != "" {
+		q.Set("sslrootcert", cfg.SSLRootCert)
+	}
+	if cfg.SSLCert != "" {
+		q.Set("sslcert", cfg.SSLCert)
+	}
+	if cfg.SSLKey != "" {
+		q.Set("sslkey", cfg.SSLKey)
+	}
+	u := url.URL{
+		Scheme:   "postgresql",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, cfg.Port),
+		Path:     "/" + cfg.DbName,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+// maxRetryBackoff caps the doubling delay between connection attempts.
+const maxRetryBackoff = 30 * time.Second
+
+// PoolConfig builds the pool configuration: the connection comes from
+// cfg.DSN when set and from the DB_* settings otherwise, and the pool
+// settings apply either way. application_name and statement_timeout given in
+// the DSN win over the settings.
+func PoolConfig(cfg config.DbConf) (*pgxpool.Config, error) {
+	dsn := cfg.DSN
+	if dsn == "" {
+		dsn = DSN(cfg)
+	}
+	poolCfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		// The error may echo the DSN, password included.
+		return nil, errors.New("invalid postgres connection string")
+	}
+	poolCfg.MaxConns = int32(cfg.MaxConns)
+	poolCfg.MinConns = int32(cfg.MinConns)
+	poolCfg.MaxConnLifetime = cfg.MaxConnLifetime
+	poolCfg.MaxConnIdleTime = cfg.MaxConnIdleTime
+	poolCfg.HealthCheckPeriod = cfg.HealthCheckPeriod
+	poolCfg.ConnConfig.ConnectTimeout = cfg.ConnectTimeout
+	params := poolCfg.ConnConfig.RuntimeParams
+	if _, ok := params["application_name"]; !ok && cfg.ApplicationName != "" {
+		params["application_name"] = cfg.ApplicationName
+	}
+	if _, ok := params["statement_timeout"]; !ok && cfg.StatementTimeout > 0 {
+		params["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+	poolCfg.ConnConfig.Tracer = tracing.QueryTracer{}
+	return poolCfg, nil
+}
+
+// NewClient opens the pool and pings it, retrying cfg.Retries times with a
+// delay starting at cfg.RetryBackoff and doubling up to 30s, so an
+// unreachable database fails start-up rather than the first query. A nil
+// logger falls back to slog.Default().
+func NewClient(ctx context.Context, cfg config.DbConf, logger *slog.Logger) (*pgxpool.Pool, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	poolCfg, err := PoolConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	// The pool connects lazily; Ping makes the first connection.
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := max(cfg.Retries, 1)
+	backoff := cfg.RetryBackoff
+	for i := 1; ; i++ {
+		err = ping(ctx, pool, cfg.ConnectTimeout)
 		if err == nil {
 			return pool, nil
 		}
-		lastErr = err
-		fmt.Printf("failed to connect postgres (attempt %d/%d): %v\n", i, attempts, err)
-		if i < attempts {
-			time.Sleep(time.Duration(i) * time.Second)
+		logger.WarnContext(ctx, "connect postgres failed", "attempt", i, "attempts", attempts, "error", err)
+		if i == attempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			pool.Close()
+			return nil, ctx.Err()
+		case <-time.After(backoff):
 		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+	pool.Close()
+	return nil, fmt.Errorf("connect postgres after %d attempts: %w", attempts, err)
+}
+
+func ping(ctx context.Context, pool *pgxpool.Pool, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
-	return nil, lastErr
+	return pool.Ping(ctx)
 }
@@ -0,0 +1,311 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"L0/internal/config"
+	"L0/internal/health"
+	"L0/internal/metrics"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lagQuery measures how far a replica is behind. A replica that streams WAL
+// and has replayed everything it received reports no lag even if the primary
+// has been idle. Without a streaming WAL receiver nothing new arrives, so the
+// lag is the time since the last replayed transaction, and infinite if there
+// was none. The status of the receiver is only visible with
+// pg_read_all_stats; without it, only a missing receiver is noticed.
+const lagQuery = `
+	SELECT CASE
+		WHEN NOT pg_is_in_recovery() THEN 0
+		WHEN NOT EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE COALESCE(status, 'streaming') = 'streaming')
+			THEN COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 'Infinity')
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END::float8`
+
+type replica struct {
+	name   string
+	client Client
+
+	healthy atomic.Bool
+	mu      sync.Mutex
+	err     error
+}
+
+// Cluster is a primary and optional read replicas. Reads go to healthy
+// replicas in turn and fall back to the primary; writes always use the
+// primary.
+type Cluster struct {
+	primary  Client
+	replicas []*replica
+	maxLag   time.Duration
+	next     atomic.Uint64
+	closers  []func()
+}
+
+// NewCluster creates a cluster of primary alone. Replicas whose lag exceeds
+// maxLag stop serving reads until they catch up.
+func NewCluster(primary Client, maxLag time.Duration) *Cluster {
+	return &Cluster{primary: primary, maxLag: maxLag}
+}
+
+// AddReplica adds a read replica. It serves reads after CheckReplicas has
+// found it healthy.
+func (c *Cluster) AddReplica(name string, client Client) {
+	c.replicas = append(c.replicas, &replica{name: name, client: client, err: errors.New("lag not checked yet")})
+}
+
+// Open connects to the primary with NewClient and opens a pool per replica in
+// cfg.ReplicaHosts. Unreachable replicas do not fail start-up; they are
+// skipped until the lag check finds them healthy.
+func Open(ctx context.Context, cfg config.DbConf, logger *slog.Logger) (*Cluster, *pgxpool.Pool, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	primary, err := NewClient(ctx, cfg, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := NewCluster(primary, cfg.ReplicaMaxLag)
+	c.closers = append(c.closers, primary.Close)
+	for _, hostport := range cfg.ReplicaHosts {
+		poolCfg, err := replicaConfig(primary.Config(), hostport)
+		if err != nil {
+			c.Close()
+			return nil, nil, fmt.Errorf("replica %s: %w", hostport, err)
+		}
+		pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+		if err != nil {
+			c.Close()
+			return nil, nil, fmt.Errorf("replica %s: %w", hostport, err)
+		}
+		c.closers = append(c.closers, pool.Close)
+		c.AddReplica(hostport, pool)
+	}
+	c.CheckReplicas(ctx)
+	for _, r := range c.replicas {
+		if err := r.state(); err != nil {
+			logger.WarnContext(ctx, "read replica unavailable, reads use the primary", "replica", r.name, "error", err)
+		}
+	}
+	return c, primary, nil
+}
+
+// replicaConfig copies the primary's pool configuration with another host, so
+// credentials, TLS and pool settings are shared.
+func replicaConfig(primary *pgxpool.Config, hostport string) (*pgxpool.Config, error) {
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, portStr = hostport, ""
+	}
+	port := primary.ConnConfig.Port
+	if portStr != "" {
+		p, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", portStr)
+		}
+		port = uint16(p)
+	}
+	if host == "" {
+		return nil, errors.New("empty host")
+	}
+
+	cfg := primary.Copy()
+	cc := cfg.ConnConfig
+	cc.Host, cc.Port = host, port
+	if cc.TLSConfig != nil {
+		cc.TLSConfig = cc.TLSConfig.Clone()
+		cc.TLSConfig.ServerName = host
+	}
+	fallbacks := cc.Fallbacks
+	cc.Fallbacks = nil
+	for _, fb := range fallbacks {
+		f := *fb
+		f.Host, f.Port = host, port
+		if f.TLSConfig != nil {
+			f.TLSConfig = f.TLSConfig.Clone()
+			f.TLSConfig.ServerName = host
+		}
+		cc.Fallbacks = append(cc.Fallbacks, &f)
+	}
+	return cfg, nil
+}
+
+// Primary is the client for writes and for reads that must see them.
+func (c *Cluster) Primary() Client {
+	return c.primary
+}
+
+// Read runs fn on a healthy replica, taking turns, and runs it again on the
+// primary if that fails, including when fn reports not found, since the row
+// may not have replicated yet. Without healthy replicas, or when ctx requires
+// the primary, fn runs on the primary only. fn must be safe to repeat.
+func (c *Cluster) Read(ctx context.Context, fn func(Client) error) error {
+	if r := c.pick(ctx); r != nil {
+		err := fn(r.client)
+		if err == nil || ctx.Err() != nil {
+			metrics.DBReads.WithLabelValues("replica").Inc()
+			return err
+		}
+		metrics.DBReads.WithLabelValues("fallback").Inc()
+	} else {
+		metrics.DBReads.WithLabelValues("primary").Inc()
+	}
+	return fn(c.primary)
+}
+
+// ReadClient returns a healthy replica, taking turns, or the primary under
+// the same conditions as Read. It is for reads that cannot be repeated on
+// the primary, such as one streamed to a caller as it goes.
+func (c *Cluster) ReadClient(ctx context.Context) Client {
+	if r := c.pick(ctx); r != nil {
+		metrics.DBReads.WithLabelValues("replica").Inc()
+		return r.client
+	}
+	metrics.DBReads.WithLabelValues("primary").Inc()
+	return c.primary
+}
+
+func (c *Cluster) pick(ctx context.Context) *replica {
+	if len(c.replicas) == 0 || primaryRequired(ctx) {
+		return nil
+	}
+	start := c.next.Add(1)
+	for i := range c.replicas {
+		r := c.replicas[(int(start)+i)%len(c.replicas)]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+// CheckReplicas measures the lag of every replica and updates which of them
+// serve reads.
+func (c *Cluster) CheckReplicas(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, r := range c.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.check(ctx, r)
+		}()
+	}
+	wg.Wait()
+}
+
+func (c *Cluster) check(ctx context.Context, r *replica) {
+	var seconds float64
+	err := r.client.QueryRow(ctx, lagQuery).Scan(&seconds)
+	if err == nil {
+		metrics.DBReplicaLag.WithLabelValues(r.name).Set(seconds)
+		// Compared as seconds: an infinite lag has no Duration.
+		switch {
+		case math.IsInf(seconds, 1):
+			err = errors.New("WAL receiver is not streaming and nothing has been replayed")
+		case seconds > c.maxLag.Seconds():
+			lag := time.Duration(seconds * float64(time.Second))
+			err = fmt.Errorf("lag %s exceeds %s", lag.Round(time.Millisecond), c.maxLag)
+		}
+	}
+	r.mu.Lock()
+	r.err = err
+	r.mu.Unlock()
+	r.healthy.Store(err == nil)
+}
+
+func (r *replica) state() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Monitor runs CheckReplicas every interval until ctx is done.
+func (c *Cluster) Monitor(ctx context.Context, interval time.Duration) {
+	if len(c.replicas) == 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			c.CheckReplicas(ctx)
+		}
+	}
+}
+
+// Replicas names the replicas in the order they were added.
+func (c *Cluster) Replicas() []string {
+	names := make([]string, len(c.replicas))
+	for i, r := range c.replicas {
+		names[i] = r.name
+	}
+	return names
+}
+
+// ReplicaCheck reports the last lag check of the named replica. It does not
+// query the replica, so probes stay cheap.
+func (c *Cluster) ReplicaCheck(name string) health.CheckFunc {
+	return func(ctx context.Context) error {
+		for _, r := range c.replicas {
+			if r.name == name {
+				return r.state()
+			}
+		}
+		return fmt.Errorf("unknown replica %q", name)
+	}
+}
+
+// Close closes the pools opened by Open.
+func (c *Cluster) Close() {
+	for _, closeFn := range c.closers {
+		closeFn()
+	}
+}
+
+type sessionKey struct{}
+type primaryKey struct{}
+
+type session struct {
+	wrote atomic.Bool
+}
+
+// WithSession returns ctx that remembers writes made with it, so reads after
+// a write in the same request go to the primary and see it.
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+// MarkWritten records a write in the session of ctx, if any.
+func MarkWritten(ctx context.Context) {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		s.wrote.Store(true)
+	}
+}
+
+// WithPrimary returns ctx whose reads always use the primary.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func primaryRequired(ctx context.Context) bool {
+	if forced, _ := ctx.Value(primaryKey{}).(bool); forced {
+		return true
+	}
+	s, ok := ctx.Value(sessionKey{}).(*session)
+	return ok && s.wrote.Load()
+}
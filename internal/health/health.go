@@ -0,0 +1,148 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+// CheckFunc reports a component as down by returning an error.
+type CheckFunc func(ctx context.Context) error
+
+type Component struct {
+	Status    Status  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+	// Optional components are reported but do not make the report down.
+	Optional bool `json:"optional,omitempty"`
+}
+
+type Report struct {
+	Status     Status               `json:"status"`
+	Components map[string]Component `json:"components"`
+}
+
+// Checker runs a set of named checks concurrently, each bounded by timeout.
+type Checker struct {
+	mu      sync.RWMutex
+	timeout time.Duration
+	names   []string
+	checks  map[string]CheckFunc
+	// optional names checks whose failure does not fail the report.
+	optional map[string]bool
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout, checks: make(map[string]CheckFunc), optional: make(map[string]bool)}
+}
+
+// Add registers a check; a later check with the same name replaces it.
+func (c *Checker) Add(name string, check CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+	delete(c.optional, name)
+}
+
+// AddOptional registers a check that is reported but, when down, leaves the
+// report up, e.g. a read replica the service can do without.
+func (c *Checker) AddOptional(name string, check CheckFunc) {
+	c.Add(name, check)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.optional[name] = true
+}
+
+// Run executes every check. The report is down if any required component is
+// down.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	names := append([]string(nil), c.names...)
+	checks := make([]CheckFunc, len(names))
+	optional := make([]bool, len(names))
+	for i, n := range names {
+		checks[i], optional[i] = c.checks[n], c.optional[n]
+	}
+	c.mu.RUnlock()
+
+	results := make([]Component, len(names))
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = c.runOne(ctx, checks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Components: make(map[string]Component, len(names))}
+	for i, n := range names {
+		results[i].Optional = optional[i]
+		report.Components[n] = results[i]
+		if results[i].Status == StatusDown && !optional[i] {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+func (c *Checker) runOne(ctx context.Context, check CheckFunc) Component {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := check(ctx)
+	res := Component{Status: StatusUp, LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		res.Status = StatusDown
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// Heartbeat records when a background loop last made progress.
+type Heartbeat struct {
+	last atomic.Int64
+}
+
+func (h *Heartbeat) Beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+func (h *Heartbeat) Last() time.Time {
+	ns := h.last.Load()
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// Check fails when the last beat is older than maxAge or there was none.
+func (h *Heartbeat) Check(maxAge time.Duration) CheckFunc {
+	return func(ctx context.Context) error {
+		last := h.Last()
+		if last.IsZero() {
+			return errors.New("no heartbeat yet")
+		}
+		if age := time.Since(last); age > maxAge {
+			return fmt.Errorf("last heartbeat %s ago", age.Round(time.Millisecond))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,143 @@
+package kafka
+
+import (
+	"context"
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"L0/internal/order"
+
+	"github.com/hamba/avro/v2"
+)
+
+// OrderSchema is the Avro schema orders are published with. Changes must
+// stay compatible under the compatibility level of the subject, or
+// publishing fails.
+//
+//go:embed order.avsc
+var OrderSchema string
+
+// ErrIncompatibleSchema is returned when the registry rejects OrderSchema
+// for the subject.
+var ErrIncompatibleSchema = errors.New("schema incompatible with the registered versions")
+
+// avroAPI maps Avro fields by the json tags of the order model.
+var avroAPI = avro.Config{TagKey: "json"}.Freeze()
+
+// AvroCodec encodes orders with OrderSchema in the Confluent wire format.
+// Before the first publish it checks OrderSchema against the subject and
+// registers it. Messages are decoded with the schema of the id they carry,
+// resolved to OrderSchema.
+type AvroCodec struct {
+	registry *Registry
+	subject  string
+	schema   avro.Schema
+
+	mu sync.Mutex
+	// id is the registered id of OrderSchema, 0 until the first publish.
+	id int
+	// readers caches the schemas decoding each writer schema id.
+	readers map[int]avro.Schema
+}
+
+func NewAvroCodec(registry *Registry, subject string) (*AvroCodec, error) {
+	schema, err := avro.Parse(OrderSchema)
+	if err != nil {
+		return nil, fmt.Errorf("parse order schema: %w", err)
+	}
+	return &AvroCodec{registry: registry, subject: subject, schema: schema, readers: map[int]avro.Schema{}}, nil
+}
+
+func (c *AvroCodec) ContentType() string { return ContentTypeAvro }
+
+func (c *AvroCodec) Encode(ctx context.Context, o order.Order) ([]byte, error) {
+	id, err := c.register(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := avroAPI.Marshal(c.schema, o)
+	if err != nil {
+		return nil, err
+	}
+	msg := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(msg[1:], uint32(id))
+	return append(msg, data...), nil
+}
+
+// register checks OrderSchema against the subject and registers it once.
+// A failed attempt is retried on the next publish.
+func (c *AvroCodec) register(ctx context.Context) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.id != 0 {
+		return c.id, nil
+	}
+	schema := c.schema.String()
+	ok, err := c.registry.Compatible(ctx, c.subject, schema)
+	if err != nil {
+		return 0, fmt.Errorf("check schema compatibility: %w", err)
+	}
+	if !ok {
+		return 0, fmt.Errorf("subject %s: %w", c.subject, ErrIncompatibleSchema)
+	}
+	id, err := c.registry.Register(ctx, c.subject, schema)
+	if err != nil {
+		return 0, fmt.Errorf("register schema: %w", err)
+	}
+	c.id = id
+	return id, nil
+}
+
+func (c *AvroCodec) Decode(ctx context.Context, data []byte) (order.Order, error) {
+	if len(data) < 5 || data[0] != 0 {
+		return order.Order{}, errors.New("not in the Confluent wire format")
+	}
+	schema, err := c.reader(ctx, int(binary.BigEndian.Uint32(data[1:5])))
+	if err != nil {
+		return order.Order{}, err
+	}
+	var o order.Order
+	if err := avroAPI.Unmarshal(schema, data[5:], &o); err != nil {
+		return order.Order{}, err
+	}
+	if o.Products == nil {
+		o.Products = []order.Product{}
+	}
+	// Resolution to OrderSchema makes every message the current version.
+	o.PayloadVersion = order.CurrentPayloadVersion
+	return o, nil
+}
+
+// reader returns the schema that reads data written with schema id into
+// OrderSchema.
+func (c *AvroCodec) reader(ctx context.Context, id int) (avro.Schema, error) {
+	c.mu.Lock()
+	schema, ok := c.readers[id]
+	c.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+	text, err := c.registry.Schema(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("schema %d: %w", id, err)
+	}
+	// A cache of its own keeps the names of the writer schema from
+	// replacing those of OrderSchema in the default cache.
+	writer, err := avro.ParseWithCache(text, "", &avro.SchemaCache{})
+	if err != nil {
+		return nil, fmt.Errorf("parse schema %d: %w", id, err)
+	}
+	schema = c.schema
+	if writer.Fingerprint() != c.schema.Fingerprint() {
+		if schema, err = avro.NewSchemaCompatibility().Resolve(c.schema, writer); err != nil {
+			return nil, fmt.Errorf("schema %d cannot be read as an order: %w", id, err)
+		}
+	}
+	c.mu.Lock()
+	c.readers[id] = schema
+	c.mu.Unlock()
+	return schema, nil
+}
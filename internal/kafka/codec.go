@@ -0,0 +1,141 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+
+	"L0/internal/config"
+	"L0/internal/order"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ContentTypeHeader names the message header that tells the codec of the
+// value. Messages without it are JSON, as published before codecs existed.
+const ContentTypeHeader = "content-type"
+
+// Content types of the codecs.
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	// ContentTypeAvro is Avro binary in the Confluent wire format: a zero
+	// byte and the big-endian schema id before the encoded order.
+	ContentTypeAvro = "application/vnd.confluent.avro"
+)
+
+// Codec encodes orders in one message format.
+type Codec interface {
+	ContentType() string
+	Encode(ctx context.Context, o order.Order) ([]byte, error)
+	Decode(ctx context.Context, data []byte) (order.Order, error)
+}
+
+// Codecs decodes messages with the codec named by their content-type header
+// and encodes published orders with the configured one.
+type Codecs struct {
+	writer Codec
+	byType map[string]Codec
+}
+
+// DefaultCodecs publishes JSON and reads JSON and Protobuf.
+func DefaultCodecs() *Codecs {
+	return newCodecs(jsonCodec{}, jsonCodec{}, protobufCodec{})
+}
+
+// NewCodecs publishes in KAFKA_MESSAGE_FORMAT. Avro is read and written
+// only when a schema registry is configured; its schemas live under the
+// subject <topic>-value. With strict, JSON messages with fields unknown to
+// their payload version fail to decode.
+func NewCodecs(cfg config.KafkaConf, strict bool) (*Codecs, error) {
+	codecs := []Codec{jsonCodec{strict: strict}, protobufCodec{}}
+	var avro Codec
+	if cfg.SchemaRegistry.URL != "" {
+		registry, err := NewRegistry(cfg.SchemaRegistry)
+		if err != nil {
+			return nil, err
+		}
+		if avro, err = NewAvroCodec(registry, cfg.Topic+"-value"); err != nil {
+			return nil, err
+		}
+		codecs = append(codecs, avro)
+	}
+	var writer Codec
+	switch cfg.MessageFormat {
+	case "", "json":
+		writer = codecs[0]
+	case "protobuf":
+		writer = codecs[1]
+	case "avro":
+		if avro == nil {
+			return nil, errors.New("message format avro needs SCHEMA_REGISTRY_URL")
+		}
+		writer = avro
+	default:
+		return nil, fmt.Errorf("unknown message format %q", cfg.MessageFormat)
+	}
+	return newCodecs(writer, codecs...), nil
+}
+
+func newCodecs(writer Codec, codecs ...Codec) *Codecs {
+	c := &Codecs{writer: writer, byType: make(map[string]Codec, len(codecs))}
+	for _, codec := range codecs {
+		c.byType[codec.ContentType()] = codec
+	}
+	return c
+}
+
+// Decode decodes the value of m with the codec of its content type.
+func (c *Codecs) Decode(ctx context.Context, m kafka.Message) (order.Order, error) {
+	contentType := ContentTypeOf(m)
+	codec, ok := c.byType[contentType]
+	if !ok {
+		return order.Order{}, fmt.Errorf("unsupported content type %q", contentType)
+	}
+	return codec.Decode(ctx, m.Value)
+}
+
+// ContentTypeOf returns the media type named by the content-type header of m,
+// JSON when there is none.
+func ContentTypeOf(m kafka.Message) string {
+	contentType := ContentTypeJSON
+	for _, h := range m.Headers {
+		if h.Key == ContentTypeHeader {
+			contentType = string(h.Value)
+		}
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+	return contentType
+}
+
+// EncodeMessage encodes o with the configured codec and names it in the
+// content-type header; it implements order.MessageEncoder.
+func (c *Codecs) EncodeMessage(ctx context.Context, o order.Order) (kafka.Message, error) {
+	value, err := c.writer.Encode(ctx, o)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	return kafka.Message{
+		Value:   value,
+		Headers: []kafka.Header{{Key: ContentTypeHeader, Value: []byte(c.writer.ContentType())}},
+	}, nil
+}
+
+// jsonCodec publishes the current payload version and reads every known
+// one, see order.UnmarshalPayload.
+type jsonCodec struct {
+	strict bool
+}
+
+func (jsonCodec) ContentType() string { return ContentTypeJSON }
+
+func (jsonCodec) Encode(_ context.Context, o order.Order) ([]byte, error) {
+	return order.MarshalPayload(o)
+}
+
+func (c jsonCodec) Decode(_ context.Context, data []byte) (order.Order, error) {
+	return order.UnmarshalPayload(data, c.strict)
+}
@@ -2,52 +2,247 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
+	"L0/internal/audit"
 	"L0/internal/config"
+	"L0/internal/health"
+	"L0/internal/logger"
+	"L0/internal/metrics"
 	"L0/internal/order"
-	"log"
+	"L0/internal/tracing"
+	"log/slog"
 
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func NewConsumer(cfg config.KafkaConf) *kafka.Reader {
+func NewReader(cfg config.KafkaConf) (*kafka.Reader, error) {
+	dialer, err := NewDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:     cfg.Brokers,
 		Topic:       cfg.Topic,
 		GroupID:     cfg.GroupID,
 		StartOffset: cfg.Offset,
 		MaxWait:     100 * time.Millisecond,
+		Dialer:      dialer,
 	})
-	return reader
+	return reader, nil
+}
+
+// HeartbeatInterval bounds how long a consumer waits for a message before it
+// reports liveness; a consumer without a beat for several intervals is stuck
+// or gone.
+const HeartbeatInterval = 5 * time.Second
+
+// MessageReader is the part of *kafka.Reader the consumer uses.
+type MessageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Consumer saves orders read from the orders topic.
+type Consumer struct {
+	reader    MessageReader
+	svc       order.Service
+	dlq       order.Writer
+	codecs    *Codecs
+	logger    *slog.Logger
+	heartbeat *health.Heartbeat
+	// work bounds handling of a fetched message. It is separate from the Run
+	// context so that stopping intake lets the in-flight message finish.
+	work context.Context
+}
+
+// NewConsumer creates a consumer. dlq receives messages that cannot be decoded
+// or fail validation; with a nil dlq such messages are logged and dropped.
+// A nil logger falls back to slog.Default().
+func NewConsumer(reader MessageReader, svc order.Service, dlq order.Writer, logger *slog.Logger) *Consumer {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Consumer{reader: reader, svc: svc, dlq: dlq, codecs: DefaultCodecs(), logger: logger, heartbeat: &health.Heartbeat{}}
+}
+
+// SetCodecs sets the codecs messages are decoded with; DefaultCodecs
+// otherwise.
+func (c *Consumer) SetCodecs(codecs *Codecs) {
+	c.codecs = codecs
+}
+
+// Heartbeat beats on every loop iteration, including idle ones.
+func (c *Consumer) Heartbeat() *health.Heartbeat {
+	return c.heartbeat
 }
 
-func RunConsumer(ctx context.Context, reader *kafka.Reader, svc *order.OrderService) {
+// Run consumes until ctx is cancelled, returning nil, or until fetching fails,
+// returning the error. Cancelling ctx stops fetching; a message already being
+// handled is saved and committed first. It does not close the reader.
+func (c *Consumer) Run(ctx context.Context) error {
+	work := c.work
+	if work == nil {
+		work = context.WithoutCancel(ctx)
+	}
 	for {
-		m, err := reader.FetchMessage(ctx)
-		if err != nil {
-			log.Printf("kafka fetch error: %v", err)
-			break
+		c.heartbeat.Beat()
+		m, err := c.fetch(ctx)
+		if ctx.Err() != nil {
+			return nil
 		}
-		var ord order.Order
-		if err := json.Unmarshal(m.Value, &ord); err != nil {
-			log.Printf("unmarshal error: %v; payload=%s", err, string(m.Value))
+		if errors.Is(err, context.DeadlineExceeded) {
 			continue
 		}
-		if err := svc.SaveOrder(ctx, ord); err != nil {
-			log.Printf("save order error (order_uid=%s): %v", ord.OrderUID, err)
-			continue
+		if err != nil {
+			return fmt.Errorf("fetch message: %w", err)
 		}
-		if err := reader.CommitMessages(ctx, m); err != nil {
-			log.Printf("commit offset error: %v", err)
+		metrics.KafkaLag.WithLabelValues(strconv.Itoa(m.Partition)).Set(float64(m.HighWaterMark - m.Offset - 1))
+
+		c.handle(work, m)
+	}
+}
+
+// fetch waits for the next message at most HeartbeatInterval.
+func (c *Consumer) fetch(ctx context.Context) (kafka.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, HeartbeatInterval)
+	defer cancel()
+	return c.reader.FetchMessage(ctx)
+}
+
+// handle processes one message inside a consumer span that continues the
+// trace of the producer.
+func (c *Consumer) handle(ctx context.Context, m kafka.Message) {
+	ctx, span := tracing.Tracer().Start(tracing.ExtractMessage(ctx, m), "kafka.consume "+m.Topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", m.Topic),
+			attribute.Int("messaging.kafka.partition", m.Partition),
+			attribute.Int64("messaging.kafka.offset", m.Offset),
+		))
+	defer span.End()
+	ctx = messageContext(ctx, m)
+
+	ord, err := c.codecs.Decode(ctx, m)
+	if err != nil {
+		// The payload may hold personal data; log what identifies it instead.
+		args := []any{"error", err, "size", len(m.Value), "content_type", ContentTypeOf(m)}
+		if ord.OrderUID != "" {
+			args = append(args, "order_uid", ord.OrderUID)
 		}
+		c.logger.WarnContext(ctx, "decode order failed", args...)
+		span.SetStatus(codes.Error, err.Error())
+		c.reject(ctx, m, err)
+		return
+	}
+	span.SetAttributes(attribute.String("order.uid", ord.OrderUID))
+	ctx = logger.With(ctx, "order_uid", ord.OrderUID)
+	if err := order.Validate(ord); err != nil {
+		c.logger.WarnContext(ctx, "invalid order", "error", err)
+		span.SetStatus(codes.Error, err.Error())
+		c.reject(ctx, m, err)
+		return
 	}
+	if _, err := c.svc.SaveOrder(ctx, ord, order.SaveOptions{}); err != nil {
+		c.logger.ErrorContext(ctx, "save order failed", "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		metrics.KafkaMessages.WithLabelValues("failed").Inc()
+		return
+	}
+	metrics.KafkaMessages.WithLabelValues("processed").Inc()
+	c.commit(ctx, m)
+}
+
+// reject forwards a message that can never be processed to the dead-letter
+// topic and commits it, so it does not block the partition.
+func (c *Consumer) reject(ctx context.Context, m kafka.Message, cause error) {
+	if c.dlq == nil {
+		metrics.KafkaMessages.WithLabelValues("failed").Inc()
+		return
+	}
+	dead := kafka.Message{
+		Key:   m.Key,
+		Value: m.Value,
+		Headers: append(m.Headers,
+			kafka.Header{Key: "dlq-topic", Value: []byte(m.Topic)},
+			kafka.Header{Key: "dlq-partition", Value: []byte(strconv.Itoa(m.Partition))},
+			kafka.Header{Key: "dlq-offset", Value: []byte(strconv.FormatInt(m.Offset, 10))},
+			kafka.Header{Key: "dlq-error", Value: []byte(cause.Error())},
+		),
+	}
+	if err := c.dlq.WriteMessages(ctx, dead); err != nil {
+		c.logger.ErrorContext(ctx, "dead-letter write failed", "error", err)
+		metrics.KafkaMessages.WithLabelValues("failed").Inc()
+		return
+	}
+	c.logger.InfoContext(ctx, "message dead-lettered", "cause", cause)
+	metrics.KafkaMessages.WithLabelValues("dead_lettered").Inc()
+	c.commit(ctx, m)
+}
+
+func (c *Consumer) commit(ctx context.Context, m kafka.Message) {
+	if err := c.reader.CommitMessages(ctx, m); err != nil {
+		c.logger.ErrorContext(ctx, "commit offset failed", "error", err)
+	}
+}
+
+// messageContext attributes mutations made while handling m to its offset and
+// tags log records with the message position.
+func messageContext(ctx context.Context, m kafka.Message) context.Context {
+	ctx = logger.With(ctx, "topic", m.Topic, "partition", m.Partition, "offset", m.Offset)
+	return audit.WithSource(ctx, audit.KafkaSource(m.Topic, m.Partition, m.Offset))
+}
+
+// BrokerCheck is a readiness check that the brokers answer and know the topic.
+func BrokerCheck(cfg config.KafkaConf) (health.CheckFunc, error) {
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{cfg.Topic}})
+		if err != nil {
+			return err
+		}
+		for _, t := range meta.Topics {
+			if t.Name == cfg.Topic && t.Error != nil {
+				return t.Error
+			}
+		}
+		return nil
+	}, nil
+}
+
+func NewWriter(cfg config.KafkaConf) (*kafka.Writer, error) {
+	return newWriter(cfg, cfg.Topic)
+}
+
+// NewDeadLetterWriter returns a writer for the dead-letter topic, or nil when
+// KAFKA_DLQ_TOPIC is not set.
+func NewDeadLetterWriter(cfg config.KafkaConf) (*kafka.Writer, error) {
+	if cfg.DeadLetterTopic == "" {
+		return nil, nil
+	}
+	return newWriter(cfg, cfg.DeadLetterTopic)
 }
 
-func NewWriter(cfg config.KafkaConf) *kafka.Writer {
+func newWriter(cfg config.KafkaConf, topic string) (*kafka.Writer, error) {
+	dialer, err := NewDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
 	return kafka.NewWriter(kafka.WriterConfig{
 		Brokers: cfg.Brokers,
-		Topic:   cfg.Topic,
-	})
+		Topic:   topic,
+		Dialer:  dialer,
+	}), nil
 }
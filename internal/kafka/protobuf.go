@@ -0,0 +1,331 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"L0/internal/order"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protobufCodec encodes the Order message of order.proto. Zero values are
+// left out as in proto3, and unknown fields are skipped, so fields can be
+// added to the schema without breaking older consumers. The schema evolves
+// by field numbers, so decoded orders count as the current payload version.
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return ContentTypeProtobuf }
+
+func (protobufCodec) Encode(_ context.Context, o order.Order) ([]byte, error) {
+	var w pbWriter
+	w.string(1, o.OrderUID)
+	w.string(2, o.TrackNumber)
+	w.string(3, o.Entry)
+	w.message(4, encodeDeliveryPB(o.Delivery))
+	w.message(5, encodePaymentPB(o.Payment))
+	for _, it := range o.Products {
+		w.message(6, encodeItemPB(it))
+	}
+	w.string(7, o.Locale)
+	w.string(8, o.InternalSignature)
+	w.string(9, o.CustomerID)
+	w.string(10, o.DeliveryService)
+	w.string(11, o.ShardKey)
+	w.int(12, int64(o.SmID))
+	if !o.DateCreated.IsZero() {
+		var ts pbWriter
+		ts.int(1, o.DateCreated.Unix())
+		ts.int(2, int64(o.DateCreated.Nanosecond()))
+		w.message(13, ts.b)
+	}
+	w.string(14, o.OofShard)
+	return w.b, nil
+}
+
+func encodeDeliveryPB(d order.Delivery) []byte {
+	var w pbWriter
+	w.string(1, d.Name)
+	w.string(2, d.Phone)
+	w.string(3, d.Zip)
+	w.string(4, d.City)
+	w.string(5, d.Address)
+	w.string(6, d.Region)
+	w.string(7, d.Email)
+	return w.b
+}
+
+func encodePaymentPB(p order.Payment) []byte {
+	var w pbWriter
+	w.string(1, p.Transaction)
+	w.string(2, p.RequestID)
+	w.string(3, p.Currency)
+	w.string(4, p.Provider)
+	w.int(5, int64(p.Amount))
+	w.int(6, p.PaymentDt)
+	w.string(7, p.Bank)
+	w.int(8, int64(p.DeliveryCost))
+	w.int(9, int64(p.GoodsTotal))
+	w.int(10, int64(p.CustomFee))
+	return w.b
+}
+
+func encodeItemPB(it order.Product) []byte {
+	var w pbWriter
+	w.int(1, int64(it.ChrtID))
+	w.string(2, it.TrackNumber)
+	w.int(3, int64(it.Price))
+	w.string(4, it.Rid)
+	w.string(5, it.Name)
+	w.int(6, int64(it.Sale))
+	w.string(7, it.Size)
+	w.int(8, int64(it.TotalPrice))
+	w.int(9, int64(it.NmID))
+	w.string(10, it.Brand)
+	w.int(11, int64(it.Status))
+	return w.b
+}
+
+func (protobufCodec) Decode(_ context.Context, data []byte) (order.Order, error) {
+	o := order.Order{Products: []order.Product{}, PayloadVersion: order.CurrentPayloadVersion}
+	err := eachField(data, func(f pbField) error {
+		switch f.num {
+		case 1:
+			return f.string(&o.OrderUID)
+		case 2:
+			return f.string(&o.TrackNumber)
+		case 3:
+			return f.string(&o.Entry)
+		case 4:
+			return f.message(func(b []byte) error { return decodeDeliveryPB(b, &o.Delivery) })
+		case 5:
+			return f.message(func(b []byte) error { return decodePaymentPB(b, &o.Payment) })
+		case 6:
+			return f.message(func(b []byte) error {
+				var it order.Product
+				if err := decodeItemPB(b, &it); err != nil {
+					return err
+				}
+				o.Products = append(o.Products, it)
+				return nil
+			})
+		case 7:
+			return f.string(&o.Locale)
+		case 8:
+			return f.string(&o.InternalSignature)
+		case 9:
+			return f.string(&o.CustomerID)
+		case 10:
+			return f.string(&o.DeliveryService)
+		case 11:
+			return f.string(&o.ShardKey)
+		case 12:
+			return f.int(&o.SmID)
+		case 13:
+			return f.message(func(b []byte) error {
+				var sec, nsec int64
+				err := eachField(b, func(f pbField) error {
+					switch f.num {
+					case 1:
+						return f.int64(&sec)
+					case 2:
+						return f.int64(&nsec)
+					}
+					return nil
+				})
+				o.DateCreated = time.Unix(sec, nsec).UTC()
+				return err
+			})
+		case 14:
+			return f.string(&o.OofShard)
+		}
+		return nil
+	})
+	return o, err
+}
+
+func decodeDeliveryPB(b []byte, d *order.Delivery) error {
+	return eachField(b, func(f pbField) error {
+		switch f.num {
+		case 1:
+			return f.string(&d.Name)
+		case 2:
+			return f.string(&d.Phone)
+		case 3:
+			return f.string(&d.Zip)
+		case 4:
+			return f.string(&d.City)
+		case 5:
+			return f.string(&d.Address)
+		case 6:
+			return f.string(&d.Region)
+		case 7:
+			return f.string(&d.Email)
+		}
+		return nil
+	})
+}
+
+func decodePaymentPB(b []byte, p *order.Payment) error {
+	return eachField(b, func(f pbField) error {
+		switch f.num {
+		case 1:
+			return f.string(&p.Transaction)
+		case 2:
+			return f.string(&p.RequestID)
+		case 3:
+			return f.string(&p.Currency)
+		case 4:
+			return f.string(&p.Provider)
+		case 5:
+			return f.int(&p.Amount)
+		case 6:
+			return f.int64(&p.PaymentDt)
+		case 7:
+			return f.string(&p.Bank)
+		case 8:
+			return f.int(&p.DeliveryCost)
+		case 9:
+			return f.int(&p.GoodsTotal)
+		case 10:
+			return f.int(&p.CustomFee)
+		}
+		return nil
+	})
+}
+
+func decodeItemPB(b []byte, it *order.Product) error {
+	return eachField(b, func(f pbField) error {
+		switch f.num {
+		case 1:
+			return f.int(&it.ChrtID)
+		case 2:
+			return f.string(&it.TrackNumber)
+		case 3:
+			return f.int(&it.Price)
+		case 4:
+			return f.string(&it.Rid)
+		case 5:
+			return f.string(&it.Name)
+		case 6:
+			return f.int(&it.Sale)
+		case 7:
+			return f.string(&it.Size)
+		case 8:
+			return f.int(&it.TotalPrice)
+		case 9:
+			return f.int(&it.NmID)
+		case 10:
+			return f.string(&it.Brand)
+		case 11:
+			return f.int(&it.Status)
+		}
+		return nil
+	})
+}
+
+// pbWriter appends fields, leaving out zero scalars.
+type pbWriter struct {
+	b []byte
+}
+
+func (w *pbWriter) string(num protowire.Number, s string) {
+	if s == "" {
+		return
+	}
+	w.b = protowire.AppendTag(w.b, num, protowire.BytesType)
+	w.b = protowire.AppendString(w.b, s)
+}
+
+func (w *pbWriter) int(num protowire.Number, v int64) {
+	if v == 0 {
+		return
+	}
+	w.b = protowire.AppendTag(w.b, num, protowire.VarintType)
+	w.b = protowire.AppendVarint(w.b, uint64(v))
+}
+
+func (w *pbWriter) message(num protowire.Number, m []byte) {
+	w.b = protowire.AppendTag(w.b, num, protowire.BytesType)
+	w.b = protowire.AppendBytes(w.b, m)
+}
+
+// pbField is one decoded field: a varint in v or a length-delimited value
+// in data.
+type pbField struct {
+	num  protowire.Number
+	typ  protowire.Type
+	v    uint64
+	data []byte
+}
+
+// eachField calls fn for every varint and length-delimited field of b and
+// skips fields of other wire types.
+func eachField(b []byte, fn func(pbField) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		f := pbField{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.v, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			f.data, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+		if typ != protowire.VarintType && typ != protowire.BytesType {
+			continue
+		}
+		if err := fn(f); err != nil {
+			return fmt.Errorf("field %d: %w", num, err)
+		}
+	}
+	return nil
+}
+
+func (f pbField) want(typ protowire.Type) error {
+	if f.typ != typ {
+		return fmt.Errorf("wire type %d, want %d", f.typ, typ)
+	}
+	return nil
+}
+
+func (f pbField) string(dst *string) error {
+	if err := f.want(protowire.BytesType); err != nil {
+		return err
+	}
+	*dst = string(f.data)
+	return nil
+}
+
+func (f pbField) int(dst *int) error {
+	if err := f.want(protowire.VarintType); err != nil {
+		return err
+	}
+	*dst = int(int64(f.v))
+	return nil
+}
+
+func (f pbField) int64(dst *int64) error {
+	if err := f.want(protowire.VarintType); err != nil {
+		return err
+	}
+	*dst = int64(f.v)
+	return nil
+}
+
+func (f pbField) message(decode func([]byte) error) error {
+	if err := f.want(protowire.BytesType); err != nil {
+		return err
+	}
+	return decode(f.data)
+}
@@ -0,0 +1,165 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"L0/internal/config"
+)
+
+// Error codes of the Confluent schema registry API.
+const (
+	registrySubjectNotFound = 40401
+	registryVersionNotFound = 40402
+)
+
+const registryContentType = "application/vnd.schemaregistry.v1+json"
+
+// RegistryError is an error response of the schema registry.
+type RegistryError struct {
+	Status  int    `json:"-"`
+	Code    int    `json:"error_code"`
+	Message string `json:"message"`
+}
+
+func (e *RegistryError) Error() string {
+	return fmt.Sprintf("schema registry: %d %s (status %d)", e.Code, e.Message, e.Status)
+}
+
+// Registry is a client of a Confluent-compatible schema registry. Schemas
+// read by id are cached, since an id never changes its schema.
+type Registry struct {
+	base     *url.URL
+	username string
+	password string
+	client   *http.Client
+
+	mu      sync.Mutex
+	schemas map[int]string
+}
+
+func NewRegistry(cfg config.SchemaRegistryConf) (*Registry, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("schema registry URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("schema registry URL %q is not an http(s) URL", cfg.URL)
+	}
+	return &Registry{
+		base:     u,
+		username: cfg.Username,
+		password: cfg.Password,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		schemas:  map[int]string{},
+	}, nil
+}
+
+// Schema returns the schema registered under id.
+func (r *Registry) Schema(ctx context.Context, id int) (string, error) {
+	r.mu.Lock()
+	schema, ok := r.schemas[id]
+	r.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+	var resp struct {
+		Schema string `json:"schema"`
+	}
+	if err := r.do(ctx, http.MethodGet, "/schemas/ids/"+strconv.Itoa(id), nil, &resp); err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	r.schemas[id] = resp.Schema
+	r.mu.Unlock()
+	return resp.Schema, nil
+}
+
+// Register registers schema under subject and returns its id. Registering
+// a schema the subject already has returns the existing id.
+func (r *Registry) Register(ctx context.Context, subject, schema string) (int, error) {
+	var resp struct {
+		ID int `json:"id"`
+	}
+	if err := r.do(ctx, http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", map[string]string{"schema": schema}, &resp); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	r.schemas[resp.ID] = schema
+	r.mu.Unlock()
+	return resp.ID, nil
+}
+
+// Compatible reports whether schema is compatible with the latest version
+// of subject under the compatibility level set in the registry. Any schema
+// is compatible with a subject that has no versions yet.
+func (r *Registry) Compatible(ctx context.Context, subject, schema string) (bool, error) {
+	var resp struct {
+		IsCompatible bool `json:"is_compatible"`
+	}
+	err := r.do(ctx, http.MethodPost, "/compatibility/subjects/"+url.PathEscape(subject)+"/versions/latest", map[string]string{"schema": schema}, &resp)
+	var rerr *RegistryError
+	if errors.As(err, &rerr) && (rerr.Code == registrySubjectNotFound || rerr.Code == registryVersionNotFound) {
+		return true, nil
+	}
+	return resp.IsCompatible, err
+}
+
+// do sends a request to path, which is already escaped, relative to the
+// registry URL.
+func (r *Registry) do(ctx context.Context, method, path string, body, out any) error {
+	var payload io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(b)
+	}
+	u := *r.base
+	// Setting the escaped form keeps a subject's %2F from being decoded into
+	// a path separator or escaped twice.
+	u.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + path
+	p, err := url.PathUnescape(u.RawPath)
+	if err != nil {
+		return err
+	}
+	u.Path = p
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", registryContentType)
+	if body != nil {
+		req.Header.Set("Content-Type", registryContentType)
+	}
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		rerr := &RegistryError{Status: resp.StatusCode}
+		if json.Unmarshal(data, rerr) != nil || rerr.Message == "" {
+			rerr.Message = string(bytes.TrimSpace(data))
+		}
+		return rerr
+	}
+	return json.Unmarshal(data, out)
+}
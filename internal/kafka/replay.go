@@ -0,0 +1,411 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"time"
+
+	"L0/internal/config"
+	"L0/internal/order"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type ReplayOptions struct {
+	// Partitions to replay; empty means every partition of the topic.
+	Partitions []int
+	// Offset to start from in each partition when From is not set;
+	// kafka.FirstOffset replays everything still retained.
+	Offset int64
+	// From and To bound message timestamps; zero values leave the range open.
+	From time.Time
+	To   time.Time
+	// GroupID is the consumer group replay progress is committed to, without
+	// joining it: the next offset of every partition is committed as the
+	// replay goes, and a replay resumes each partition from its committed
+	// offset when it is past the start. It must differ from the live
+	// consumer group. Empty disables it; dry runs only read it.
+	GroupID string
+	// Checkpoint is a file keeping the same offsets, for when the replay
+	// group is disabled or a commit fails. Empty disables it; dry runs only
+	// read it.
+	Checkpoint string
+	// DryRun validates and saves every message in a rolled back transaction.
+	DryRun bool
+	// Policy overrides the configured conflict policy when set.
+	Policy order.ConflictPolicy
+}
+
+type ReplayReport struct {
+	Inserted int `json:"inserted"`
+	Updated  int `json:"updated"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
+	// NextOffsets holds, per partition, the offset after the last message
+	// processed; pass it as -offset to resume without a group or checkpoint.
+	NextOffsets map[int]int64 `json:"next_offsets,omitempty"`
+}
+
+// Replayer re-reads the orders topic partition by partition, without joining
+// any consumer group, up to the end offsets seen when it started. Progress is
+// committed under the replay group and kept in the checkpoint file.
+type Replayer struct {
+	cfg        config.KafkaConf
+	client     *kafka.Client
+	dialer     *kafka.Dialer
+	svc        order.Service
+	codecs     *Codecs
+	opts       ReplayOptions
+	checkpoint replayCheckpoint
+	committed  map[int]int64
+	report     ReplayReport
+	logger     *slog.Logger
+}
+
+const (
+	// replayCommitInterval is how often progress is saved while a
+	// partition is replayed; it is also saved when the partition ends.
+	replayCommitInterval = time.Second
+	// replayIdleTimeout is how long a read may return nothing before the
+	// records left before the end offset are taken to be unreadable.
+	replayIdleTimeout = 5 * time.Second
+)
+
+// replayCheckpoint is the content of ReplayOptions.Checkpoint.
+type replayCheckpoint struct {
+	Topic       string        `json:"topic"`
+	NextOffsets map[int]int64 `json:"next_offsets"`
+}
+
+// NewReplayer creates a replayer; a nil logger falls back to slog.Default().
+func NewReplayer(cfg config.KafkaConf, svc order.Service, opts ReplayOptions, logger *slog.Logger) *Replayer {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Replayer{
+		cfg:    cfg,
+		svc:    svc,
+		codecs: DefaultCodecs(),
+		opts:   opts,
+		report: ReplayReport{NextOffsets: map[int]int64{}},
+		logger: logger,
+	}
+}
+
+// SetCodecs sets the codecs messages are decoded with; DefaultCodecs
+// otherwise.
+func (r *Replayer) SetCodecs(codecs *Codecs) {
+	r.codecs = codecs
+}
+
+func (r *Replayer) Run(ctx context.Context) (ReplayReport, error) {
+	if r.opts.GroupID != "" && r.opts.GroupID == r.cfg.GroupID {
+		return r.report, errors.New("replay group must differ from the live consumer group")
+	}
+	if err := r.loadCheckpoint(); err != nil {
+		return r.report, err
+	}
+	client, err := newClient(r.cfg)
+	if err != nil {
+		return r.report, err
+	}
+	dialer, err := NewDialer(r.cfg)
+	if err != nil {
+		return r.report, err
+	}
+	r.client, r.dialer = client, dialer
+	partitions, err := r.partitions(ctx)
+	if err != nil {
+		return r.report, err
+	}
+	if err := r.loadCommitted(ctx, partitions); err != nil {
+		return r.report, err
+	}
+	for _, p := range partitions {
+		if err := r.replayPartition(ctx, p); err != nil {
+			return r.report, fmt.Errorf("partition %d: %w", p, err)
+		}
+	}
+	return r.report, nil
+}
+
+func (r *Replayer) Report() ReplayReport {
+	return r.report
+}
+
+// Process validates and saves a single message and counts the outcome.
+// It reports false when the message is past the To bound.
+func (r *Replayer) Process(ctx context.Context, m kafka.Message) bool {
+	if !r.opts.To.IsZero() && m.Time.After(r.opts.To) {
+		return false
+	}
+	ctx = messageContext(ctx, m)
+	ord, err := r.codecs.Decode(ctx, m)
+	if err == nil {
+		err = order.Validate(ord)
+	}
+	var result order.SaveResult
+	if err == nil {
+		opts := order.SaveOptions{Policy: r.opts.Policy, DryRun: r.opts.DryRun}
+		result, err = r.svc.SaveOrder(ctx, ord, opts)
+	}
+	r.report.NextOffsets[m.Partition] = m.Offset + 1
+	if err != nil {
+		r.report.Failed++
+		r.logger.WarnContext(ctx, "replay message failed", "order_uid", ord.OrderUID, "error", err)
+		return true
+	}
+	switch result {
+	case order.SaveInserted:
+		r.report.Inserted++
+	case order.SaveUpdated:
+		r.report.Updated++
+	default:
+		r.report.Skipped++
+	}
+	return true
+}
+
+func (r *Replayer) partitions(ctx context.Context) ([]int, error) {
+	if len(r.opts.Partitions) > 0 {
+		return r.opts.Partitions, nil
+	}
+	meta, err := r.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{r.cfg.Topic}})
+	if err != nil {
+		return nil, err
+	}
+	if len(meta.Topics) == 0 {
+		return nil, fmt.Errorf("topic %q not found", r.cfg.Topic)
+	}
+	if meta.Topics[0].Error != nil {
+		return nil, meta.Topics[0].Error
+	}
+	res := make([]int, 0, len(meta.Topics[0].Partitions))
+	for _, p := range meta.Topics[0].Partitions {
+		res = append(res, p.ID)
+	}
+	return res, nil
+}
+
+// offsetOf resolves one OffsetRequest. Requests are sent one at a time since
+// brokers reject duplicate partitions in a single ListOffsets call.
+func (r *Replayer) offsetOf(ctx context.Context, req kafka.OffsetRequest) (int64, error) {
+	resp, err := r.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{r.cfg.Topic: {req}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, po := range resp.Topics[r.cfg.Topic] {
+		if po.Partition != req.Partition {
+			continue
+		}
+		if po.Error != nil {
+			return 0, po.Error
+		}
+		switch req.Timestamp {
+		case kafka.FirstOffset:
+			return po.FirstOffset, nil
+		case kafka.LastOffset:
+			return po.LastOffset, nil
+		}
+		for off := range po.Offsets {
+			return off, nil
+		}
+		return -1, nil
+	}
+	return 0, errors.New("no offsets returned")
+}
+
+func (r *Replayer) replayPartition(ctx context.Context, partition int) error {
+	first, err := r.offsetOf(ctx, kafka.FirstOffsetOf(partition))
+	if err != nil {
+		return err
+	}
+	last, err := r.offsetOf(ctx, kafka.LastOffsetOf(partition))
+	if err != nil {
+		return err
+	}
+
+	start := r.opts.Offset
+	if !r.opts.From.IsZero() {
+		// -1 means no message at or after From.
+		if start, err = r.offsetOf(ctx, kafka.TimeOffsetOf(partition, r.opts.From)); err != nil {
+			return err
+		}
+		if start < 0 {
+			start = last
+		}
+	}
+	if next, ok := r.committed[partition]; ok && next > start {
+		start = next
+	}
+	if next, ok := r.checkpoint.NextOffsets[partition]; ok && next > start {
+		start = next
+	}
+	if start < first {
+		start = first
+	}
+	if start >= last {
+		return nil
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   r.cfg.Brokers,
+		Topic:     r.cfg.Topic,
+		Partition: partition,
+		MaxWait:   100 * time.Millisecond,
+		Dialer:    r.dialer,
+	})
+	defer reader.Close()
+	if err := reader.SetOffset(start); err != nil {
+		return err
+	}
+
+	defer r.saveProgress(context.WithoutCancel(ctx), partition)
+	saved := time.Now()
+	for next := start; next < last; {
+		readCtx, cancel := context.WithTimeout(ctx, replayIdleTimeout)
+		m, err := reader.ReadMessage(readCtx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			// Transaction markers take offsets without being returned as
+			// messages, so a partition ending with one never reaches last.
+			// Once the broker answers and still has nothing to give,
+			// nothing readable is left before last.
+			if _, err := r.offsetOf(ctx, kafka.LastOffsetOf(partition)); err != nil {
+				return err
+			}
+			r.logger.InfoContext(ctx, "replay reached the end of the partition", "partition", partition, "skipped_from", next, "end", last)
+			r.report.NextOffsets[partition] = last
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !r.Process(ctx, m) {
+			return nil
+		}
+		next = m.Offset + 1
+		if time.Since(saved) >= replayCommitInterval {
+			r.saveProgress(ctx, partition)
+			saved = time.Now()
+		}
+	}
+	return nil
+}
+
+// loadCommitted reads the offsets committed under the replay group.
+func (r *Replayer) loadCommitted(ctx context.Context, partitions []int) error {
+	r.committed = map[int]int64{}
+	if r.opts.GroupID == "" {
+		return nil
+	}
+	resp, err := r.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: r.opts.GroupID,
+		Topics:  map[string][]int{r.cfg.Topic: partitions},
+	})
+	if err == nil {
+		err = resp.Error
+	}
+	if err != nil {
+		return fmt.Errorf("fetch offsets of group %s: %w", r.opts.GroupID, err)
+	}
+	for _, p := range resp.Topics[r.cfg.Topic] {
+		if p.Error != nil {
+			return fmt.Errorf("fetch offsets of group %s, partition %d: %w", r.opts.GroupID, p.Partition, p.Error)
+		}
+		// -1 means nothing was committed for the partition.
+		if p.CommittedOffset >= 0 {
+			r.committed[p.Partition] = p.CommittedOffset
+		}
+	}
+	return nil
+}
+
+// saveProgress commits the progress of partition under the replay group and
+// stores it in the checkpoint file.
+func (r *Replayer) saveProgress(ctx context.Context, partition int) {
+	if _, ok := r.report.NextOffsets[partition]; !ok || r.opts.DryRun {
+		return
+	}
+	r.commit(ctx, partition)
+	r.saveCheckpoint(ctx, partition)
+}
+
+// commit records the progress of partition under the replay group as a
+// standalone consumer, outside any generation. Failures are only logged:
+// the replay itself already happened, and the checkpoint keeps the offset.
+func (r *Replayer) commit(ctx context.Context, partition int) {
+	if r.opts.GroupID == "" {
+		return
+	}
+	resp, err := r.client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      r.opts.GroupID,
+		GenerationID: -1,
+		Topics: map[string][]kafka.OffsetCommit{
+			r.cfg.Topic: {{Partition: partition, Offset: r.report.NextOffsets[partition]}},
+		},
+	})
+	if err == nil {
+		for _, p := range resp.Topics[r.cfg.Topic] {
+			if p.Error != nil {
+				err = p.Error
+			}
+		}
+	}
+	if err != nil {
+		r.logger.WarnContext(ctx, "replay offset commit failed", "group", r.opts.GroupID, "partition", partition, "error", err)
+	}
+}
+
+// loadCheckpoint reads the checkpoint file, if there is one yet.
+func (r *Replayer) loadCheckpoint() error {
+	r.checkpoint = replayCheckpoint{Topic: r.cfg.Topic, NextOffsets: map[int]int64{}}
+	if r.opts.Checkpoint == "" {
+		return nil
+	}
+	data, err := os.ReadFile(r.opts.Checkpoint)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var cp replayCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return fmt.Errorf("read checkpoint %s: %w", r.opts.Checkpoint, err)
+	}
+	if cp.Topic != r.cfg.Topic {
+		return fmt.Errorf("checkpoint %s is for topic %q, not %q", r.opts.Checkpoint, cp.Topic, r.cfg.Topic)
+	}
+	if cp.NextOffsets != nil {
+		r.checkpoint.NextOffsets = cp.NextOffsets
+	}
+	return nil
+}
+
+// saveCheckpoint stores the progress of partition in the checkpoint file,
+// replacing it atomically. Failures are only logged: the replay itself
+// already happened, and the report carries the same offsets.
+func (r *Replayer) saveCheckpoint(ctx context.Context, partition int) {
+	if r.opts.Checkpoint == "" {
+		return
+	}
+	r.checkpoint.NextOffsets[partition] = r.report.NextOffsets[partition]
+	data, err := json.Marshal(r.checkpoint)
+	if err == nil {
+		tmp := r.opts.Checkpoint + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, r.opts.Checkpoint)
+		}
+	}
+	if err != nil {
+		r.logger.WarnContext(ctx, "replay checkpoint failed", "file", r.opts.Checkpoint, "partition", partition, "error", err)
+	}
+}
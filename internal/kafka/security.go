@@ -0,0 +1,104 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"L0/internal/config"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// NewDialer returns the dialer readers and writers connect with, set up for
+// TLS and SASL as configured.
+func NewDialer(cfg config.KafkaConf) (*kafka.Dialer, error) {
+	tlsCfg, mech, err := security(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Dialer{
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		TLS:           tlsCfg,
+		SASLMechanism: mech,
+	}, nil
+}
+
+// NewTransport returns the transport for kafka.Client, set up like NewDialer.
+func NewTransport(cfg config.KafkaConf) (*kafka.Transport, error) {
+	tlsCfg, mech, err := security(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Transport{TLS: tlsCfg, SASL: mech}, nil
+}
+
+func newClient(cfg config.KafkaConf) (*kafka.Client, error) {
+	transport, err := NewTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Client{Addr: kafka.TCP(cfg.Brokers...), Transport: transport}, nil
+}
+
+func security(cfg config.KafkaConf) (*tls.Config, sasl.Mechanism, error) {
+	tlsCfg, err := tlsConfig(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("kafka tls: %w", err)
+	}
+	mech, err := saslMechanism(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("kafka sasl: %w", err)
+	}
+	return tlsCfg, mech, nil
+}
+
+func tlsConfig(cfg config.KafkaConf) (*tls.Config, error) {
+	if !cfg.TLS.Enabled {
+		return nil, nil
+	}
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+	}
+	if cfg.TLS.CAFile != "" {
+		pem, err := os.ReadFile(cfg.TLS.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", cfg.TLS.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.TLS.CertFile != "" || cfg.TLS.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+func saslMechanism(cfg config.KafkaConf) (sasl.Mechanism, error) {
+	switch strings.ToUpper(cfg.SASL.Mechanism) {
+	case "":
+		return nil, nil
+	case "PLAIN":
+		return plain.Mechanism{Username: cfg.SASL.Username, Password: cfg.SASL.Password}, nil
+	case "SCRAM-SHA-256":
+		return scram.Mechanism(scram.SHA256, cfg.SASL.Username, cfg.SASL.Password)
+	case "SCRAM-SHA-512":
+		return scram.Mechanism(scram.SHA512, cfg.SASL.Username, cfg.SASL.Password)
+	}
+	return nil, fmt.Errorf("unknown mechanism %q (want PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512)", cfg.SASL.Mechanism)
+}
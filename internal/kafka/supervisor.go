@@ -0,0 +1,191 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"L0/internal/health"
+	"L0/internal/metrics"
+	"L0/internal/order"
+)
+
+type SupervisorState string
+
+const (
+	StateStarting   SupervisorState = "starting"
+	StateRunning    SupervisorState = "running"
+	StateRestarting SupervisorState = "restarting"
+	StateStopped    SupervisorState = "stopped"
+)
+
+type SupervisorStatus struct {
+	State     SupervisorState `json:"state"`
+	Restarts  int             `json:"restarts"`
+	LastError string          `json:"last_error,omitempty"`
+}
+
+// Supervisor keeps a consumer running. When the consumer fails it closes the
+// reader, waits with exponential backoff and starts again on a fresh reader.
+type Supervisor struct {
+	newReader  func() (MessageReader, error)
+	svc        order.Service
+	dlq        order.Writer
+	codecs     *Codecs
+	logger     *slog.Logger
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	heartbeat  health.Heartbeat
+
+	// work is the context messages are handled in; abort cancels it when
+	// draining runs out of time.
+	work  context.Context
+	abort context.CancelFunc
+	done  chan struct{}
+
+	mu     sync.Mutex
+	status SupervisorStatus
+}
+
+// NewSupervisor creates a supervisor building readers with newReader. Restart
+// delays start at minBackoff and double up to maxBackoff; a consumer that ran
+// longer than maxBackoff resets the delay. A newReader error counts as a
+// failed run. A nil logger falls back to
+// slog.Default().
+func NewSupervisor(newReader func() (MessageReader, error), svc order.Service, dlq order.Writer, logger *slog.Logger, minBackoff, maxBackoff time.Duration) *Supervisor {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	work, abort := context.WithCancel(context.Background())
+	return &Supervisor{
+		work:       work,
+		abort:      abort,
+		done:       make(chan struct{}),
+		newReader:  newReader,
+		svc:        svc,
+		dlq:        dlq,
+		codecs:     DefaultCodecs(),
+		logger:     logger,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		status:     SupervisorStatus{State: StateStarting},
+	}
+}
+
+// SetCodecs sets the codecs of the consumers; it must be called before Run.
+func (s *Supervisor) SetCodecs(codecs *Codecs) {
+	s.codecs = codecs
+}
+
+// Run blocks until ctx is cancelled. Cancelling ctx stops fetching; the
+// message in flight is still saved and committed, then the reader is closed so
+// the group is left cleanly. Run must be called once.
+func (s *Supervisor) Run(ctx context.Context) {
+	defer close(s.done)
+	defer s.abort()
+	backoff := s.minBackoff
+	for {
+		started := time.Now()
+		err := s.runOnce(ctx)
+		if err == nil || ctx.Err() != nil {
+			s.setState(StateStopped, nil)
+			return
+		}
+
+		if time.Since(started) > s.maxBackoff {
+			backoff = s.minBackoff
+		}
+		s.setState(StateRestarting, err)
+		metrics.KafkaConsumerRestarts.Inc()
+		s.logger.ErrorContext(ctx, "kafka consumer failed, restarting", "error", err, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			s.setState(StateStopped, err)
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, s.maxBackoff)
+	}
+}
+
+// runOnce runs a consumer on a fresh reader until it stops.
+func (s *Supervisor) runOnce(ctx context.Context) error {
+	reader, err := s.newReader()
+	if err != nil {
+		return fmt.Errorf("create reader: %w", err)
+	}
+	consumer := NewConsumer(reader, s.svc, s.dlq, s.logger)
+	consumer.codecs = s.codecs
+	consumer.heartbeat = &s.heartbeat
+	consumer.work = s.work
+
+	s.setState(StateRunning, nil)
+	err = consumer.Run(ctx)
+	if cerr := reader.Close(); cerr != nil {
+		s.logger.WarnContext(ctx, "kafka reader close failed", "error", cerr)
+	}
+	return err
+}
+
+// Wait blocks until Run has returned. If ctx expires first, the message in
+// flight is aborted and Wait returns once Run has finished anyway.
+func (s *Supervisor) Wait(ctx context.Context) error {
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		s.abort()
+		<-s.done
+		return fmt.Errorf("drain consumer: %w", ctx.Err())
+	}
+}
+
+func (s *Supervisor) setState(state SupervisorState, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state == StateRestarting {
+		s.status.Restarts++
+	}
+	s.status.State = state
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+}
+
+func (s *Supervisor) Status() SupervisorStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Check is a health check that passes while the consumer is running and its
+// loop has beaten within maxAge.
+func (s *Supervisor) Check(maxAge time.Duration) health.CheckFunc {
+	beat := s.heartbeat.Check(maxAge)
+	return func(ctx context.Context) error {
+		st := s.Status()
+		if st.State != StateRunning {
+			if st.LastError != "" {
+				return fmt.Errorf("consumer %s after %d restarts: %s", st.State, st.Restarts, st.LastError)
+			}
+			return fmt.Errorf("consumer %s", st.State)
+		}
+		return beat(ctx)
+	}
+}
+
+// LiveCheck is the liveness counterpart of Check: a consumer waiting to be
+// restarted is being taken care of, so only a running consumer whose loop
+// stopped beating fails it.
+func (s *Supervisor) LiveCheck(maxAge time.Duration) health.CheckFunc {
+	beat := s.heartbeat.Check(maxAge)
+	return func(ctx context.Context) error {
+		if s.Status().State != StateRunning {
+			return nil
+		}
+		return beat(ctx)
+	}
+}
@@ -0,0 +1,83 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Phase orders shutdown hooks. Hooks run phase by phase; within a phase in
+// the order they were added.
+type Phase int
+
+const (
+	// PhaseIntake stops accepting new work: HTTP requests, Kafka fetches.
+	PhaseIntake Phase = iota
+	// PhaseDrain waits for in-flight work and commits its offsets.
+	PhaseDrain
+	// PhaseFlush flushes buffered output such as Kafka writers and spans.
+	PhaseFlush
+	// PhasePersist saves state to be restored on the next start.
+	PhasePersist
+	// PhaseClose releases connections that earlier phases still needed.
+	PhaseClose
+)
+
+type hook struct {
+	phase Phase
+	name  string
+	fn    func(ctx context.Context) error
+}
+
+// Manager runs shutdown hooks in phase order under one deadline.
+type Manager struct {
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	hooks []hook
+	once  sync.Once
+	err   error
+}
+
+// NewManager creates a manager; a nil logger falls back to slog.Default().
+func NewManager(logger *slog.Logger) *Manager {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Manager{logger: logger}
+}
+
+func (m *Manager) Add(phase Phase, name string, fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook{phase: phase, name: name, fn: fn})
+}
+
+// Shutdown runs every hook once. A failing or timed out hook does not stop
+// later ones, so connections are closed even when draining did not finish.
+// Later calls return the result of the first.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.once.Do(func() {
+		m.mu.Lock()
+		hooks := append([]hook(nil), m.hooks...)
+		m.mu.Unlock()
+		sort.SliceStable(hooks, func(i, j int) bool { return hooks[i].phase < hooks[j].phase })
+
+		var errs []error
+		for _, h := range hooks {
+			start := time.Now()
+			if err := h.fn(ctx); err != nil {
+				m.logger.ErrorContext(ctx, "shutdown step failed", "step", h.name, "duration", time.Since(start), "error", err)
+				errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+				continue
+			}
+			m.logger.InfoContext(ctx, "shutdown step done", "step", h.name, "duration", time.Since(start))
+		}
+		m.err = errors.Join(errs...)
+	})
+	return m.err
+}
@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "orders"
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_rate_limited_total",
+		Help:      "HTTP requests rejected by the rate limiter by class: ip before authentication, read or write after it.",
+	}, []string{"class"})
+
+	KafkaMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_messages_total",
+		Help:      "Kafka messages handled by the consumer by result: processed, failed or dead_lettered.",
+	}, []string{"result"})
+
+	KafkaLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "kafka_consumer_lag",
+		Help:      "Messages between the last fetched offset and the partition high watermark.",
+	}, []string{"partition"})
+
+	KafkaConsumerRestarts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_consumer_restarts_total",
+		Help:      "Times the supervisor restarted the Kafka consumer after a failure.",
+	})
+
+	DBReads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_reads_total",
+		Help:      "Repository reads by target: replica, primary, or fallback for reads retried on the primary after a replica failed.",
+	}, []string{"target"})
+
+	DBReplicaLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "db_replica_lag_seconds",
+		Help:      "Replication lag last measured on each read replica.",
+	}, []string{"replica"})
+
+	PartitionOps = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "partition_operations_total",
+		Help:      "Monthly partitions of the orders tables created or detached by maintenance.",
+	}, []string{"operation"})
+
+	ArchivedOrders = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "archive_orders_total",
+		Help:      "Orders archived to files, deleted orders purged with their month, orders read back from the archive and orders removed from it.",
+	}, []string{"operation"})
+
+	ImportedOrders = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "import_orders_total",
+		Help:      "Records of bulk imports by result: inserted, updated, skipped or failed.",
+	}, []string{"result"})
+
+	SaveDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "save_duration_seconds",
+		Help:      "OrderService.SaveOrder duration by result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"})
+
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache lookups by result: hit or miss.",
+	}, []string{"result"})
+
+	CacheSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_size",
+		Help:      "Orders currently held in the cache.",
+	})
+
+	cacheHits, cacheMisses atomic.Uint64
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_hit_ratio",
+		Help:      "Share of cache lookups that were hits since start.",
+	}, func() float64 {
+		hits, misses := cacheHits.Load(), cacheMisses.Load()
+		if hits+misses == 0 {
+			return 0
+		}
+		return float64(hits) / float64(hits+misses)
+	})
+)
+
+func CacheHit() {
+	cacheHits.Add(1)
+	CacheRequests.WithLabelValues("hit").Inc()
+}
+
+func CacheMiss() {
+	cacheMisses.Add(1)
+	CacheRequests.WithLabelValues("miss").Inc()
+}
+
+// ObserveSave records a SaveOrder call that started at start.
+func ObserveSave(result string, start time.Time) {
+	SaveDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// Handler serves the default registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// GinMiddleware counts requests and measures latency by route template, so
+// /orders/:id is one series regardless of the id.
+func GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		HTTPRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		HTTPDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolCollector exports pgxpool statistics, read on every scrape.
+type PoolCollector struct {
+	pool *pgxpool.Pool
+
+	acquired     *prometheus.Desc
+	idle         *prometheus.Desc
+	total        *prometheus.Desc
+	max          *prometheus.Desc
+	acquireCount *prometheus.Desc
+	acquireTime  *prometheus.Desc
+	waitCount    *prometheus.Desc
+	waitTime     *prometheus.Desc
+}
+
+func NewPoolCollector(pool *pgxpool.Pool) *PoolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+	return &PoolCollector{
+		pool:         pool,
+		acquired:     desc("acquired_conns", "Connections currently acquired from the pool."),
+		idle:         desc("idle_conns", "Idle connections in the pool."),
+		total:        desc("total_conns", "Total connections in the pool."),
+		max:          desc("max_conns", "Maximum size of the pool."),
+		acquireCount: desc("acquires_total", "Successful connection acquires."),
+		acquireTime:  desc("acquire_duration_seconds_total", "Total time spent acquiring connections."),
+		waitCount:    desc("empty_acquires_total", "Acquires that had to wait for a connection."),
+		waitTime:     desc("empty_acquire_wait_seconds_total", "Total time acquires spent waiting for a connection."),
+	}
+}
+
+// RegisterPool exports the pool statistics on the default registry.
+func RegisterPool(pool *pgxpool.Pool) error {
+	return prometheus.Register(NewPoolCollector(pool))
+}
+
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquired
+	ch <- c.idle
+	ch <- c.total
+	ch <- c.max
+	ch <- c.acquireCount
+	ch <- c.acquireTime
+	ch <- c.waitCount
+	ch <- c.waitTime
+}
+
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	st := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.GaugeValue, float64(st.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(st.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(st.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, float64(st.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(st.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireTime, prometheus.CounterValue, st.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(st.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.waitTime, prometheus.CounterValue, st.EmptyAcquireWaitTime().Seconds())
+}
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_orders_live_date_created;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS erased_at;
+ALTER TABLE orders DROP COLUMN IF EXISTS deleted_at;
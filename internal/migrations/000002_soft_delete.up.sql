@@ -0,0 +1,6 @@
+-- Soft delete and GDPR erasure markers
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS erased_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_orders_live_date_created ON orders(date_created DESC) WHERE deleted_at IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_order_audit_order_uid;
+DROP TABLE IF EXISTS order_audit;
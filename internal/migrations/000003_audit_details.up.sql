@@ -0,0 +1,19 @@
+-- Audit trail of order mutations with source and before/after snapshots
+
+CREATE TABLE IF NOT EXISTS order_audit (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid TEXT NOT NULL,
+    action TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_audit_order_uid ON order_audit(order_uid);
+
+-- Databases migrated when 000002 still created the table get the columns
+-- added.
+ALTER TABLE order_audit ADD COLUMN IF NOT EXISTS source_kind TEXT NOT NULL DEFAULT 'system';
+ALTER TABLE order_audit ADD COLUMN IF NOT EXISTS actor TEXT;
+ALTER TABLE order_audit ADD COLUMN IF NOT EXISTS source_ref TEXT;
+ALTER TABLE order_audit ADD COLUMN IF NOT EXISTS before JSONB;
+ALTER TABLE order_audit ADD COLUMN IF NOT EXISTS after JSONB;
+ALTER TABLE order_audit ADD COLUMN IF NOT EXISTS diff JSONB;
@@ -0,0 +1,104 @@
+-- Back to unpartitioned tables. Only attached partitions are copied back;
+-- partitions detached into the archive schema are left there.
+
+ALTER TABLE orders RENAME TO orders_partitioned;
+ALTER TABLE deliveries RENAME TO deliveries_partitioned;
+ALTER TABLE payments RENAME TO payments_partitioned;
+ALTER TABLE products RENAME TO products_partitioned;
+
+ALTER TABLE orders_partitioned DROP CONSTRAINT orders_pkey;
+ALTER TABLE deliveries_partitioned DROP CONSTRAINT deliveries_pkey;
+ALTER TABLE payments_partitioned DROP CONSTRAINT payments_pkey;
+ALTER TABLE products_partitioned DROP CONSTRAINT products_pkey;
+DROP INDEX IF EXISTS idx_orders_live_date_created;
+DROP INDEX IF EXISTS idx_products_track_number_chrt_id;
+
+CREATE TABLE orders (
+    order_uid TEXT PRIMARY KEY,
+    track_number TEXT UNIQUE NOT NULL,
+    entry TEXT NOT NULL,
+    locale TEXT NOT NULL,
+    internal_signature TEXT,
+    customer_id TEXT NOT NULL,
+    delivery_service TEXT NOT NULL,
+    shardkey TEXT NOT NULL,
+    sm_id INTEGER NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    oof_shard TEXT NOT NULL,
+    deleted_at TIMESTAMPTZ,
+    erased_at TIMESTAMPTZ
+);
+
+CREATE TABLE deliveries (
+    order_uid TEXT PRIMARY KEY REFERENCES orders(order_uid) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    phone TEXT NOT NULL,
+    zip TEXT NOT NULL,
+    city TEXT NOT NULL,
+    address TEXT NOT NULL,
+    region TEXT NOT NULL,
+    email TEXT NOT NULL
+);
+
+CREATE TABLE payments (
+    order_uid TEXT PRIMARY KEY REFERENCES orders(order_uid) ON DELETE CASCADE,
+    transaction TEXT NOT NULL UNIQUE,
+    request_id TEXT,
+    currency TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    amount INTEGER NOT NULL,
+    payment_dt BIGINT NOT NULL,
+    bank TEXT NOT NULL,
+    delivery_cost INTEGER NOT NULL,
+    goods_total INTEGER NOT NULL,
+    custom_fee INTEGER NOT NULL
+);
+
+CREATE TABLE products (
+    chrt_id INTEGER PRIMARY KEY,
+    track_number TEXT NOT NULL REFERENCES orders(track_number) ON DELETE CASCADE,
+    price INTEGER NOT NULL,
+    rid TEXT NOT NULL,
+    name TEXT NOT NULL,
+    sale INTEGER NOT NULL,
+    size TEXT NOT NULL,
+    total_price INTEGER NOT NULL,
+    nm_id INTEGER NOT NULL,
+    brand TEXT NOT NULL,
+    status INTEGER NOT NULL
+);
+
+CREATE INDEX idx_deliveries_order_uid ON deliveries(order_uid);
+CREATE INDEX idx_payments_order_uid ON payments(order_uid);
+CREATE INDEX idx_products_track_number ON products(track_number);
+CREATE INDEX idx_products_track_number_chrt_id ON products(track_number, chrt_id);
+CREATE INDEX idx_orders_live_date_created ON orders(date_created DESC) WHERE deleted_at IS NULL;
+
+INSERT INTO orders (
+    order_uid, track_number, entry, locale, internal_signature, customer_id,
+    delivery_service, shardkey, sm_id, date_created, oof_shard, deleted_at, erased_at
+)
+SELECT
+    order_uid, track_number, entry, locale, internal_signature, customer_id,
+    delivery_service, shardkey, sm_id, date_created, oof_shard, deleted_at, erased_at
+FROM orders_partitioned;
+
+INSERT INTO deliveries (order_uid, name, phone, zip, city, address, region, email)
+SELECT order_uid, name, phone, zip, city, address, region, email FROM deliveries_partitioned;
+
+INSERT INTO payments (
+    order_uid, transaction, request_id, currency, provider,
+    amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
+)
+SELECT
+    order_uid, transaction, request_id, currency, provider,
+    amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
+FROM payments_partitioned;
+
+INSERT INTO products (chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status)
+SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status FROM products_partitioned;
+
+DROP TABLE products_partitioned;
+DROP TABLE payments_partitioned;
+DROP TABLE deliveries_partitioned;
+DROP TABLE orders_partitioned;
@@ -0,0 +1,153 @@
+-- Range-partition orders and their children by month of the order's
+-- date_created. Children carry date_created so that a month of every table
+-- can be detached together. Keys include the partition key, so order_uid is
+-- kept unique by the repository instead of a constraint; foreign keys are
+-- dropped. Partitions are named <table>_pYYYY_MM and bounded in UTC; rows
+-- outside every month land in <table>_default.
+
+ALTER TABLE orders RENAME TO orders_unpartitioned;
+ALTER TABLE deliveries RENAME TO deliveries_unpartitioned;
+ALTER TABLE payments RENAME TO payments_unpartitioned;
+ALTER TABLE products RENAME TO products_unpartitioned;
+
+-- Free the constraint and index names for the new tables.
+ALTER TABLE orders_unpartitioned DROP CONSTRAINT orders_pkey CASCADE;
+ALTER TABLE orders_unpartitioned DROP CONSTRAINT orders_track_number_key CASCADE;
+ALTER TABLE deliveries_unpartitioned DROP CONSTRAINT deliveries_pkey;
+ALTER TABLE payments_unpartitioned DROP CONSTRAINT payments_pkey;
+ALTER TABLE payments_unpartitioned DROP CONSTRAINT payments_transaction_key;
+ALTER TABLE products_unpartitioned DROP CONSTRAINT products_pkey;
+DROP INDEX IF EXISTS idx_orders_live_date_created;
+DROP INDEX IF EXISTS idx_deliveries_order_uid;
+DROP INDEX IF EXISTS idx_payments_order_uid;
+DROP INDEX IF EXISTS idx_products_track_number;
+DROP INDEX IF EXISTS idx_products_track_number_chrt_id;
+
+CREATE TABLE orders (
+    order_uid TEXT NOT NULL,
+    track_number TEXT NOT NULL,
+    entry TEXT NOT NULL,
+    locale TEXT NOT NULL,
+    internal_signature TEXT,
+    customer_id TEXT NOT NULL,
+    delivery_service TEXT NOT NULL,
+    shardkey TEXT NOT NULL,
+    sm_id INTEGER NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    oof_shard TEXT NOT NULL,
+    deleted_at TIMESTAMPTZ,
+    erased_at TIMESTAMPTZ,
+    PRIMARY KEY (order_uid, date_created),
+    UNIQUE (track_number, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE TABLE deliveries (
+    order_uid TEXT NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    name TEXT NOT NULL,
+    phone TEXT NOT NULL,
+    zip TEXT NOT NULL,
+    city TEXT NOT NULL,
+    address TEXT NOT NULL,
+    region TEXT NOT NULL,
+    email TEXT NOT NULL,
+    PRIMARY KEY (order_uid, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE TABLE payments (
+    order_uid TEXT NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    transaction TEXT NOT NULL,
+    request_id TEXT,
+    currency TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    amount INTEGER NOT NULL,
+    payment_dt BIGINT NOT NULL,
+    bank TEXT NOT NULL,
+    delivery_cost INTEGER NOT NULL,
+    goods_total INTEGER NOT NULL,
+    custom_fee INTEGER NOT NULL,
+    PRIMARY KEY (order_uid, date_created),
+    UNIQUE (transaction, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE TABLE products (
+    chrt_id INTEGER NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL,
+    track_number TEXT NOT NULL,
+    price INTEGER NOT NULL,
+    rid TEXT NOT NULL,
+    name TEXT NOT NULL,
+    sale INTEGER NOT NULL,
+    size TEXT NOT NULL,
+    total_price INTEGER NOT NULL,
+    nm_id INTEGER NOT NULL,
+    brand TEXT NOT NULL,
+    status INTEGER NOT NULL,
+    PRIMARY KEY (chrt_id, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE INDEX idx_orders_live_date_created ON orders (date_created DESC) WHERE deleted_at IS NULL;
+CREATE INDEX idx_products_track_number_chrt_id ON products (track_number, chrt_id);
+
+-- Months from the oldest order through three months ahead; the maintenance
+-- job keeps creating months ahead from then on.
+DO $$
+DECLARE
+    m timestamp;
+    last timestamp := date_trunc('month', now() AT TIME ZONE 'UTC') + interval '3 months';
+    t text;
+BEGIN
+    SELECT date_trunc('month', COALESCE(min(date_created), now()) AT TIME ZONE 'UTC')
+    INTO m FROM orders_unpartitioned;
+    WHILE m <= last LOOP
+        FOREACH t IN ARRAY ARRAY['orders', 'deliveries', 'payments', 'products'] LOOP
+            EXECUTE format('CREATE TABLE %I PARTITION OF %I FOR VALUES FROM (%L) TO (%L)',
+                t || to_char(m, '"_p"YYYY_MM'), t, m::text || '+00', (m + interval '1 month')::text || '+00');
+        END LOOP;
+        m := m + interval '1 month';
+    END LOOP;
+END $$;
+
+CREATE TABLE orders_default PARTITION OF orders DEFAULT;
+CREATE TABLE deliveries_default PARTITION OF deliveries DEFAULT;
+CREATE TABLE payments_default PARTITION OF payments DEFAULT;
+CREATE TABLE products_default PARTITION OF products DEFAULT;
+
+INSERT INTO orders (
+    order_uid, track_number, entry, locale, internal_signature, customer_id,
+    delivery_service, shardkey, sm_id, date_created, oof_shard, deleted_at, erased_at
+)
+SELECT
+    order_uid, track_number, entry, locale, internal_signature, customer_id,
+    delivery_service, shardkey, sm_id, date_created, oof_shard, deleted_at, erased_at
+FROM orders_unpartitioned;
+
+INSERT INTO deliveries (order_uid, date_created, name, phone, zip, city, address, region, email)
+SELECT d.order_uid, o.date_created, d.name, d.phone, d.zip, d.city, d.address, d.region, d.email
+FROM deliveries_unpartitioned d
+JOIN orders_unpartitioned o ON o.order_uid = d.order_uid;
+
+INSERT INTO payments (
+    order_uid, date_created, transaction, request_id, currency, provider,
+    amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
+)
+SELECT
+    p.order_uid, o.date_created, p.transaction, p.request_id, p.currency, p.provider,
+    p.amount, p.payment_dt, p.bank, p.delivery_cost, p.goods_total, p.custom_fee
+FROM payments_unpartitioned p
+JOIN orders_unpartitioned o ON o.order_uid = p.order_uid;
+
+INSERT INTO products (
+    chrt_id, date_created, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+)
+SELECT
+    pr.chrt_id, o.date_created, pr.track_number, pr.price, pr.rid, pr.name, pr.sale, pr.size,
+    pr.total_price, pr.nm_id, pr.brand, pr.status
+FROM products_unpartitioned pr
+JOIN orders_unpartitioned o ON o.track_number = pr.track_number;
+
+DROP TABLE products_unpartitioned;
+DROP TABLE payments_unpartitioned;
+DROP TABLE deliveries_unpartitioned;
+DROP TABLE orders_unpartitioned;
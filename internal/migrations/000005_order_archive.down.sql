@@ -0,0 +1,3 @@
+-- Archive files stay in storage; only the index is dropped.
+
+DROP TABLE IF EXISTS order_archive;
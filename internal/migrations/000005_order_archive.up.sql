@@ -0,0 +1,10 @@
+-- Index of orders moved out of Postgres into archive files
+
+CREATE TABLE IF NOT EXISTS order_archive (
+    order_uid    TEXT PRIMARY KEY,
+    date_created TIMESTAMPTZ NOT NULL,
+    object_key   TEXT NOT NULL,
+    archived_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_archive_object_key ON order_archive (object_key);
@@ -0,0 +1,22 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS payload_version;
+
+DO $$
+DECLARE
+    part regclass;
+BEGIN
+    FOR part IN
+        SELECT c.oid::regclass
+        FROM pg_class c
+        JOIN pg_namespace n ON n.oid = c.relnamespace
+        WHERE c.relkind = 'r'
+          AND NOT c.relispartition
+          AND c.relname ~ '^orders_p\d{4}_\d{2}$'
+          AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+          AND EXISTS (
+              SELECT 1 FROM pg_attribute a
+              WHERE a.attrelid = c.oid AND a.attname = 'payload_version' AND NOT a.attisdropped
+          )
+    LOOP
+        EXECUTE format('ALTER TABLE %s DROP COLUMN payload_version', part);
+    END LOOP;
+END $$;
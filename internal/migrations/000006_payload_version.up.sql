@@ -0,0 +1,31 @@
+-- Payload version each order arrived in; NULL when unknown
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payload_version SMALLINT;
+
+-- Partitions detached by retention no longer follow the parent. They get the
+-- column too, so they can be attached again. They sit in the archive schema,
+-- whose name is configurable, so they are looked up by name in every schema.
+DO $$
+DECLARE
+    part regclass;
+BEGIN
+    FOR part IN
+        SELECT c.oid::regclass
+        FROM pg_class c
+        JOIN pg_namespace n ON n.oid = c.relnamespace
+        WHERE c.relkind = 'r'
+          AND NOT c.relispartition
+          AND c.relname ~ '^orders_p\d{4}_\d{2}$'
+          AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+          AND EXISTS (
+              SELECT 1 FROM pg_attribute a
+              WHERE a.attrelid = c.oid AND a.attname = 'order_uid' AND NOT a.attisdropped
+          )
+          AND NOT EXISTS (
+              SELECT 1 FROM pg_attribute a
+              WHERE a.attrelid = c.oid AND a.attname = 'payload_version' AND NOT a.attisdropped
+          )
+    LOOP
+        EXECUTE format('ALTER TABLE %s ADD COLUMN payload_version SMALLINT', part);
+    END LOOP;
+END $$;
@@ -0,0 +1,36 @@
+-- Registry of every order_uid ever saved. Keys of the partitioned tables
+-- include date_created and partitions dropped by retention leave the orders
+-- table, so order_uid uniqueness is kept here instead.
+
+CREATE TABLE IF NOT EXISTS order_uids (
+    order_uid TEXT PRIMARY KEY
+);
+
+INSERT INTO order_uids (order_uid)
+SELECT order_uid FROM orders
+UNION
+SELECT order_uid FROM order_archive
+ON CONFLICT DO NOTHING;
+
+-- Partitions detached by retention are moved to the archive schema, whose
+-- name is configurable, so they are looked up by name in every schema.
+DO $$
+DECLARE
+    part regclass;
+BEGIN
+    FOR part IN
+        SELECT c.oid::regclass
+        FROM pg_class c
+        JOIN pg_namespace n ON n.oid = c.relnamespace
+        WHERE c.relkind = 'r'
+          AND NOT c.relispartition
+          AND c.relname ~ '^orders_p\d{4}_\d{2}$'
+          AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+          AND EXISTS (
+              SELECT 1 FROM pg_attribute a
+              WHERE a.attrelid = c.oid AND a.attname = 'order_uid' AND NOT a.attisdropped
+          )
+    LOOP
+        EXECUTE format('INSERT INTO order_uids (order_uid) SELECT order_uid FROM %s ON CONFLICT DO NOTHING', part);
+    END LOOP;
+END $$;
@@ -0,0 +1,343 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// lockKey is the pg_advisory_lock key guarding migrations, so replicas
+// starting at the same time apply them one after another.
+const lockKey int64 = 0x4c30_6d69_6772
+
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes the schema state. Version 0 means nothing is applied.
+type Status struct {
+	Version uint   `json:"version"`
+	Dirty   bool   `json:"dirty"`
+	Latest  uint   `json:"latest"`
+	Pending []uint `json:"pending"`
+}
+
+// Load returns the migrations embedded in the binary.
+func Load() ([]Migration, error) {
+	return Parse(files)
+}
+
+// Parse reads NNNNNN_name.up.sql / NNNNNN_name.down.sql pairs from fsys and
+// returns them ordered by version.
+func Parse(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[uint]*Migration)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		m := fileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		v, err := strconv.ParseUint(m[1], 10, 32)
+		if err != nil || v == 0 {
+			return nil, fmt.Errorf("migration %s: invalid version", e.Name())
+		}
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[uint(v)]
+		if !ok {
+			mig = &Migration{Version: uint(v), Name: m[2]}
+			byVersion[uint(v)] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d: conflicting names %q and %q", v, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s: both up and down files are required", mig.Version, mig.Name)
+		}
+		result = append(result, *mig)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// Migrator applies embedded migrations. Its bookkeeping table has the same
+// layout as golang-migrate's schema_migrations, so databases migrated with the
+// migrate CLI are picked up as is.
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+}
+
+func NewMigrator(pool *pgxpool.Pool) (*Migrator, error) {
+	migs, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{pool: pool, migrations: migs}, nil
+}
+
+func (m *Migrator) Latest() uint {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	var (
+		st     Status
+		exists bool
+	)
+	// Read without the advisory lock so status and health checks do not block
+	// behind a running migration.
+	if err := m.pool.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return Status{}, err
+	}
+	if exists {
+		var err error
+		if st.Version, st.Dirty, err = currentVersion(ctx, m.pool); err != nil {
+			return Status{}, err
+		}
+	}
+	st.Latest = m.Latest()
+	st.Pending = make([]uint, 0)
+	for _, mig := range m.migrations {
+		if mig.Version > st.Version {
+			st.Pending = append(st.Pending, mig.Version)
+		}
+	}
+	return st, nil
+}
+
+// Check returns ErrSchemaBehind when the database is dirty or has pending
+// migrations. A schema newer than the binary is accepted.
+func (m *Migrator) Check(ctx context.Context) error {
+	st, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if st.Dirty {
+		return fmt.Errorf("%w: version %d is dirty", ErrSchemaBehind, st.Version)
+	}
+	if st.Version < st.Latest {
+		return fmt.Errorf("%w: version %d, binary expects %d", ErrSchemaBehind, st.Version, st.Latest)
+	}
+	return nil
+}
+
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.Goto(ctx, m.Latest())
+}
+
+// Down reverts the last steps migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("down: steps must be positive, got %d", steps)
+	}
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		version, dirty, err := currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("version %d is dirty, fix the schema and run force", version)
+		}
+		target := uint(0)
+		applied := m.appliedUpTo(version)
+		if steps < len(applied) {
+			target = applied[len(applied)-steps-1].Version
+		}
+		return m.migrate(ctx, conn, version, target)
+	})
+}
+
+// Goto migrates up or down to the given version. Version 0 reverts everything.
+func (m *Migrator) Goto(ctx context.Context, target uint) error {
+	if target != 0 && m.find(target) < 0 {
+		return fmt.Errorf("unknown migration version %d", target)
+	}
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		version, dirty, err := currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("version %d is dirty, fix the schema and run force", version)
+		}
+		return m.migrate(ctx, conn, version, target)
+	})
+}
+
+// Force sets the recorded version without running any migration and clears
+// the dirty flag. It is meant for manual recovery.
+func (m *Migrator) Force(ctx context.Context, version uint) error {
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback(ctx) }()
+		if err := setVersion(ctx, tx, version); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	})
+}
+
+func (m *Migrator) migrate(ctx context.Context, conn *pgxpool.Conn, from, to uint) error {
+	if to >= from {
+		for _, mig := range m.migrations {
+			if mig.Version <= from || mig.Version > to {
+				continue
+			}
+			if err := apply(ctx, conn, mig.Up, mig.Version); err != nil {
+				return fmt.Errorf("migration %d_%s up: %w", mig.Version, mig.Name, err)
+			}
+		}
+		return nil
+	}
+
+	applied := m.appliedUpTo(from)
+	for i := len(applied) - 1; i >= 0 && applied[i].Version > to; i-- {
+		prev := uint(0)
+		if i > 0 {
+			prev = applied[i-1].Version
+		}
+		if err := apply(ctx, conn, applied[i].Down, prev); err != nil {
+			return fmt.Errorf("migration %d_%s down: %w", applied[i].Version, applied[i].Name, err)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) appliedUpTo(version uint) []Migration {
+	n := 0
+	for n < len(m.migrations) && m.migrations[n].Version <= version {
+		n++
+	}
+	return m.migrations[:n]
+}
+
+func (m *Migrator) find(version uint) int {
+	for i, mig := range m.migrations {
+		if mig.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) (err error) {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	// Waiting for the lock and long migrations must not hit the pool's
+	// statement_timeout; the setting is restored before the connection is
+	// returned.
+	if _, err = conn.Exec(ctx, `SET statement_timeout = 0`); err != nil {
+		return err
+	}
+	defer func() {
+		if _, resetErr := conn.Exec(context.Background(), `RESET statement_timeout`); resetErr != nil {
+			conn.Conn().Close(context.Background())
+		}
+	}()
+
+	if _, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		if _, unlockErr := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey); unlockErr != nil && err == nil {
+			err = fmt.Errorf("release migration lock: %w", unlockErr)
+		}
+	}()
+
+	if _, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// apply runs one migration script and records the resulting version in the
+// same transaction, so a failed script leaves the schema untouched.
+func apply(ctx context.Context, conn *pgxpool.Conn, script string, version uint) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, script); err != nil {
+		return err
+	}
+	if err := setVersion(ctx, tx, version); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func currentVersion(ctx context.Context, conn interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}) (uint, bool, error) {
+	var (
+		version int64
+		dirty   bool
+	)
+	err := conn.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return uint(version), dirty, nil
+}
+
+func setVersion(ctx context.Context, tx pgx.Tx, version uint) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+	if version == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, int64(version))
+	return err
+}
@@ -3,6 +3,9 @@ package order
 import (
 	"context"
 
+	"L0/internal/audit"
+	"L0/internal/db"
+
 	kafkago "github.com/segmentio/kafka-go"
 )
 
@@ -10,26 +13,72 @@ type Cache interface {
 	Set(instance Order)
 	Get(key string) (*Order, bool)
 	GetRecent(limit int) []Order
+	Delete(key string)
 }
 
+// Logger is a leveled logger taking key-value attributes; *slog.Logger
+// satisfies it.
 type Logger interface {
-	Printf(format string, v ...any)
-	Println(v ...any)
+	DebugContext(ctx context.Context, msg string, args ...any)
+	InfoContext(ctx context.Context, msg string, args ...any)
+	WarnContext(ctx context.Context, msg string, args ...any)
+	ErrorContext(ctx context.Context, msg string, args ...any)
 }
 
+// AuditFunc records a write to an order in tx, the transaction of the write,
+// once the write is done. before and after are the order as it was and as it
+// is now, nil where there is none. An error rolls the write back.
+type AuditFunc func(ctx context.Context, tx db.Client, before, after *Order) error
+
+// Repository stores orders. Its writes take an AuditFunc, which may be nil to
+// leave them out of the audit log.
 type Repository interface {
-	Save(ctx context.Context, order Order) error
+	Save(ctx context.Context, order Order, opts SaveOptions, audit AuditFunc) (SaveResult, error)
+	SaveBatch(ctx context.Context, orders []Order, opts SaveOptions, audit AuditFunc) ([]SaveResult, []error, error)
 	GetById(ctx context.Context, orderId string) (Order, error)
 	GetLimit(ctx context.Context, limit int) ([]Order, error)
+	List(ctx context.Context, filter ListFilter) ([]Order, error)
+	Stream(ctx context.Context, filter ListFilter, fn func(Order) error) error
+	Delete(ctx context.Context, orderId string, audit AuditFunc) error
+	Erase(ctx context.Context, orderId string, audit AuditFunc) error
+	UpdateStatus(ctx context.Context, orderId string, status int, audit AuditFunc) error
+}
+
+// Archive keeps orders moved out of the database. Remove takes an order out
+// of it for good, passing the removal to audit when it is not nil. Both
+// return ErrOrderNotFound for orders that are not archived.
+type Archive interface {
+	Get(ctx context.Context, orderId string) (Order, error)
+	Remove(ctx context.Context, orderId string, audit AuditFunc) error
+}
+
+// Auditor keeps the audit log. Record and Redact write through client, the
+// transaction of the change they belong to.
+type Auditor interface {
+	Record(ctx context.Context, client db.Client, entry audit.Entry) error
+	History(ctx context.Context, orderUID string) ([]audit.Entry, error)
+	Redact(ctx context.Context, client db.Client, orderUID string, paths []string) error
 }
 
 type Writer interface {
 	WriteMessages(ctx context.Context, msgs ...kafkago.Message) error
 }
 
+// MessageEncoder encodes an order into a message value and its headers.
+type MessageEncoder interface {
+	EncodeMessage(ctx context.Context, order Order) (kafkago.Message, error)
+}
+
 type Service interface {
-	SaveOrder(ctx context.Context, order Order) error
+	SaveOrder(ctx context.Context, order Order, opts SaveOptions) (SaveResult, error)
+	SaveOrders(ctx context.Context, orders []Order, opts SaveOptions) ([]SaveResult, []error, error)
 	GetOrderById(ctx context.Context, orderId string) (Order, error)
 	GetOrdersLimit(ctx context.Context, limit int) ([]Order, error)
+	ListOrders(ctx context.Context, filter ListFilter) ([]Order, error)
+	ExportOrders(ctx context.Context, filter ListFilter, fn func(Order) error) error
 	CreateOrder(ctx context.Context) (Order, error)
+	DeleteOrder(ctx context.Context, orderId string) error
+	EraseOrder(ctx context.Context, orderId string) error
+	UpdateOrderStatus(ctx context.Context, orderId string, status int) error
+	GetOrderAudit(ctx context.Context, orderId string) ([]audit.Entry, error)
 }
@@ -2,6 +2,29 @@ package order
 
 import "time"
 
+// PersonalDataPaths lists JSON paths of Order holding personal data. They are
+// blanked by erasure, both in the order itself and in its audit history.
+var PersonalDataPaths = []string{"customer_id", "delivery.name", "delivery.phone", "delivery.address", "delivery.email"}
+
+// MaskedValue replaces personal data shown to callers without access to it.
+const MaskedValue = "***"
+
+// MaskPersonalData returns a copy of o with the values at PersonalDataPaths
+// masked. Empty values stay empty, so erased orders still look erased.
+func MaskPersonalData(o Order) Order {
+	mask := func(s *string) {
+		if *s != "" {
+			*s = MaskedValue
+		}
+	}
+	mask(&o.CustomerID)
+	mask(&o.Delivery.Name)
+	mask(&o.Delivery.Phone)
+	mask(&o.Delivery.Address)
+	mask(&o.Delivery.Email)
+	return o
+}
+
 type Order struct {
 	OrderUID          string    `json:"order_uid"`
 	TrackNumber       string    `json:"track_number"`
@@ -17,6 +40,11 @@ type Order struct {
 	SmID              int       `json:"sm_id"`
 	DateCreated       time.Time `json:"date_created"`
 	OofShard          string    `json:"oof_shard"`
+	// PayloadVersion is the payload version the order arrived in, 0 when
+	// unknown: saved before versions were recorded or not read from a
+	// payload, as CSV imports. It is not part of the API; archive files keep
+	// it.
+	PayloadVersion int `json:"-" parquet:"payload_version,optional"`
 }
 
 type Product struct {
@@ -0,0 +1,182 @@
+package order
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Order payloads are the JSON documents producers publish. Every version has
+// structs of its own that never change once released, and a payload is
+// decoded into the structs of its version. Version 1 is the only one so far.
+//
+// A payload names its version in "version". Documents without it were
+// published before the field existed; their layout is that of version 1.
+const CurrentPayloadVersion = 1
+
+// ErrUnsupportedPayloadVersion is returned for payloads of a version this
+// service does not know, newer ones included: their fields cannot be mapped.
+var ErrUnsupportedPayloadVersion = errors.New("unsupported payload version")
+
+// PayloadV1 is the order document as first published, now with its
+// version.
+type PayloadV1 struct {
+	Version           int        `json:"version"`
+	OrderUID          string     `json:"order_uid"`
+	TrackNumber       string     `json:"track_number"`
+	Entry             string     `json:"entry"`
+	Delivery          DeliveryV1 `json:"delivery"`
+	Payment           PaymentV1  `json:"payment"`
+	Items             []ItemV1   `json:"items"`
+	Locale            string     `json:"locale"`
+	InternalSignature string     `json:"internal_signature"`
+	CustomerID        string     `json:"customer_id"`
+	DeliveryService   string     `json:"delivery_service"`
+	ShardKey          string     `json:"shardkey"`
+	SmID              int        `json:"sm_id"`
+	DateCreated       time.Time  `json:"date_created"`
+	OofShard          string     `json:"oof_shard"`
+}
+
+type DeliveryV1 struct {
+	Name    string `json:"name"`
+	Phone   string `json:"phone"`
+	Zip     string `json:"zip"`
+	City    string `json:"city"`
+	Address string `json:"address"`
+	Region  string `json:"region"`
+	Email   string `json:"email"`
+}
+
+type PaymentV1 struct {
+	Transaction  string `json:"transaction"`
+	RequestID    string `json:"request_id"`
+	Currency     string `json:"currency"`
+	Provider     string `json:"provider"`
+	Amount       int    `json:"amount"`
+	PaymentDt    int64  `json:"payment_dt"`
+	Bank         string `json:"bank"`
+	DeliveryCost int    `json:"delivery_cost"`
+	GoodsTotal   int    `json:"goods_total"`
+	CustomFee    int    `json:"custom_fee"`
+}
+
+type ItemV1 struct {
+	ChrtID      int    `json:"chrt_id"`
+	TrackNumber string `json:"track_number"`
+	Price       int    `json:"price"`
+	Rid         string `json:"rid"`
+	Name        string `json:"name"`
+	Sale        int    `json:"sale"`
+	Size        string `json:"size"`
+	TotalPrice  int    `json:"total_price"`
+	NmID        int    `json:"nm_id"`
+	Brand       string `json:"brand"`
+	Status      int    `json:"status"`
+}
+
+// Order converts the current payload to the domain model.
+func (p PayloadV1) Order() Order {
+	products := make([]Product, len(p.Items))
+	for i, it := range p.Items {
+		products[i] = Product(it)
+	}
+	return Order{
+		OrderUID:          p.OrderUID,
+		TrackNumber:       p.TrackNumber,
+		Entry:             p.Entry,
+		Delivery:          Delivery(p.Delivery),
+		Payment:           Payment(p.Payment),
+		Products:          products,
+		Locale:            p.Locale,
+		InternalSignature: p.InternalSignature,
+		CustomerID:        p.CustomerID,
+		DeliveryService:   p.DeliveryService,
+		ShardKey:          p.ShardKey,
+		SmID:              p.SmID,
+		DateCreated:       p.DateCreated,
+		OofShard:          p.OofShard,
+	}
+}
+
+// NewPayload returns o as a payload of the current version.
+func NewPayload(o Order) PayloadV1 {
+	items := make([]ItemV1, len(o.Products))
+	for i, p := range o.Products {
+		items[i] = ItemV1(p)
+	}
+	return PayloadV1{
+		Version:           CurrentPayloadVersion,
+		OrderUID:          o.OrderUID,
+		TrackNumber:       o.TrackNumber,
+		Entry:             o.Entry,
+		Delivery:          DeliveryV1(o.Delivery),
+		Payment:           PaymentV1(o.Payment),
+		Items:             items,
+		Locale:            o.Locale,
+		InternalSignature: o.InternalSignature,
+		CustomerID:        o.CustomerID,
+		DeliveryService:   o.DeliveryService,
+		ShardKey:          o.ShardKey,
+		SmID:              o.SmID,
+		DateCreated:       o.DateCreated,
+		OofShard:          o.OofShard,
+	}
+}
+
+// MarshalPayload encodes o as a payload of the current version.
+func MarshalPayload(o Order) ([]byte, error) {
+	return json.Marshal(NewPayload(o))
+}
+
+// UnmarshalPayload decodes a payload of any known version into an Order
+// with PayloadVersion set. With strict, fields unknown to the version of
+// the payload are an error; otherwise they are ignored. On error the order
+// holds just the order_uid, when it could be read, for error reports.
+func UnmarshalPayload(data []byte, strict bool) (Order, error) {
+	var head struct {
+		Version  *int   `json:"version"`
+		OrderUID string `json:"order_uid"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return Order{}, err
+	}
+	failed := Order{OrderUID: head.OrderUID}
+	version := 1
+	if head.Version != nil {
+		version = *head.Version
+	}
+
+	// Each version decodes into its own structs.
+	var p PayloadV1
+	switch version {
+	case 1:
+		if err := decodePayload(data, &p, strict); err != nil {
+			return failed, err
+		}
+	default:
+		return failed, fmt.Errorf("%w %d, the latest known is %d", ErrUnsupportedPayloadVersion, version, CurrentPayloadVersion)
+	}
+	o := p.Order()
+	o.PayloadVersion = version
+	return o, nil
+}
+
+func decodePayload(data []byte, v any, strict bool) error {
+	if !strict {
+		return json.Unmarshal(data, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	// Unmarshal rejects data after the document; keep strict mode as strict.
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid data after the payload")
+	}
+	return nil
+}
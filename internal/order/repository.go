@@ -3,45 +3,334 @@ package order
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"L0/internal/db"
 
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var ErrOrderNotFound = errors.New("order not found")
+
+// SaveResult tells what Save did with the order.
+type SaveResult int
+
+const (
+	SaveSkipped SaveResult = iota
+	SaveInserted
+	SaveUpdated
+)
+
+func (r SaveResult) String() string {
+	switch r {
+	case SaveInserted:
+		return "inserted"
+	case SaveUpdated:
+		return "updated"
+	default:
+		return "skipped"
+	}
+}
+
+// ConflictPolicy decides what Save does when the order already exists.
+type ConflictPolicy string
+
+const (
+	// ConflictSkip keeps the stored order untouched.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces the stored order, its delivery, payment and
+	// items. Deleted and erased orders are never overwritten.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+)
+
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case ConflictSkip, ConflictOverwrite:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q", s)
+}
+
+type SaveOptions struct {
+	// Policy overrides the configured conflict policy when set.
+	Policy ConflictPolicy
+	// DryRun runs every statement and reports the result, then rolls back.
+	DryRun bool
+}
+
+// ListFilter selects live orders. From (inclusive) and To (exclusive) bound
+// date_created when set.
+type ListFilter struct {
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
+// OrderRepository writes to the primary of the cluster and reads from its
+// replicas when they are healthy. Reads after a write in the same session
+// (see db.WithSession) go to the primary.
 type OrderRepository struct {
-	client db.Client
-	logger Logger
+	client  db.Client
+	cluster *db.Cluster
+	logger  Logger
 }
 
-func NewOrderRepository(client *pgxpool.Pool, logger Logger) *OrderRepository {
-	return &OrderRepository{client: client, logger: logger}
+func NewOrderRepository(cluster *db.Cluster, logger Logger) *OrderRepository {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &OrderRepository{client: cluster.Primary(), cluster: cluster, logger: logger}
+}
+
+// rollback aborts tx, logging failures other than the tx being already closed.
+func (r *OrderRepository) rollback(ctx context.Context, tx pgx.Tx) {
+	if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+		r.logger.WarnContext(ctx, "transaction rollback failed", "error", err)
+	}
 }
 
-func (r *OrderRepository) Save(ctx context.Context, order Order) (err error) {
+func (r *OrderRepository) Save(ctx context.Context, order Order, opts SaveOptions, audit AuditFunc) (SaveResult, error) {
 	tx, err := r.client.Begin(ctx)
 	if err != nil {
-		return err
+		return SaveSkipped, err
 	}
-	defer func() {
+	// Rollback is a no-op after a successful commit.
+	defer r.rollback(ctx, tx)
+
+	if err := lockOrders(ctx, tx, []string{order.OrderUID}); err != nil {
+		return SaveSkipped, err
+	}
+	before, err := beforeImages(ctx, tx, []string{order.OrderUID}, opts.Policy, audit)
+	if err != nil {
+		return SaveSkipped, err
+	}
+	result, err := saveOrder(ctx, tx, order, opts.Policy, audit, before[order.OrderUID])
+	if err != nil || result == SaveSkipped {
+		return SaveSkipped, err
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return SaveSkipped, err
+	}
+	db.MarkWritten(ctx)
+	return result, nil
+}
+
+// SaveBatch saves orders in one transaction, each under a savepoint, so an
+// order that fails is rolled back alone and reported at its index in errs
+// with SaveSkipped. err is set when the batch as a whole fails, in which
+// case nothing is saved. An order whose audit fails is reported like one
+// whose save failed.
+func (r *OrderRepository) SaveBatch(ctx context.Context, orders []Order, opts SaveOptions, audit AuditFunc) (results []SaveResult, errs []error, err error) {
+	tx, err := r.client.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.rollback(ctx, tx)
+
+	uids := make([]string, len(orders))
+	for i, o := range orders {
+		uids[i] = o.OrderUID
+	}
+	if err := lockOrders(ctx, tx, uids); err != nil {
+		return nil, nil, err
+	}
+	before, err := beforeImages(ctx, tx, uids, opts.Policy, audit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results = make([]SaveResult, len(orders))
+	errs = make([]error, len(orders))
+	for i, o := range orders {
+		sp, err := tx.Begin(ctx)
 		if err != nil {
-			_ = tx.Rollback(ctx)
+			return nil, nil, err
 		}
-	}()
+		results[i], errs[i] = saveOrder(ctx, sp, o, opts.Policy, audit, before[o.OrderUID])
+		if errs[i] != nil {
+			results[i] = SaveSkipped
+			if err := sp.Rollback(ctx); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if err := sp.Commit(ctx); err != nil {
+			return nil, nil, err
+		}
+		if before != nil && results[i] != SaveSkipped {
+			// A later copy of the order in the batch overwrites this one.
+			before[o.OrderUID] = &orders[i]
+		}
+	}
+	if opts.DryRun {
+		return results, errs, nil
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+	db.MarkWritten(ctx)
+	return results, errs, nil
+}
+
+// lockOrders takes the transaction-scoped locks serializing saves of the
+// orders. Keys of the partitioned tables include date_created, so no
+// constraint on orders keeps order_uid unique; the lock keeps the reads of a
+// save consistent with the order_uids registry. Taking them in a fixed order
+// keeps concurrent batches with common orders from deadlocking.
+func lockOrders(ctx context.Context, tx pgx.Tx, uids []string) error {
+	_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended(u, 0)) FROM unnest($1::text[]) AS u ORDER BY u`, uids)
+	return err
+}
+
+// beforeImages loads the live orders among uids, which the caller has
+// locked, as they are before being overwritten. It is nil unless saves under
+// policy replace orders and are audited.
+func beforeImages(ctx context.Context, tx pgx.Tx, uids []string, policy ConflictPolicy, audit AuditFunc) (map[string]*Order, error) {
+	if policy != ConflictOverwrite || audit == nil {
+		return nil, nil
+	}
+	query := `
+		SELECT ` + orderColumns + `
+		FROM orders
+		WHERE order_uid = ANY($1) AND deleted_at IS NULL
+	`
+	orders, err := loadOrders(ctx, tx, query, uids)
+	if err != nil {
+		return nil, err
+	}
+	images := make(map[string]*Order, len(orders))
+	for i := range orders {
+		images[orders[i].OrderUID] = &orders[i]
+	}
+	return images, nil
+}
+
+// saveOrder writes the order and its children in tx according to policy,
+// then passes the write to audit when it is not nil, with before, the order
+// it overwrote. The caller holds the order's lock.
+func saveOrder(ctx context.Context, tx pgx.Tx, order Order, policy ConflictPolicy, audit AuditFunc, before *Order) (SaveResult, error) {
+	var result SaveResult
+	var err error
+	if policy == ConflictOverwrite {
+		result, err = replaceOrder(ctx, tx, order)
+	} else {
+		result, err = insertOrder(ctx, tx, order)
+	}
+	if err != nil || result == SaveSkipped {
+		return SaveSkipped, err
+	}
 
+	if err := saveDelivery(ctx, tx, order); err != nil {
+		return SaveSkipped, err
+	}
+	if err := savePayment(ctx, tx, order); err != nil {
+		return SaveSkipped, err
+	}
+	if err := insertProducts(ctx, tx, order); err != nil {
+		return SaveSkipped, err
+	}
+	if audit != nil {
+		if result == SaveInserted {
+			before = nil
+		}
+		if err := audit(ctx, tx, before, &order); err != nil {
+			return SaveSkipped, err
+		}
+	}
+	return result, nil
+}
+
+// insertOrder inserts the order unless its order_uid has ever been saved:
+// the order_uids registry outlives deletion, archiving and partitions
+// detached by retention.
+func insertOrder(ctx context.Context, tx pgx.Tx, order Order) (SaveResult, error) {
+	tag, err := tx.Exec(ctx, `INSERT INTO order_uids (order_uid) VALUES ($1) ON CONFLICT DO NOTHING`, order.OrderUID)
+	if err != nil {
+		return SaveSkipped, err
+	}
+	if tag.RowsAffected() == 0 {
+		return SaveSkipped, nil
+	}
+	inserted, err := insertOrderRow(ctx, tx, order)
+	if err != nil {
+		return SaveSkipped, err
+	}
+	if !inserted {
+		// The track number is taken; the uid stays free for a later save.
+		_, err = tx.Exec(ctx, `DELETE FROM order_uids WHERE order_uid = $1`, order.OrderUID)
+		return SaveSkipped, err
+	}
+	return SaveInserted, nil
+}
+
+// replaceOrder inserts the order or replaces a live one with its delivery,
+// payment and items. The old rows are deleted rather than updated, since a
+// changed date_created moves the order to another partition.
+func replaceOrder(ctx context.Context, tx pgx.Tx, order Order) (SaveResult, error) {
+	var (
+		dateCreated time.Time
+		trackNumber string
+		dead        bool
+	)
+	err := tx.QueryRow(ctx, `
+		SELECT date_created, track_number, deleted_at IS NOT NULL OR erased_at IS NOT NULL
+		FROM orders WHERE order_uid = $1
+	`, order.OrderUID).Scan(&dateCreated, &trackNumber, &dead)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return insertOrder(ctx, tx, order)
+	case err != nil:
+		return SaveSkipped, err
+	case dead:
+		return SaveSkipped, nil
+	}
+
+	cleanup := []struct {
+		query string
+		key   string
+	}{
+		{`DELETE FROM products WHERE track_number = $1 AND date_created = $2`, trackNumber},
+		{`DELETE FROM deliveries WHERE order_uid = $1 AND date_created = $2`, order.OrderUID},
+		{`DELETE FROM payments WHERE order_uid = $1 AND date_created = $2`, order.OrderUID},
+		{`DELETE FROM orders WHERE order_uid = $1 AND date_created = $2`, order.OrderUID},
+	}
+	for _, c := range cleanup {
+		if _, err := tx.Exec(ctx, c.query, c.key, dateCreated); err != nil {
+			return SaveSkipped, err
+		}
+	}
+	inserted, err := insertOrderRow(ctx, tx, order)
+	if err != nil || !inserted {
+		return SaveSkipped, err
+	}
+	return SaveUpdated, nil
+}
+
+// insertOrderRow reports false when the track number is taken in the month.
+func insertOrderRow(ctx context.Context, tx pgx.Tx, order Order) (bool, error) {
 	orderQuery := `
 		INSERT INTO orders (
 			order_uid, track_number, entry,
 			locale, internal_signature, customer_id,
 			delivery_service, shardkey, sm_id,
-			date_created, oof_shard
-		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) ON CONFLICT DO NOTHING
+			date_created, oof_shard, payload_version
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12) ON CONFLICT DO NOTHING
 	`
-	_, err = tx.Exec(ctx, orderQuery,
+	tag, err := tx.Exec(ctx, orderQuery, orderArgs(order)...)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func orderArgs(order Order) []any {
+	return []any{
 		order.OrderUID,
 		order.TrackNumber,
 		order.Entry,
@@ -53,18 +342,19 @@ func (r *OrderRepository) Save(ctx context.Context, order Order) (err error) {
 		order.SmID,
 		order.DateCreated,
 		order.OofShard,
-	)
-	if err != nil {
-		return err
+		sql.NullInt16{Int16: int16(order.PayloadVersion), Valid: order.PayloadVersion != 0},
 	}
+}
 
+func saveDelivery(ctx context.Context, tx pgx.Tx, order Order) error {
 	deliveryQuery := `
         INSERT INTO deliveries (
-            order_uid, name, phone, zip, city, address, region, email
-        ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8) ON CONFLICT DO NOTHING
+            order_uid, date_created, name, phone, zip, city, address, region, email
+        ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) ON CONFLICT DO NOTHING
     `
-	_, err = tx.Exec(ctx, deliveryQuery,
+	_, err := tx.Exec(ctx, deliveryQuery,
 		order.OrderUID,
+		order.DateCreated,
 		order.Delivery.Name,
 		order.Delivery.Phone,
 		order.Delivery.Zip,
@@ -73,18 +363,19 @@ func (r *OrderRepository) Save(ctx context.Context, order Order) (err error) {
 		order.Delivery.Region,
 		order.Delivery.Email,
 	)
-	if err != nil {
-		return err
-	}
+	return err
+}
 
+func savePayment(ctx context.Context, tx pgx.Tx, order Order) error {
 	paymentQuery := `
         INSERT INTO payments (
-            order_uid, transaction, request_id, currency, provider,
+            order_uid, date_created, transaction, request_id, currency, provider,
             amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
-        ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) ON CONFLICT DO NOTHING
+        ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12) ON CONFLICT DO NOTHING
     `
-	_, err = tx.Exec(ctx, paymentQuery,
+	_, err := tx.Exec(ctx, paymentQuery,
 		order.OrderUID,
+		order.DateCreated,
 		order.Payment.Transaction,
 		order.Payment.RequestID,
 		order.Payment.Currency,
@@ -96,214 +387,468 @@ func (r *OrderRepository) Save(ctx context.Context, order Order) (err error) {
 		order.Payment.GoodsTotal,
 		order.Payment.CustomFee,
 	)
-	if err != nil {
+	return err
+}
+
+// insertProducts stores the items in the partition of the order.
+func insertProducts(ctx context.Context, tx pgx.Tx, order Order) error {
+	products := order.Products
+	if len(products) == 0 {
+		return nil
+	}
+	// The table outlives one order when a batch saves several in the same
+	// transaction.
+	createTemp := `CREATE TEMP TABLE IF NOT EXISTS temp_products (
+		chrt_id int,
+		date_created timestamptz,
+		track_number text,
+		price int,
+		rid text,
+		name text,
+		sale int,
+		size text,
+		total_price int,
+		nm_id int,
+		brand text,
+		status int
+	) ON COMMIT DROP;`
+	if _, err := tx.Exec(ctx, createTemp); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `TRUNCATE temp_products`); err != nil {
 		return err
 	}
 
-	if len(order.Products) > 0 {
-		createTemp := `CREATE TEMP TABLE temp_products (
-			chrt_id int,
-			track_number text,
-			price int,
-			rid text,
-			name text,
-			sale int,
-			size text,
-			total_price int,
-			nm_id int,
-			brand text,
-			status int
-		) ON COMMIT DROP;`
-		if _, err = tx.Exec(ctx, createTemp); err != nil {
-			return err
-		}
-
-		cols := []string{"chrt_id", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status"}
-		rows := make([][]interface{}, 0, len(order.Products))
-		for _, product := range order.Products {
-			rows = append(rows, []interface{}{
-				product.ChrtID,
-				product.TrackNumber,
-				product.Price,
-				product.Rid,
-				product.Name,
-				product.Sale,
-				product.Size,
-				product.TotalPrice,
-				product.NmID,
-				product.Brand,
-				product.Status,
-			})
-		}
-
-		if _, err = tx.CopyFrom(ctx, pgx.Identifier{"temp_products"}, cols, pgx.CopyFromRows(rows)); err != nil {
-			return err
-		}
+	cols := []string{"chrt_id", "date_created", "track_number", "price", "rid", "name", "sale", "size", "total_price", "nm_id", "brand", "status"}
+	rows := make([][]interface{}, 0, len(products))
+	for _, product := range products {
+		rows = append(rows, []interface{}{
+			product.ChrtID,
+			order.DateCreated,
+			product.TrackNumber,
+			product.Price,
+			product.Rid,
+			product.Name,
+			product.Sale,
+			product.Size,
+			product.TotalPrice,
+			product.NmID,
+			product.Brand,
+			product.Status,
+		})
+	}
 
-		upsert := `INSERT INTO products (chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status)
-		SELECT chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status FROM temp_products
-		ON CONFLICT DO NOTHING;`
-		if _, err = tx.Exec(ctx, upsert); err != nil {
-			return err
-		}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"temp_products"}, cols, pgx.CopyFromRows(rows)); err != nil {
+		return err
 	}
 
-	err = tx.Commit(ctx)
+	upsert := `INSERT INTO products (chrt_id, date_created, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status)
+	SELECT chrt_id, date_created, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status FROM temp_products
+	ON CONFLICT DO NOTHING;`
+	_, err := tx.Exec(ctx, upsert)
 	return err
 }
 
+// GetById reads from a replica and retries on the primary if the order is
+// missing there, since it may not have replicated yet.
 func (r *OrderRepository) GetById(ctx context.Context, orderId string) (Order, error) {
+	var ord Order
+	err := r.cluster.Read(ctx, func(client db.Client) error {
+		var err error
+		ord, err = getById(ctx, client, orderId)
+		return err
+	})
+	return ord, err
+}
+
+func getById(ctx context.Context, client db.Client, orderId string) (Order, error) {
 	query := `
-		SELECT 
-			o.order_uid, o.track_number, o.entry,
-			o.locale, o.internal_signature, o.customer_id,
-			o.delivery_service, o.shardkey, o.sm_id,
-			o.date_created, o.oof_shard,
-			to_jsonb(d.*) AS delivery,
-			to_jsonb(p.*) AS payment,
-			COALESCE(json_agg(pr.*) FILTER (WHERE pr.chrt_id IS NOT NULL), '[]') AS products
-		FROM orders o
-		LEFT JOIN deliveries d ON o.order_uid = d.order_uid
-		LEFT JOIN payments p ON o.order_uid = p.order_uid
-		LEFT JOIN products pr ON o.track_number = pr.track_number
-		WHERE o.order_uid = $1
-		GROUP BY o.order_uid, d.*, p.*;
+		SELECT ` + orderColumns + `
+		FROM orders
+		WHERE order_uid = $1 AND deleted_at IS NULL
 	`
+	orders, err := loadOrders(ctx, client, query, orderId)
+	if err != nil {
+		return Order{}, err
+	}
+	if len(orders) == 0 {
+		return Order{}, ErrOrderNotFound
+	}
+	return orders[0], nil
+}
 
-	row := r.client.QueryRow(ctx, query, orderId)
+// LiveIDs returns the order_uids among ids of orders that are neither
+// deleted nor erased. It reads the primary: a lagging replica could still
+// show an order deleted since.
+func (r *OrderRepository) LiveIDs(ctx context.Context, ids []string) ([]string, error) {
+	rows, err := r.client.Query(db.WithPrimary(ctx), `
+		SELECT order_uid FROM orders
+		WHERE order_uid = ANY($1) AND deleted_at IS NULL AND erased_at IS NULL
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
 
-	var (
-		orderUID, trackNumber, entry, locale, internalSignature, customerID,
-		deliveryService, shardKey, oofShard sql.NullString
-		smID                                    sql.NullInt64
-		dateCreated                             time.Time
-		deliveryJSON, paymentJSON, productsJSON []byte
-	)
+func (r *OrderRepository) GetLimit(ctx context.Context, limit int) ([]Order, error) {
+	return r.List(ctx, ListFilter{Limit: limit})
+}
+
+// List returns live orders matching filter, newest first. Bounds on
+// date_created let Postgres skip the partitions of other months.
+func (r *OrderRepository) List(ctx context.Context, filter ListFilter) ([]Order, error) {
+	var result []Order
+	err := r.cluster.Read(ctx, func(client db.Client) error {
+		var err error
+		result, err = listOrders(ctx, client, filter)
+		return err
+	})
+	return result, err
+}
+
+func listOrders(ctx context.Context, client db.Client, filter ListFilter) ([]Order, error) {
+	query, args := listQuery(filter)
+	return loadOrders(ctx, client, query, args...)
+}
 
-	if err := row.Scan(&orderUID, &trackNumber, &entry, &locale, &internalSignature, &customerID,
-		&deliveryService, &shardKey, &smID, &dateCreated, &oofShard,
-		&deliveryJSON, &paymentJSON, &productsJSON); err != nil {
-		if err == sql.ErrNoRows {
-			return Order{}, fmt.Errorf("order not found")
+// listQuery selects the orderColumns of the orders matching filter, newest
+// first. A Limit of zero or less selects all of them.
+func listQuery(filter ListFilter) (string, []any) {
+	// Bounds are added only when set: a condition like "$1 IS NULL OR
+	// date_created >= $1" would defeat partition pruning.
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE deleted_at IS NULL`
+	var args []any
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		query += fmt.Sprintf(" AND date_created >= $%d", len(args))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		query += fmt.Sprintf(" AND date_created < $%d", len(args))
+	}
+	query += " ORDER BY date_created DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	return query, args
+}
+
+// streamPage is the number of orders fetched from the cursor of Stream at a
+// time.
+const streamPage = 500
+
+// Stream calls fn with each live order matching filter, newest first, as
+// pages of it are fetched from a server-side cursor, so memory use does not
+// grow with the result. All pages come from one snapshot. Stream stops at
+// the first error of fn and returns it. Unlike List it is not retried on the
+// primary, as fn may have already sent orders on.
+func (r *OrderRepository) Stream(ctx context.Context, filter ListFilter, fn func(Order) error) error {
+	tx, err := r.cluster.ReadClient(ctx).Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// The transaction only reads; ending it also closes the cursor.
+	defer r.rollback(context.WithoutCancel(ctx), tx)
+	if _, err := tx.Exec(ctx, `SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY`); err != nil {
+		return err
+	}
+	query, args := listQuery(filter)
+	if _, err := tx.Exec(ctx, `DECLARE orders_stream NO SCROLL CURSOR FOR `+query, args...); err != nil {
+		return err
+	}
+	fetch := fmt.Sprintf(`FETCH %d FROM orders_stream`, streamPage)
+	for {
+		rows, err := tx.Query(ctx, fetch)
+		if err != nil {
+			return err
+		}
+		orders, err := pgx.CollectRows(rows, scanOrder)
+		if err != nil {
+			return fmt.Errorf("scan orders: %w", err)
+		}
+		if err := loadChildren(ctx, tx, orders); err != nil {
+			return err
+		}
+		for _, o := range orders {
+			if err := fn(o); err != nil {
+				return err
+			}
+		}
+		if len(orders) < streamPage {
+			return nil
 		}
-		return Order{}, err
 	}
+}
 
-	ord := Order{}
-	ord.OrderUID = orderUID.String
-	ord.TrackNumber = trackNumber.String
-	ord.Entry = entry.String
-	ord.Locale = locale.String
-	ord.InternalSignature = internalSignature.String
-	ord.CustomerID = customerID.String
-	ord.DeliveryService = deliveryService.String
-	ord.ShardKey = shardKey.String
-	if smID.Valid {
-		ord.SmID = int(smID.Int64)
+// orderColumns are the columns of orders read by scanOrder, in its order.
+const orderColumns = `
+	order_uid, track_number, entry,
+	locale, internal_signature, customer_id,
+	delivery_service, shardkey, sm_id,
+	date_created, oof_shard, payload_version`
+
+// loadOrders runs query, which selects orderColumns, and fills in the
+// delivery, payment and items of every order it returns. As with any
+// multi-statement read outside a transaction, an order overwritten in
+// between may come back with its newer items.
+func loadOrders(ctx context.Context, client db.Client, query string, args ...any) ([]Order, error) {
+	rows, err := client.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := pgx.CollectRows(rows, scanOrder)
+	if err != nil {
+		return nil, fmt.Errorf("scan orders: %w", err)
+	}
+	if err := loadChildren(ctx, client, orders); err != nil {
+		return nil, err
 	}
-	ord.DateCreated = dateCreated
-	ord.OofShard = oofShard.String
+	return orders, nil
+}
 
-	if len(deliveryJSON) > 0 {
-		var d Delivery
-		if err := json.Unmarshal(deliveryJSON, &d); err == nil {
-			ord.Delivery = d
+// loadChildren fills in the delivery, payment and items of orders with one
+// batch of three set-based queries, one round trip whatever the page size.
+func loadChildren(ctx context.Context, client db.Client, orders []Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	uids := make([]string, len(orders))
+	byUID := make(map[string]*Order, len(orders))
+	// The children share the partitioning of orders; the date range of the
+	// page limits their queries to the same months.
+	oldest, newest := orders[0].DateCreated, orders[0].DateCreated
+	for i := range orders {
+		o := &orders[i]
+		o.Products = []Product{}
+		uids[i] = o.OrderUID
+		byUID[o.OrderUID] = o
+		if o.DateCreated.Before(oldest) {
+			oldest = o.DateCreated
+		}
+		if o.DateCreated.After(newest) {
+			newest = o.DateCreated
 		}
 	}
-	if len(paymentJSON) > 0 {
+
+	batch := &pgx.Batch{}
+	batch.Queue(`
+		SELECT order_uid, name, phone, zip, city, address, region, email
+		FROM deliveries
+		WHERE order_uid = ANY($1) AND date_created BETWEEN $2 AND $3
+	`, uids, oldest, newest).Query(func(rows pgx.Rows) error {
+		var uid string
+		var d Delivery
+		_, err := pgx.ForEachRow(rows, []any{&uid, &d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email}, func() error {
+			if o, ok := byUID[uid]; ok {
+				o.Delivery = d
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("scan deliveries: %w", err)
+		}
+		return nil
+	})
+	batch.Queue(`
+		SELECT order_uid, transaction, request_id, currency, provider,
+			amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
+		FROM payments
+		WHERE order_uid = ANY($1) AND date_created BETWEEN $2 AND $3
+	`, uids, oldest, newest).Query(func(rows pgx.Rows) error {
+		var uid string
+		var requestID sql.NullString
 		var p Payment
-		if err := json.Unmarshal(paymentJSON, &p); err == nil {
-			ord.Payment = p
+		_, err := pgx.ForEachRow(rows, []any{&uid, &p.Transaction, &requestID, &p.Currency, &p.Provider,
+			&p.Amount, &p.PaymentDt, &p.Bank, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee}, func() error {
+			if o, ok := byUID[uid]; ok {
+				p.RequestID = requestID.String
+				o.Payment = p
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("scan payments: %w", err)
+		}
+		return nil
+	})
+	// Items reference their order by track_number and date_created, which
+	// are unique together; a track number alone may recur in other months.
+	batch.Queue(`
+		SELECT o.order_uid, p.chrt_id, p.track_number, p.price, p.rid, p.name, p.sale, p.size,
+			p.total_price, p.nm_id, p.brand, p.status
+		FROM products p
+		JOIN orders o ON o.track_number = p.track_number AND o.date_created = p.date_created
+		WHERE o.order_uid = ANY($1) AND o.date_created BETWEEN $2 AND $3
+			AND p.date_created BETWEEN $2 AND $3
+		ORDER BY o.order_uid, p.chrt_id
+	`, uids, oldest, newest).Query(func(rows pgx.Rows) error {
+		var uid string
+		var p Product
+		_, err := pgx.ForEachRow(rows, []any{&uid, &p.ChrtID, &p.TrackNumber, &p.Price, &p.Rid, &p.Name,
+			&p.Sale, &p.Size, &p.TotalPrice, &p.NmID, &p.Brand, &p.Status}, func() error {
+			if o, ok := byUID[uid]; ok {
+				o.Products = append(o.Products, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("scan products: %w", err)
+		}
+		return nil
+	})
+	return client.SendBatch(ctx, batch).Close()
+}
+
+func scanOrder(row pgx.CollectableRow) (Order, error) {
+	var o Order
+	var internalSignature sql.NullString
+	var payloadVersion sql.NullInt16
+	err := row.Scan(&o.OrderUID, &o.TrackNumber, &o.Entry,
+		&o.Locale, &internalSignature, &o.CustomerID,
+		&o.DeliveryService, &o.ShardKey, &o.SmID,
+		&o.DateCreated, &o.OofShard, &payloadVersion)
+	o.InternalSignature = internalSignature.String
+	o.PayloadVersion = int(payloadVersion.Int16)
+	return o, err
+}
+
+// Delete marks the order as deleted. The row and its children stay in place,
+// but GetById and GetLimit no longer return it.
+func (r *OrderRepository) Delete(ctx context.Context, orderId string, audit AuditFunc) (err error) {
+	tx, err := r.client.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			r.rollback(ctx, tx)
 		}
+	}()
+
+	before, err := lockLive(ctx, tx, orderId)
+	if err != nil {
+		return err
 	}
-	if len(productsJSON) > 0 {
-		var prods []Product
-		if err := json.Unmarshal(productsJSON, &prods); err == nil {
-			ord.Products = prods
+	if _, err = tx.Exec(ctx, `UPDATE orders SET deleted_at = now() WHERE order_uid = $1 AND date_created = $2`, orderId, before.DateCreated); err != nil {
+		return err
+	}
+	if audit != nil {
+		if err = audit(ctx, tx, &before, nil); err != nil {
+			return err
 		}
 	}
 
-	return ord, nil
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+	db.MarkWritten(ctx)
+	return nil
 }
 
-func (r *OrderRepository) GetLimit(ctx context.Context, limit int) ([]Order, error) {
-	query := `
-		SELECT
-			o.order_uid, o.track_number, o.entry,
-			o.locale, o.internal_signature, o.customer_id,
-			o.delivery_service, o.shardkey, o.sm_id,
-			o.date_created, o.oof_shard,
-			to_jsonb(d.*) AS delivery,
-			to_jsonb(p.*) AS payment,
-			COALESCE(json_agg(pr.*) FILTER (WHERE pr.chrt_id IS NOT NULL), '[]') AS products
-		FROM orders o
-		LEFT JOIN deliveries d ON o.order_uid = d.order_uid
-		LEFT JOIN payments p ON o.order_uid = p.order_uid
-		LEFT JOIN products pr ON o.track_number = pr.track_number
-		GROUP BY o.order_uid, d.*, p.*
-		ORDER BY o.date_created DESC
-		LIMIT $1
-	`
-
-	rows, err := r.client.Query(ctx, query, limit)
+// Erase scrubs personal data of the order (delivery contacts and customer_id)
+// and marks it deleted. Payments and products are kept for financial records.
+// audit gets no snapshots, as they would hold the erased data.
+func (r *OrderRepository) Erase(ctx context.Context, orderId string, audit AuditFunc) (err error) {
+	tx, err := r.client.Begin(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-
-	result := make([]Order, 0)
-	for rows.Next() {
-		var (
-			orderUID, trackNumber, entry, locale, internalSignature, customerID,
-			deliveryService, shardKey, oofShard sql.NullString
-			smID                                    sql.NullInt64
-			dateCreated                             time.Time
-			deliveryJSON, paymentJSON, productsJSON []byte
-		)
-
-		if err := rows.Scan(&orderUID, &trackNumber, &entry, &locale, &internalSignature, &customerID,
-			&deliveryService, &shardKey, &smID, &dateCreated, &oofShard,
-			&deliveryJSON, &paymentJSON, &productsJSON); err != nil {
-			return nil, err
+	defer func() {
+		if err != nil {
+			r.rollback(ctx, tx)
 		}
+	}()
+
+	orderQuery := `
+		UPDATE orders SET
+			customer_id = '',
+			erased_at = COALESCE(erased_at, now()),
+			deleted_at = COALESCE(deleted_at, now())
+		WHERE order_uid = $1
+	`
+	tag, err := tx.Exec(ctx, orderQuery, orderId)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrOrderNotFound
+	}
 
-		ord := Order{}
-		ord.OrderUID = orderUID.String
-		ord.TrackNumber = trackNumber.String
-		ord.Entry = entry.String
-		ord.Locale = locale.String
-		ord.InternalSignature = internalSignature.String
-		ord.CustomerID = customerID.String
-		ord.DeliveryService = deliveryService.String
-		ord.ShardKey = shardKey.String
-		if smID.Valid {
-			ord.SmID = int(smID.Int64)
+	deliveryQuery := `
+		UPDATE deliveries SET name = '', phone = '', address = '', email = ''
+		WHERE order_uid = $1
+	`
+	if _, err = tx.Exec(ctx, deliveryQuery, orderId); err != nil {
+		return err
+	}
+	if audit != nil {
+		if err = audit(ctx, tx, nil, nil); err != nil {
+			return err
 		}
-		ord.DateCreated = dateCreated
-		ord.OofShard = oofShard.String
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+	db.MarkWritten(ctx)
+	return nil
+}
 
-		if len(deliveryJSON) > 0 {
-			var d Delivery
-			_ = json.Unmarshal(deliveryJSON, &d)
-			ord.Delivery = d
+// UpdateStatus sets the status of every item of the order.
+func (r *OrderRepository) UpdateStatus(ctx context.Context, orderId string, status int, audit AuditFunc) (err error) {
+	tx, err := r.client.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			r.rollback(ctx, tx)
 		}
-		if len(paymentJSON) > 0 {
-			var p Payment
-			_ = json.Unmarshal(paymentJSON, &p)
-			ord.Payment = p
+	}()
+
+	before, err := lockLive(ctx, tx, orderId)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(ctx, `UPDATE products SET status = $3 WHERE track_number = $1 AND date_created = $2`, before.TrackNumber, before.DateCreated, status); err != nil {
+		return err
+	}
+	if audit != nil {
+		after := before
+		after.Products = make([]Product, len(before.Products))
+		for i, p := range before.Products {
+			p.Status = status
+			after.Products[i] = p
 		}
-		if len(productsJSON) > 0 {
-			var prods []Product
-			_ = json.Unmarshal(productsJSON, &prods)
-			ord.Products = prods
+		if err = audit(ctx, tx, &before, &after); err != nil {
+			return err
 		}
-
-		result = append(result, ord)
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+	if err = tx.Commit(ctx); err != nil {
+		return err
 	}
+	db.MarkWritten(ctx)
+	return nil
+}
 
-	return result, nil
+// lockLive reads the live order in tx and locks its row until tx ends.
+func lockLive(ctx context.Context, tx pgx.Tx, orderId string) (Order, error) {
+	query := `
+		SELECT ` + orderColumns + `
+		FROM orders
+		WHERE order_uid = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`
+	orders, err := loadOrders(ctx, tx, query, orderId)
+	if err != nil {
+		return Order{}, err
+	}
+	if len(orders) == 0 {
+		return Order{}, ErrOrderNotFound
+	}
+	return orders[0], nil
 }
@@ -2,39 +2,147 @@ package order
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"math/rand"
 	"time"
 
+	"L0/internal/audit"
+	"L0/internal/db"
+	"L0/internal/logger"
+	"L0/internal/metrics"
+	"L0/internal/tracing"
+
 	kafkago "github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type OrderService struct {
-	repo   Repository
-	cache  Cache
-	writer Writer
-	logger Logger
+	repo    Repository
+	cache   Cache
+	writer  Writer
+	auditor Auditor
+	archive Archive
+	encoder MessageEncoder
+	logger  Logger
+	policy  ConflictPolicy
+	// uncached is set when another process writes the orders.
+	uncached bool
+}
+
+// NewOrderService wires the service. auditor may be nil to disable the audit
+// trail; a nil logger falls back to slog.Default().
+func NewOrderService(repository Repository, cache Cache, writer Writer, auditor Auditor, logger Logger) *OrderService {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &OrderService{repo: repository, logger: logger, cache: cache, writer: writer, auditor: auditor, policy: ConflictSkip}
+}
+
+// SetConflictPolicy sets the policy SaveOrder uses when options do not name one.
+func (s *OrderService) SetConflictPolicy(policy ConflictPolicy) {
+	s.policy = policy
+}
+
+// SetArchive makes GetOrderById look up orders missing from the database in
+// archive, and DeleteOrder and EraseOrder remove them from it.
+func (s *OrderService) SetArchive(archive Archive) {
+	s.archive = archive
+}
+
+// SetCacheReads(false) makes GetOrderById and GetOrdersLimit read the
+// database, for instances that do not consume orders themselves: their cache
+// never hears of the writes made by the consumer.
+func (s *OrderService) SetCacheReads(enabled bool) {
+	s.uncached = !enabled
+}
+
+// SetEncoder sets how CreateOrder encodes published orders; a JSON payload
+// without headers otherwise.
+func (s *OrderService) SetEncoder(encoder MessageEncoder) {
+	s.encoder = encoder
 }
 
-func NewOrderService(repository Repository, cache Cache, writer Writer, logger Logger) *OrderService {
-	return &OrderService{repo: repository, logger: logger, cache: cache, writer: writer}
+// SaveOrder stores the order according to opts. The cache and the audit log
+// are only touched when the order was actually written; the audit entry is
+// committed with the order.
+func (s *OrderService) SaveOrder(ctx context.Context, order Order, opts SaveOptions) (result SaveResult, err error) {
+	start := time.Now()
+	defer func() {
+		label := result.String()
+		if err != nil {
+			label = "error"
+		}
+		metrics.ObserveSave(label, start)
+	}()
+
+	if opts.Policy == "" {
+		opts.Policy = s.policy
+	}
+	ctx = logger.With(ctx, "order_uid", order.OrderUID)
+
+	result, err = s.repo.Save(ctx, order, opts, s.saveAudit(opts))
+	if err != nil {
+		s.logger.ErrorContext(ctx, "save order failed", "error", err)
+		return result, err
+	}
+	s.logger.DebugContext(ctx, "order saved", "result", result.String(), "policy", string(opts.Policy), "dry_run", opts.DryRun)
+	if opts.DryRun {
+		return result, nil
+	}
+	switch result {
+	case SaveInserted:
+		s.cache.Set(order)
+	case SaveUpdated:
+		s.cache.Delete(order.OrderUID)
+		s.cache.Set(order)
+	}
+	return result, nil
 }
 
-func (s *OrderService) SaveOrder(ctx context.Context, order Order) error {
-	s.cache.Set(order)
-	return s.repo.Save(ctx, order)
+// SaveOrders stores orders in one batch according to opts. An order that
+// fails is reported at its index in errs and does not stop the others; err
+// is set when the whole batch failed. Batches come from bulk imports, so the
+// saved orders are not cached; overwritten ones are evicted.
+func (s *OrderService) SaveOrders(ctx context.Context, orders []Order, opts SaveOptions) (results []SaveResult, errs []error, err error) {
+	if opts.Policy == "" {
+		opts.Policy = s.policy
+	}
+
+	results, errs, err = s.repo.SaveBatch(ctx, orders, opts, s.saveAudit(opts))
+	if err != nil {
+		s.logger.ErrorContext(ctx, "save order batch failed", "orders", len(orders), "error", err)
+		return nil, nil, err
+	}
+	for i, o := range orders {
+		if !opts.DryRun && errs[i] == nil && results[i] == SaveUpdated {
+			s.cache.Delete(o.OrderUID)
+		}
+	}
+	s.logger.DebugContext(ctx, "order batch saved", "orders", len(orders), "policy", string(opts.Policy), "dry_run", opts.DryRun)
+	return results, errs, nil
 }
 
+// GetOrderById reads the order from the cache, the database or, once it has
+// been archived, the archive. Archived orders are not cached.
 func (s *OrderService) GetOrderById(ctx context.Context, orderId string) (Order, error) {
-	if order, exists := s.cache.Get(orderId); exists {
-		return *order, nil
+	if !s.uncached {
+		if order, exists := s.cache.Get(orderId); exists {
+			return *order, nil
+		}
 	}
-	return s.repo.GetById(ctx, orderId)
+	order, err := s.repo.GetById(ctx, orderId)
+	if errors.Is(err, ErrOrderNotFound) && s.archive != nil {
+		return s.archive.Get(ctx, orderId)
+	}
+	return order, err
 }
 
 func (s *OrderService) GetOrdersLimit(ctx context.Context, limit int) ([]Order, error) {
-	if s.cache != nil {
+	if s.cache != nil && !s.uncached {
 		recent := s.cache.GetRecent(limit)
 		if len(recent) > 0 {
 			return recent, nil
@@ -47,21 +155,154 @@ func (s *OrderService) GetOrdersLimit(ctx context.Context, limit int) ([]Order,
 	return orders, nil
 }
 
+// ListOrders returns orders matching filter. Without date bounds it is
+// GetOrdersLimit, served from the cache when possible; with bounds it reads
+// only the partitions of the requested months.
+func (s *OrderService) ListOrders(ctx context.Context, filter ListFilter) ([]Order, error) {
+	if filter.From.IsZero() && filter.To.IsZero() {
+		return s.GetOrdersLimit(ctx, filter.Limit)
+	}
+	return s.repo.List(ctx, filter)
+}
+
+// ExportOrders passes every order matching filter to fn as it is read from
+// the database; a Limit of zero exports all of them. The cache is bypassed,
+// so the export is one consistent snapshot.
+func (s *OrderService) ExportOrders(ctx context.Context, filter ListFilter, fn func(Order) error) error {
+	return s.repo.Stream(ctx, filter, fn)
+}
+
+// DeleteOrder soft-deletes a live order. An archived one is removed from the
+// archive instead.
+func (s *OrderService) DeleteOrder(ctx context.Context, orderId string) error {
+	fn := s.auditAs(orderId, audit.ActionDelete)
+	err := s.repo.Delete(ctx, orderId, fn)
+	if errors.Is(err, ErrOrderNotFound) && s.archive != nil {
+		err = s.archive.Remove(ctx, orderId, fn)
+	}
+	if err != nil {
+		return err
+	}
+	s.cache.Delete(orderId)
+	return nil
+}
+
+// EraseOrder scrubs personal data of the order. Erased values are also
+// redacted from the audit history, in the same transaction, so the erase
+// entry itself carries no snapshot. An archived order is removed from the
+// archive altogether, since its files cannot be scrubbed in place.
+func (s *OrderService) EraseOrder(ctx context.Context, orderId string) error {
+	var fn AuditFunc
+	if s.auditor != nil {
+		fn = func(ctx context.Context, tx db.Client, _, _ *Order) error {
+			if err := s.auditor.Redact(ctx, tx, orderId, PersonalDataPaths); err != nil {
+				return fmt.Errorf("redact audit history: %w", err)
+			}
+			return s.record(ctx, tx, orderId, audit.ActionErase, nil, nil)
+		}
+	}
+	err := s.repo.Erase(ctx, orderId, fn)
+	if errors.Is(err, ErrOrderNotFound) && s.archive != nil {
+		err = s.archive.Remove(ctx, orderId, fn)
+	}
+	if err != nil {
+		return err
+	}
+	s.cache.Delete(orderId)
+	return nil
+}
+
+func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderId string, status int) error {
+	if err := s.repo.UpdateStatus(ctx, orderId, status, s.auditAs(orderId, audit.ActionStatusChange)); err != nil {
+		return err
+	}
+	s.cache.Delete(orderId)
+	return nil
+}
+
+func (s *OrderService) GetOrderAudit(ctx context.Context, orderId string) ([]audit.Entry, error) {
+	if s.auditor == nil {
+		return []audit.Entry{}, nil
+	}
+	return s.auditor.History(ctx, orderId)
+}
+
+// saveAudit records saves as creates or, when they replaced an order,
+// updates. Dry runs are not recorded.
+func (s *OrderService) saveAudit(opts SaveOptions) AuditFunc {
+	if s.auditor == nil || opts.DryRun {
+		return nil
+	}
+	return func(ctx context.Context, tx db.Client, before, after *Order) error {
+		action := audit.ActionCreate
+		if before != nil {
+			action = audit.ActionUpdate
+		}
+		return s.record(ctx, tx, after.OrderUID, action, before, after)
+	}
+}
+
+// auditAs records writes of orderId as action; nil without an auditor.
+func (s *OrderService) auditAs(orderId string, action audit.Action) AuditFunc {
+	if s.auditor == nil {
+		return nil
+	}
+	return func(ctx context.Context, tx db.Client, before, after *Order) error {
+		return s.record(ctx, tx, orderId, action, before, after)
+	}
+}
+
+// record stores an audit entry through tx, the transaction of the change.
+func (s *OrderService) record(ctx context.Context, tx db.Client, orderId string, action audit.Action, before, after *Order) error {
+	entry, err := audit.NewEntry(ctx, orderId, action, snapshot(before), snapshot(after))
+	if err != nil {
+		return err
+	}
+	if err := s.auditor.Record(ctx, tx, entry); err != nil {
+		return fmt.Errorf("record audit entry: %w", err)
+	}
+	return nil
+}
+
+// snapshot keeps a missing order a nil snapshot rather than a JSON null.
+func snapshot(o *Order) any {
+	if o == nil {
+		return nil
+	}
+	return *o
+}
+
 func (s *OrderService) CreateOrder(ctx context.Context) (Order, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "order.create", trace.WithSpanKind(trace.SpanKindProducer))
+	defer span.End()
+
 	order := s.generateRandomOrder()
-	payload, err := json.Marshal(order)
+	span.SetAttributes(attribute.String("order.uid", order.OrderUID))
+	msg, err := s.encode(ctx, order)
 	if err != nil {
-		s.logger.Printf("marshal generated order: %v", err)
+		s.logger.ErrorContext(ctx, "encode generated order failed", "order_uid", order.OrderUID, "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return Order{}, err
 	}
-	msg := kafkago.Message{Value: payload}
+	tracing.InjectMessage(ctx, &msg)
 	if err := s.writer.WriteMessages(ctx, msg); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return Order{}, err
 	}
 
 	return order, nil
 }
 
+func (s *OrderService) encode(ctx context.Context, order Order) (kafkago.Message, error) {
+	if s.encoder != nil {
+		return s.encoder.EncodeMessage(ctx, order)
+	}
+	payload, err := MarshalPayload(order)
+	return kafkago.Message{Value: payload}, err
+}
+
 func (s *OrderService) generateRandomOrder() Order {
 	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
 
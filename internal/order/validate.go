@@ -0,0 +1,60 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidOrder = errors.New("invalid order")
+
+// Validate checks that an incoming order can be stored and served. All
+// problems are reported at once; the result wraps ErrInvalidOrder.
+func Validate(o Order) error {
+	var errs []error
+	required := func(field, value string) {
+		if value == "" {
+			errs = append(errs, fmt.Errorf("%s is required", field))
+		}
+	}
+	nonNegative := func(field string, value int) {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", field))
+		}
+	}
+
+	required("order_uid", o.OrderUID)
+	required("track_number", o.TrackNumber)
+	required("entry", o.Entry)
+	required("locale", o.Locale)
+	required("customer_id", o.CustomerID)
+	required("delivery_service", o.DeliveryService)
+	if o.DateCreated.IsZero() {
+		errs = append(errs, errors.New("date_created is required"))
+	}
+
+	required("delivery.name", o.Delivery.Name)
+	required("delivery.phone", o.Delivery.Phone)
+	required("delivery.city", o.Delivery.City)
+	required("delivery.address", o.Delivery.Address)
+
+	required("payment.transaction", o.Payment.Transaction)
+	required("payment.currency", o.Payment.Currency)
+	required("payment.provider", o.Payment.Provider)
+	nonNegative("payment.amount", o.Payment.Amount)
+	nonNegative("payment.delivery_cost", o.Payment.DeliveryCost)
+	nonNegative("payment.goods_total", o.Payment.GoodsTotal)
+	nonNegative("payment.custom_fee", o.Payment.CustomFee)
+
+	for i, p := range o.Products {
+		if p.TrackNumber != o.TrackNumber {
+			errs = append(errs, fmt.Errorf("items[%d].track_number %q does not match order track_number", i, p.TrackNumber))
+		}
+		nonNegative(fmt.Sprintf("items[%d].price", i), p.Price)
+		nonNegative(fmt.Sprintf("items[%d].total_price", i), p.TotalPrice)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidOrder, errors.Join(errs...))
+}
@@ -0,0 +1,289 @@
+// Package partition maintains the monthly partitions of the orders tables:
+// it creates partitions ahead of time and detaches those past the retention
+// into an archive schema.
+package partition
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"L0/internal/config"
+	"L0/internal/metrics"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Tables are partitioned together by the month of the order's date_created,
+// so every month of an order and its children is attached or detached at once.
+var Tables = []string{"orders", "deliveries", "payments", "products"}
+
+// lockKey serializes maintenance between instances; it differs from the
+// migration lock.
+const lockKey int64 = 5_337_100_045
+
+// lockTimeout bounds waiting for the table locks that attaching and
+// detaching need, so maintenance gives way to a busy table and retries on the
+// next run.
+const lockTimeout = "5s"
+
+// Month returns the first instant of the UTC month of t.
+func Month(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Name is the partition of table for month, e.g. orders_p2025_01.
+func Name(table string, month time.Time) string {
+	return fmt.Sprintf("%s_p%04d_%02d", table, month.Year(), int(month.Month()))
+}
+
+var namePattern = regexp.MustCompile(`_p(\d{4})_(\d{2})$`)
+
+// parseName returns the month of a partition named by Name.
+func parseName(table, name string) (time.Time, bool) {
+	m := namePattern.FindStringSubmatch(name)
+	if m == nil || name != table+m[0] {
+		return time.Time{}, false
+	}
+	year, _ := strconv.Atoi(m[1])
+	month, _ := strconv.Atoi(m[2])
+	if month < 1 || month > 12 {
+		return time.Time{}, false
+	}
+	return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC), true
+}
+
+// Plan decides which months to create and which to detach, given the months
+// that have partitions. Months from the current one through ahead months
+// later must exist; with retention > 0, months older than retention months
+// before the current one are detached.
+func Plan(existing []time.Time, now time.Time, ahead, retention int) (create, detach []time.Time) {
+	current := Month(now)
+	for i := 0; i <= ahead; i++ {
+		m := current.AddDate(0, i, 0)
+		if !slices.ContainsFunc(existing, m.Equal) {
+			create = append(create, m)
+		}
+	}
+	if retention > 0 {
+		cutoff := current.AddDate(0, -retention, 0)
+		for _, m := range existing {
+			if m.Before(cutoff) {
+				detach = append(detach, m)
+			}
+		}
+		slices.SortFunc(detach, time.Time.Compare)
+	}
+	return create, detach
+}
+
+// Report lists the partitions of orders created and detached by a run.
+type Report struct {
+	Created  []string `json:"created"`
+	Detached []string `json:"detached"`
+	// Skipped is set when another instance held the maintenance lock.
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+type Maintainer struct {
+	pool      *pgxpool.Pool
+	ahead     int
+	retention int
+	archive   string
+	logger    *slog.Logger
+}
+
+func NewMaintainer(pool *pgxpool.Pool, cfg config.PartitionConf, logger *slog.Logger) *Maintainer {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Maintainer{pool: pool, ahead: cfg.MonthsAhead, retention: cfg.RetentionMonths, archive: cfg.ArchiveSchema, logger: logger}
+}
+
+// Run calls RunOnce now and then every interval until ctx is done. Failures
+// are logged and retried on the next tick.
+func (m *Maintainer) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		report, err := m.RunOnce(ctx, time.Now())
+		switch {
+		case err != nil && ctx.Err() == nil:
+			m.logger.ErrorContext(ctx, "partition maintenance failed", "error", err)
+		case len(report.Created)+len(report.Detached) > 0:
+			m.logger.InfoContext(ctx, "partition maintenance done", "created", report.Created, "detached", report.Detached)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// RunOnce creates the missing months and detaches the expired ones as of now.
+// It does nothing when another instance is running maintenance.
+func (m *Maintainer) RunOnce(ctx context.Context, now time.Time) (Report, error) {
+	var report Report
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return report, err
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, lockKey).Scan(&locked); err != nil {
+		return report, fmt.Errorf("acquire maintenance lock: %w", err)
+	}
+	if !locked {
+		report.Skipped = true
+		return report, nil
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey); err != nil {
+			conn.Conn().Close(context.Background())
+		}
+	}()
+
+	existing, err := months(ctx, conn, "orders")
+	if err != nil {
+		return report, err
+	}
+	create, detach := Plan(existing, now, m.ahead, m.retention)
+	for _, month := range create {
+		if err := m.create(ctx, conn, month); err != nil {
+			return report, fmt.Errorf("create %s: %w", Name("orders", month), err)
+		}
+		report.Created = append(report.Created, Name("orders", month))
+		metrics.PartitionOps.WithLabelValues("create").Inc()
+	}
+	for _, month := range detach {
+		if err := m.detach(ctx, conn, month); err != nil {
+			return report, fmt.Errorf("detach %s: %w", Name("orders", month), err)
+		}
+		report.Detached = append(report.Detached, Name("orders", month))
+		metrics.PartitionOps.WithLabelValues("detach").Inc()
+	}
+	return report, nil
+}
+
+// Create adds the partitions of month to every table that lacks one.
+func (m *Maintainer) Create(ctx context.Context, month time.Time) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	return m.create(ctx, conn, Month(month))
+}
+
+// create builds each missing partition as a standalone table, moves the rows
+// of that month out of the default partition and attaches it. Creating it
+// with PARTITION OF would fail whenever the default partition already holds
+// rows of the month.
+func (m *Maintainer) create(ctx context.Context, conn *pgxpool.Conn, month time.Time) error {
+	from, to := bound(month), bound(month.AddDate(0, 1, 0))
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SET LOCAL lock_timeout = '`+lockTimeout+`'`); err != nil {
+			return err
+		}
+		for _, table := range Tables {
+			have, err := months(ctx, tx, table)
+			if err != nil {
+				return err
+			}
+			if slices.ContainsFunc(have, month.Equal) {
+				continue
+			}
+			parent := pgx.Identifier{table}.Sanitize()
+			part := pgx.Identifier{Name(table, month)}.Sanitize()
+			def := pgx.Identifier{table + "_default"}.Sanitize()
+			stmts := []string{
+				fmt.Sprintf(`CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING CONSTRAINTS)`, part, parent),
+				fmt.Sprintf(`WITH moved AS (
+					DELETE FROM %s WHERE date_created >= '%s' AND date_created < '%s' RETURNING *
+				) INSERT INTO %s SELECT * FROM moved`, def, from, to, part),
+				fmt.Sprintf(`ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')`, parent, part, from, to),
+			}
+			for _, stmt := range stmts {
+				if _, err := tx.Exec(ctx, stmt); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// detach detaches the partitions of month from every table and moves them to
+// the archive schema, where they can be archived or dropped.
+func (m *Maintainer) detach(ctx context.Context, conn *pgxpool.Conn, month time.Time) error {
+	archive := pgx.Identifier{m.archive}.Sanitize()
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SET LOCAL lock_timeout = '`+lockTimeout+`'`); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `CREATE SCHEMA IF NOT EXISTS `+archive); err != nil {
+			return err
+		}
+		for _, table := range Tables {
+			have, err := months(ctx, tx, table)
+			if err != nil {
+				return err
+			}
+			if !slices.ContainsFunc(have, month.Equal) {
+				continue
+			}
+			part := pgx.Identifier{Name(table, month)}.Sanitize()
+			stmts := []string{
+				fmt.Sprintf(`ALTER TABLE %s DETACH PARTITION %s`, pgx.Identifier{table}.Sanitize(), part),
+				fmt.Sprintf(`ALTER TABLE %s SET SCHEMA %s`, part, archive),
+			}
+			for _, stmt := range stmts {
+				if _, err := tx.Exec(ctx, stmt); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// months lists the months of the attached partitions of table.
+func months(ctx context.Context, q querier, table string) ([]time.Time, error) {
+	rows, err := q.Query(ctx, `
+		SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = $1::regclass
+	`, table)
+	if err != nil {
+		return nil, err
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	var out []time.Time
+	for _, n := range names {
+		if month, ok := parseName(table, n); ok {
+			out = append(out, month)
+		}
+	}
+	slices.SortFunc(out, time.Time.Compare)
+	return out, nil
+}
+
+// bound renders t as a UTC timestamptz literal.
+func bound(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05") + "+00"
+}
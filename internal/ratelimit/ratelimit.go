@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// idleTTL is how long a client's bucket is kept after its last request.
+const idleTTL = 10 * time.Minute
+
+type client struct {
+	lim  *rate.Limiter
+	seen time.Time
+}
+
+// Limiter keeps a token bucket per client key.
+type Limiter struct {
+	mu        sync.Mutex
+	limit     rate.Limit
+	burst     int
+	clients   map[string]*client
+	lastSweep time.Time
+}
+
+// New creates a limiter refilling rps tokens per second up to burst. A
+// non-positive rps allows every request.
+func New(rps float64, burst int) *Limiter {
+	return &Limiter{limit: limitOf(rps), burst: burst, clients: make(map[string]*client), lastSweep: time.Now()}
+}
+
+func limitOf(rps float64) rate.Limit {
+	if rps <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(rps)
+}
+
+// Allow takes a token from key's bucket. When the bucket is empty it reports
+// how long until the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	c, ok := l.clients[key]
+	if !ok {
+		c = &client{lim: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[key] = c
+	}
+	c.seen = now
+
+	r := c.lim.ReserveN(now, 1)
+	if !r.OK() {
+		return false, time.Second
+	}
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// SetLimit changes the rate and burst for new and existing clients.
+func (l *Limiter) SetLimit(rps float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit, l.burst = limitOf(rps), burst
+	now := time.Now()
+	for _, c := range l.clients {
+		c.lim.SetLimitAt(now, l.limit)
+		c.lim.SetBurstAt(now, burst)
+	}
+}
+
+// sweep drops buckets of clients idle longer than idleTTL, at most once per
+// idleTTL.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < idleTTL {
+		return
+	}
+	for key, c := range l.clients {
+		if now.Sub(c.seen) > idleTTL {
+			delete(l.clients, key)
+		}
+	}
+	l.lastSweep = now
+}
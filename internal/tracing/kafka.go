@@ -0,0 +1,51 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+)
+
+// messageCarrier adapts Kafka message headers to propagation.TextMapCarrier.
+type messageCarrier struct {
+	msg *kafka.Message
+}
+
+func (c messageCarrier) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c messageCarrier) Set(key, value string) {
+	for i, h := range c.msg.Headers {
+		if h.Key == key {
+			c.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c messageCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, h := range c.msg.Headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
+
+// InjectMessage writes the trace context of ctx into the message headers.
+func InjectMessage(ctx context.Context, m *kafka.Message) {
+	otel.GetTextMapPropagator().Inject(ctx, messageCarrier{msg: m})
+}
+
+// ExtractMessage returns ctx carrying the trace context found in the message
+// headers, if any.
+func ExtractMessage(ctx context.Context, m kafka.Message) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, messageCarrier{msg: &m})
+}
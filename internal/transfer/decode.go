@@ -0,0 +1,282 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"L0/internal/order"
+)
+
+// Record is one order read from a file. Line is the line the order starts
+// on. Err is set when the order could not be decoded; the decoder goes on
+// with the next one.
+type Record struct {
+	Line  int
+	Order order.Order
+	Err   error
+}
+
+// Decoder reads orders one at a time. Next returns io.EOF after the last
+// order and a *ReadError when the file cannot be read further.
+type Decoder interface {
+	Next() (Record, error)
+}
+
+// ReadError stops decoding. Line is where the order that could not be read
+// starts.
+type ReadError struct {
+	Line int
+	Err  error
+}
+
+func (e *ReadError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *ReadError) Unwrap() error { return e.Err }
+
+// NewDecoder reads NDJSON or CSV as written by NewEncoder. JSON arrays are
+// not decoded: they cannot be read record by record or resumed at a line.
+// NDJSON lines are order payloads of any known version; with strict, fields
+// unknown to the version fail the line. CSV always rejects unknown columns.
+func NewDecoder(r io.Reader, f Format, strict bool) (Decoder, error) {
+	switch f {
+	case NDJSON:
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		return &ndjsonDecoder{sc: sc, strict: strict}, nil
+	case CSV:
+		return newCSVDecoder(r)
+	default:
+		return nil, fmt.Errorf("format %s cannot be imported, use ndjson or csv", f)
+	}
+}
+
+type ndjsonDecoder struct {
+	sc     *bufio.Scanner
+	strict bool
+	line   int
+}
+
+func (d *ndjsonDecoder) Next() (Record, error) {
+	for d.sc.Scan() {
+		d.line++
+		if len(bytes.TrimSpace(d.sc.Bytes())) == 0 {
+			continue
+		}
+		rec := Record{Line: d.line}
+		rec.Order, rec.Err = order.UnmarshalPayload(d.sc.Bytes(), d.strict)
+		return rec, nil
+	}
+	if err := d.sc.Err(); err != nil {
+		return Record{}, &ReadError{Line: d.line + 1, Err: err}
+	}
+	return Record{}, io.EOF
+}
+
+// csvField sets one column of an order or, for item columns, of the item
+// of the row.
+type csvField func(o *order.Order, it *order.Product, v string) error
+
+func csvString(set func(o *order.Order, it *order.Product) *string) csvField {
+	return func(o *order.Order, it *order.Product, v string) error {
+		*set(o, it) = v
+		return nil
+	}
+}
+
+func csvInt(set func(o *order.Order, it *order.Product) *int) csvField {
+	return func(o *order.Order, it *order.Product, v string) error {
+		if v == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(v)
+		*set(o, it) = n
+		return err
+	}
+}
+
+var csvFields = map[string]csvField{
+	"order_uid":          csvString(func(o *order.Order, _ *order.Product) *string { return &o.OrderUID }),
+	"track_number":       csvString(func(o *order.Order, _ *order.Product) *string { return &o.TrackNumber }),
+	"entry":              csvString(func(o *order.Order, _ *order.Product) *string { return &o.Entry }),
+	"locale":             csvString(func(o *order.Order, _ *order.Product) *string { return &o.Locale }),
+	"internal_signature": csvString(func(o *order.Order, _ *order.Product) *string { return &o.InternalSignature }),
+	"customer_id":        csvString(func(o *order.Order, _ *order.Product) *string { return &o.CustomerID }),
+	"delivery_service":   csvString(func(o *order.Order, _ *order.Product) *string { return &o.DeliveryService }),
+	"shardkey":           csvString(func(o *order.Order, _ *order.Product) *string { return &o.ShardKey }),
+	"sm_id":              csvInt(func(o *order.Order, _ *order.Product) *int { return &o.SmID }),
+	"date_created": func(o *order.Order, _ *order.Product, v string) error {
+		if v == "" {
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, v)
+		o.DateCreated = t
+		return err
+	},
+	"oof_shard":           csvString(func(o *order.Order, _ *order.Product) *string { return &o.OofShard }),
+	"delivery_name":       csvString(func(o *order.Order, _ *order.Product) *string { return &o.Delivery.Name }),
+	"delivery_phone":      csvString(func(o *order.Order, _ *order.Product) *string { return &o.Delivery.Phone }),
+	"delivery_zip":        csvString(func(o *order.Order, _ *order.Product) *string { return &o.Delivery.Zip }),
+	"delivery_city":       csvString(func(o *order.Order, _ *order.Product) *string { return &o.Delivery.City }),
+	"delivery_address":    csvString(func(o *order.Order, _ *order.Product) *string { return &o.Delivery.Address }),
+	"delivery_region":     csvString(func(o *order.Order, _ *order.Product) *string { return &o.Delivery.Region }),
+	"delivery_email":      csvString(func(o *order.Order, _ *order.Product) *string { return &o.Delivery.Email }),
+	"payment_transaction": csvString(func(o *order.Order, _ *order.Product) *string { return &o.Payment.Transaction }),
+	"payment_request_id":  csvString(func(o *order.Order, _ *order.Product) *string { return &o.Payment.RequestID }),
+	"payment_currency":    csvString(func(o *order.Order, _ *order.Product) *string { return &o.Payment.Currency }),
+	"payment_provider":    csvString(func(o *order.Order, _ *order.Product) *string { return &o.Payment.Provider }),
+	"payment_amount":      csvInt(func(o *order.Order, _ *order.Product) *int { return &o.Payment.Amount }),
+	"payment_dt": func(o *order.Order, _ *order.Product, v string) error {
+		if v == "" {
+			return nil
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		o.Payment.PaymentDt = n
+		return err
+	},
+	"payment_bank":          csvString(func(o *order.Order, _ *order.Product) *string { return &o.Payment.Bank }),
+	"payment_delivery_cost": csvInt(func(o *order.Order, _ *order.Product) *int { return &o.Payment.DeliveryCost }),
+	"payment_goods_total":   csvInt(func(o *order.Order, _ *order.Product) *int { return &o.Payment.GoodsTotal }),
+	"payment_custom_fee":    csvInt(func(o *order.Order, _ *order.Product) *int { return &o.Payment.CustomFee }),
+	"item_chrt_id":          csvInt(func(_ *order.Order, it *order.Product) *int { return &it.ChrtID }),
+	"item_track_number":     csvString(func(_ *order.Order, it *order.Product) *string { return &it.TrackNumber }),
+	"item_price":            csvInt(func(_ *order.Order, it *order.Product) *int { return &it.Price }),
+	"item_rid":              csvString(func(_ *order.Order, it *order.Product) *string { return &it.Rid }),
+	"item_name":             csvString(func(_ *order.Order, it *order.Product) *string { return &it.Name }),
+	"item_sale":             csvInt(func(_ *order.Order, it *order.Product) *int { return &it.Sale }),
+	"item_size":             csvString(func(_ *order.Order, it *order.Product) *string { return &it.Size }),
+	"item_total_price":      csvInt(func(_ *order.Order, it *order.Product) *int { return &it.TotalPrice }),
+	"item_nm_id":            csvInt(func(_ *order.Order, it *order.Product) *int { return &it.NmID }),
+	"item_brand":            csvString(func(_ *order.Order, it *order.Product) *string { return &it.Brand }),
+	"item_status":           csvInt(func(_ *order.Order, it *order.Product) *int { return &it.Status }),
+}
+
+// csvDecoder reads the columns of CSVHeader in any order; missing columns
+// are left empty. Consecutive rows with the same order_uid make one order
+// and each row with an item_chrt_id adds an item to it.
+type csvDecoder struct {
+	r       *csv.Reader
+	columns []string
+	uid     int
+	// next is the first row of the following order, read ahead.
+	next     []string
+	nextLine int
+	nextErr  error
+	done     bool
+}
+
+func newCSVDecoder(r io.Reader) (*csvDecoder, error) {
+	d := &csvDecoder{r: csv.NewReader(r), uid: -1}
+	header, err := d.r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("empty CSV file, want a header line")
+	}
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if _, ok := csvFields[name]; !ok {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate CSV column %q", name)
+		}
+		seen[name] = true
+		if name == "order_uid" {
+			d.uid = i
+		}
+		d.columns = append(d.columns, name)
+	}
+	if d.uid < 0 {
+		return nil, errors.New("CSV header has no order_uid column")
+	}
+	d.r.FieldsPerRecord = len(header)
+	if err := d.read(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// read reads the next row into next. Malformed rows are kept in nextErr so
+// that they are reported as records of their own.
+func (d *csvDecoder) read() error {
+	d.next, d.nextErr = nil, nil
+	row, err := d.r.Read()
+	var perr *csv.ParseError
+	switch {
+	case errors.Is(err, io.EOF):
+		d.done = true
+		return nil
+	case errors.As(err, &perr):
+		d.nextLine, d.nextErr = perr.StartLine, err
+		return nil
+	case err != nil:
+		return err
+	}
+	d.next = row
+	d.nextLine, _ = d.r.FieldPos(0)
+	return nil
+}
+
+func (d *csvDecoder) Next() (Record, error) {
+	if d.done {
+		return Record{}, io.EOF
+	}
+	rec := Record{Line: d.nextLine}
+	if d.nextErr != nil {
+		rec.Err = d.nextErr
+		if err := d.read(); err != nil {
+			return Record{}, &ReadError{Line: rec.Line, Err: err}
+		}
+		return rec, nil
+	}
+	uid := d.next[d.uid]
+	for first := true; ; first = false {
+		if err := d.apply(&rec, d.next, first); err != nil && rec.Err == nil {
+			rec.Err = fmt.Errorf("line %d: %w", d.nextLine, err)
+		}
+		if err := d.read(); err != nil {
+			return Record{}, &ReadError{Line: rec.Line, Err: err}
+		}
+		if d.done || d.nextErr != nil || d.next[d.uid] != uid {
+			return rec, nil
+		}
+	}
+}
+
+// apply sets the order columns of the first row of an order and the item
+// columns of every row.
+func (d *csvDecoder) apply(rec *Record, row []string, first bool) error {
+	var it order.Product
+	hasItem := false
+	for i, v := range row {
+		name := d.columns[i]
+		isItem := strings.HasPrefix(name, "item_")
+		if !isItem && !first {
+			continue
+		}
+		if name == "item_chrt_id" && v != "" {
+			hasItem = true
+		}
+		if err := csvFields[name](&rec.Order, &it, v); err != nil {
+			return fmt.Errorf("column %s: %w", name, err)
+		}
+	}
+	if first && rec.Order.Products == nil {
+		rec.Order.Products = []order.Product{}
+	}
+	if hasItem {
+		rec.Order.Products = append(rec.Order.Products, it)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"L0/internal/metrics"
+	"L0/internal/order"
+)
+
+const (
+	// DefaultBatchSize is the number of orders saved per transaction.
+	DefaultBatchSize = 500
+	// DefaultMaxErrors caps the line errors kept in a report.
+	DefaultMaxErrors = 100
+)
+
+// Saver writes a batch of orders; order.Service satisfies it.
+type Saver interface {
+	SaveOrders(ctx context.Context, orders []order.Order, opts order.SaveOptions) ([]order.SaveResult, []error, error)
+}
+
+type ImportOptions struct {
+	// BatchSize defaults to DefaultBatchSize.
+	BatchSize int
+	// DryRun decodes, validates and saves every batch, then rolls it back.
+	DryRun bool
+	// FromLine skips the orders starting before this line, so an import
+	// that stopped can be resumed from its report's NextLine.
+	FromLine int
+	Policy   order.ConflictPolicy
+	// MaxErrors defaults to DefaultMaxErrors.
+	MaxErrors int
+	// OnError, if set, is called for every failed line, including those
+	// past MaxErrors.
+	OnError func(LineError)
+}
+
+// LineError is an order that failed to decode, validate or save.
+type LineError struct {
+	Line     int    `json:"line"`
+	OrderUID string `json:"order_uid,omitempty"`
+	Error    string `json:"error"`
+}
+
+// ImportReport sums up an import.
+type ImportReport struct {
+	// Orders counts the orders read at or after FromLine.
+	Orders   int  `json:"orders"`
+	Inserted int  `json:"inserted"`
+	Updated  int  `json:"updated"`
+	Skipped  int  `json:"skipped"`
+	Failed   int  `json:"failed"`
+	DryRun   bool `json:"dry_run,omitempty"`
+	// Errors holds the first MaxErrors failed lines.
+	Errors []LineError `json:"errors,omitempty"`
+	// NextLine is set when the import stopped early: the line of the first
+	// order not saved, to pass as FromLine to resume.
+	NextLine int `json:"next_line,omitempty"`
+}
+
+// Import reads orders from dec, validates them and saves them in batches. An
+// order that fails is reported and skipped. Import stops at the first error
+// that is not about one order, such as a broken connection, and returns it
+// with the report so far.
+func Import(ctx context.Context, dec Decoder, saver Saver, opts ImportOptions) (ImportReport, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.MaxErrors <= 0 {
+		opts.MaxErrors = DefaultMaxErrors
+	}
+	report := ImportReport{DryRun: opts.DryRun}
+	fail := func(line int, uid string, err error) {
+		report.Failed++
+		metrics.ImportedOrders.WithLabelValues("failed").Inc()
+		le := LineError{Line: line, OrderUID: uid, Error: err.Error()}
+		if len(report.Errors) < opts.MaxErrors {
+			report.Errors = append(report.Errors, le)
+		}
+		if opts.OnError != nil {
+			opts.OnError(le)
+		}
+	}
+
+	var batch []order.Order
+	var lines []int
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			report.NextLine = lines[0]
+			return err
+		}
+		results, errs, err := saver.SaveOrders(ctx, batch, order.SaveOptions{Policy: opts.Policy, DryRun: opts.DryRun})
+		if err != nil {
+			report.NextLine = lines[0]
+			return err
+		}
+		for i, o := range batch {
+			if errs[i] != nil {
+				fail(lines[i], o.OrderUID, errs[i])
+				continue
+			}
+			switch results[i] {
+			case order.SaveInserted:
+				report.Inserted++
+			case order.SaveUpdated:
+				report.Updated++
+			default:
+				report.Skipped++
+			}
+			metrics.ImportedOrders.WithLabelValues(results[i].String()).Inc()
+		}
+		batch, lines = batch[:0], lines[:0]
+		return nil
+	}
+
+	for {
+		rec, err := dec.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// Resume from the first order not saved: the pending batch or
+			// the order that could not be read.
+			var rerr *ReadError
+			switch {
+			case len(lines) > 0:
+				report.NextLine = lines[0]
+			case errors.As(err, &rerr):
+				report.NextLine = max(rerr.Line, opts.FromLine)
+			}
+			return report, err
+		}
+		if rec.Line < opts.FromLine {
+			continue
+		}
+		report.Orders++
+		if rec.Err == nil {
+			rec.Err = order.Validate(rec.Order)
+		}
+		if rec.Err != nil {
+			fail(rec.Line, rec.Order.OrderUID, rec.Err)
+			continue
+		}
+		batch = append(batch, rec.Order)
+		lines = append(lines, rec.Line)
+		if len(batch) >= opts.BatchSize {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, flush()
+}
@@ -0,0 +1,236 @@
+// Package transfer encodes and decodes streams of orders in the bulk formats
+// shared by the export and import endpoints and commands.
+package transfer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	"L0/internal/order"
+)
+
+type Format string
+
+const (
+	// NDJSON is one order per line as the API returns it.
+	NDJSON Format = "ndjson"
+	// CSV flattens the delivery and payment into columns and has one row per
+	// item; an order without items has one row with empty item columns.
+	CSV Format = "csv"
+	// JSON is one JSON array of orders.
+	JSON Format = "json"
+)
+
+// Formats lists the formats in order of preference.
+var Formats = []Format{NDJSON, CSV, JSON}
+
+// ParseTime accepts an RFC 3339 timestamp or a YYYY-MM-DD date, midnight
+// UTC, as the date bounds of the API and the commands do. An empty string is
+// the zero time.
+func ParseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, want RFC 3339 or YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// ParseFormat accepts ndjson, csv or json.
+func ParseFormat(name string) (Format, error) {
+	for _, f := range Formats {
+		if string(f) == name {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q, want ndjson, csv or json", name)
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case JSON:
+		return "application/json; charset=utf-8"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+// mediaTypes maps the media types accepted for each format.
+var mediaTypes = map[string]Format{
+	"application/x-ndjson": NDJSON,
+	"application/ndjson":   NDJSON,
+	"application/jsonl":    NDJSON,
+	"text/csv":             CSV,
+	"application/json":     JSON,
+}
+
+// MediaFormat returns the format of a Content-Type.
+func MediaFormat(contentType string) (Format, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+	f, ok := mediaTypes[mediaType]
+	return f, ok
+}
+
+// Negotiate picks the format for an Accept header: the acceptable media type
+// with the highest q, the earliest on ties. Wildcards and an empty header
+// give NDJSON. It reports false when no format is acceptable.
+func Negotiate(accept string) (Format, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return NDJSON, true
+	}
+	var best Format
+	bestQ := 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		f, ok := mediaTypes[mediaType]
+		if !ok && (mediaType == "*/*" || mediaType == "application/*") {
+			f, ok = NDJSON, true
+		}
+		if !ok && mediaType == "text/*" {
+			f, ok = CSV, true
+		}
+		if ok && q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// Encoder writes orders one at a time. Nothing is written before the first
+// Encode or Close, so callers can still report an error that comes first.
+type Encoder interface {
+	Encode(o order.Order) error
+	// Close writes what ends the stream, e.g. the closing bracket of JSON.
+	Close() error
+}
+
+func NewEncoder(w io.Writer, f Format) Encoder {
+	switch f {
+	case CSV:
+		return &csvEncoder{w: csv.NewWriter(w)}
+	case JSON:
+		return &jsonEncoder{w: w}
+	default:
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}
+	}
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) Encode(o order.Order) error { return e.enc.Encode(o) }
+func (e *ndjsonEncoder) Close() error               { return nil }
+
+type jsonEncoder struct {
+	w       io.Writer
+	started bool
+}
+
+func (e *jsonEncoder) Encode(o order.Order) error {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if !e.started {
+		sep, e.started = "[\n", true
+	}
+	if _, err := io.WriteString(e.w, sep); err != nil {
+		return err
+	}
+	_, err = e.w.Write(b)
+	return err
+}
+
+func (e *jsonEncoder) Close() error {
+	end := "\n]\n"
+	if !e.started {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+// CSVHeader names the CSV columns. Delivery, payment and item columns are
+// prefixed with delivery_, payment_ and item_.
+var CSVHeader = []string{
+	"order_uid", "track_number", "entry", "locale", "internal_signature", "customer_id",
+	"delivery_service", "shardkey", "sm_id", "date_created", "oof_shard",
+	"delivery_name", "delivery_phone", "delivery_zip", "delivery_city", "delivery_address", "delivery_region", "delivery_email",
+	"payment_transaction", "payment_request_id", "payment_currency", "payment_provider", "payment_amount",
+	"payment_dt", "payment_bank", "payment_delivery_cost", "payment_goods_total", "payment_custom_fee",
+	"item_chrt_id", "item_track_number", "item_price", "item_rid", "item_name", "item_sale",
+	"item_size", "item_total_price", "item_nm_id", "item_brand", "item_status",
+}
+
+type csvEncoder struct {
+	w       *csv.Writer
+	started bool
+}
+
+func (e *csvEncoder) Encode(o order.Order) error {
+	if !e.started {
+		e.started = true
+		if err := e.w.Write(CSVHeader); err != nil {
+			return err
+		}
+	}
+	d, p := o.Delivery, o.Payment
+	head := []string{
+		o.OrderUID, o.TrackNumber, o.Entry, o.Locale, o.InternalSignature, o.CustomerID,
+		o.DeliveryService, o.ShardKey, strconv.Itoa(o.SmID), o.DateCreated.UTC().Format(time.RFC3339Nano), o.OofShard,
+		d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email,
+		p.Transaction, p.RequestID, p.Currency, p.Provider, strconv.Itoa(p.Amount),
+		strconv.FormatInt(p.PaymentDt, 10), p.Bank, strconv.Itoa(p.DeliveryCost), strconv.Itoa(p.GoodsTotal), strconv.Itoa(p.CustomFee),
+	}
+	if len(o.Products) == 0 {
+		return e.w.Write(append(head, make([]string, len(CSVHeader)-len(head))...))
+	}
+	for _, it := range o.Products {
+		row := append(head[:len(head):len(head)],
+			strconv.Itoa(it.ChrtID), it.TrackNumber, strconv.Itoa(it.Price), it.Rid, it.Name, strconv.Itoa(it.Sale),
+			it.Size, strconv.Itoa(it.TotalPrice), strconv.Itoa(it.NmID), it.Brand, strconv.Itoa(it.Status),
+		)
+		if err := e.w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *csvEncoder) Close() error {
+	if !e.started {
+		e.started = true
+		if err := e.w.Write(CSVHeader); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
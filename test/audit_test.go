@@ -0,0 +1,41 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"L0/internal/audit"
+	"L0/internal/order"
+)
+
+func TestAuditDiff(t *testing.T) {
+	before := order.Order{OrderUID: "order1", Delivery: order.Delivery{Phone: "+1"}}
+	after := before
+	after.Delivery.Phone = "+2"
+
+	e, err := audit.NewEntry(context.Background(), "order1", audit.ActionUpdate, before, after)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(e.Diff) != 1 {
+		t.Fatalf("expected exactly one changed field, got %v", e.Diff)
+	}
+	ch, ok := e.Diff["delivery.phone"]
+	if !ok || ch.Before != "+1" || ch.After != "+2" {
+		t.Fatalf("unexpected change: %+v", ch)
+	}
+	if e.Source.Kind != audit.SourceSystem {
+		t.Fatalf("expected system source without context, got %q", e.Source.Kind)
+	}
+}
+
+func TestAuditDiffDeleted(t *testing.T) {
+	diff, err := audit.Diff(json.RawMessage(`{"a":1,"b":{"c":"x"}}`), nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(diff) != 2 || diff["b.c"].Before != "x" || diff["b.c"].After != nil {
+		t.Fatalf("unexpected diff: %v", diff)
+	}
+}
@@ -0,0 +1,195 @@
+package test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"L0/internal/api"
+	"L0/internal/audit"
+	"L0/internal/auth"
+	"L0/internal/config"
+	"L0/internal/order"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testJWTSecret = "test-secret"
+
+func authRouter(t *testing.T, ms *mockService, cfg config.AuthConf) http.Handler {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	cfg.Enabled = true
+	a, err := auth.New(cfg)
+	if err != nil {
+		t.Fatalf("auth: %v", err)
+	}
+	return api.NewHandler(ms, api.WithAuth(a)).RegisterOrderRouter()
+}
+
+func piiOrder() order.Order {
+	o := makeValidOrder("order-pii")
+	o.Delivery.Email = "test@example.com"
+	return o
+}
+
+func doRequest(r http.Handler, method, path string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func hsToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return s
+}
+
+func TestAuthRejectsMissingAndInvalidCredentials(t *testing.T) {
+	r := authRouter(t, &mockService{order: piiOrder()}, config.AuthConf{APIKeys: "ci:viewer:k1", JWTSecret: testJWTSecret})
+
+	if rec := doRequest(r, http.MethodGet, "/orders/order-pii", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, got %d", rec.Code)
+	}
+	if rec := doRequest(r, http.MethodGet, "/orders/order-pii", map[string]string{"X-API-Key": "wrong"}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for unknown key, got %d", rec.Code)
+	}
+	expired := hsToken(t, jwt.MapClaims{"sub": "u1", "role": "admin", "exp": time.Now().Add(-time.Minute).Unix()})
+	if rec := doRequest(r, http.MethodGet, "/orders/order-pii", map[string]string{"Authorization": "Bearer " + expired}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for expired token, got %d", rec.Code)
+	}
+	if rec := doRequest(r, http.MethodGet, "/healthcheck", nil); rec.Code != http.StatusOK {
+		t.Fatalf("healthcheck must stay public, got %d", rec.Code)
+	}
+}
+
+func TestAuthEnforcesRoles(t *testing.T) {
+	ms := &mockService{order: piiOrder()}
+	r := authRouter(t, ms, config.AuthConf{APIKeys: "viewer:viewer:k1, ops:admin:k2"})
+
+	viewer := map[string]string{"X-API-Key": "k1"}
+	if rec := doRequest(r, http.MethodGet, "/orders/order-pii", viewer); rec.Code != http.StatusOK {
+		t.Fatalf("viewer GET: expected 200, got %d", rec.Code)
+	}
+	if rec := doRequest(r, http.MethodDelete, "/orders/order-pii", viewer); rec.Code != http.StatusForbidden {
+		t.Fatalf("viewer DELETE: expected 403, got %d", rec.Code)
+	}
+	if len(ms.deleted) != 0 {
+		t.Fatalf("forbidden delete reached the service")
+	}
+
+	admin := map[string]string{"Authorization": "ApiKey k2", "X-Actor": "spoofed"}
+	if rec := doRequest(r, http.MethodDelete, "/orders/order-pii", admin); rec.Code != http.StatusNoContent && rec.Code != http.StatusOK {
+		t.Fatalf("admin DELETE: unexpected %d", rec.Code)
+	}
+	if len(ms.sources) != 1 || ms.sources[0].Actor != "ops" || ms.sources[0].Kind != audit.SourceHTTP {
+		t.Fatalf("audit actor must come from the principal, got %+v", ms.sources)
+	}
+}
+
+func TestAuthMasksPIIWithoutScope(t *testing.T) {
+	r := authRouter(t, &mockService{order: piiOrder()}, config.AuthConf{JWTSecret: testJWTSecret})
+	exp := time.Now().Add(time.Hour).Unix()
+
+	plain := hsToken(t, jwt.MapClaims{"sub": "u1", "role": "viewer", "exp": exp})
+	rec := doRequest(r, http.MethodGet, "/orders/order-pii", map[string]string{"Authorization": "Bearer " + plain})
+	var got order.Order
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Delivery.Name != order.MaskedValue || got.Delivery.Email != order.MaskedValue || got.CustomerID != order.MaskedValue {
+		t.Fatalf("expected masked personal data, got %+v", got.Delivery)
+	}
+	if got.Delivery.City != piiOrder().Delivery.City {
+		t.Fatalf("non-personal fields must stay readable")
+	}
+
+	scoped := hsToken(t, jwt.MapClaims{"sub": "u2", "role": "viewer", "scope": "orders pii:read", "exp": exp})
+	rec = doRequest(r, http.MethodGet, "/orders/order-pii", map[string]string{"Authorization": "Bearer " + scoped})
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.Delivery.Name != piiOrder().Delivery.Name {
+		t.Fatalf("pii:read must see personal data, got %q", got.Delivery.Name)
+	}
+}
+
+func TestAuthMasksAuditSnapshots(t *testing.T) {
+	before, _ := json.Marshal(piiOrder())
+	entry := audit.Entry{OrderUID: "order-pii", Action: audit.ActionUpdate, Before: before, After: before,
+		Diff: map[string]audit.Change{"delivery.phone": {Before: "+1", After: "+2"}}}
+	r := authRouter(t, &mockService{audit: []audit.Entry{entry}}, config.AuthConf{APIKeys: "ops:operator:k1"})
+
+	rec := doRequest(r, http.MethodGet, "/orders/order-pii/audit", map[string]string{"X-API-Key": "k1"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var got []audit.Entry
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	var snap order.Order
+	_ = json.Unmarshal(got[0].Before, &snap)
+	if snap.Delivery.Phone != order.MaskedValue || got[0].Diff["delivery.phone"].After != order.MaskedValue {
+		t.Fatalf("audit must be masked: %+v", got[0])
+	}
+}
+
+func TestAuthRS256WithJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+	jwks := map[string]any{"keys": []map[string]string{{
+		"kty": "RSA", "kid": "k1", "use": "sig",
+		"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	data, _ := json.Marshal(jwks)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	r := authRouter(t, &mockService{order: piiOrder()}, config.AuthConf{JWKSFile: path, JWTIssuer: "issuer"})
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "svc", "role": "admin", "iss": "issuer", "exp": time.Now().Add(time.Hour).Unix()})
+	tok.Header["kid"] = "k1"
+	signed, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if rec := doRequest(r, http.MethodGet, "/orders/order-pii", map[string]string{"Authorization": "Bearer " + signed}); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	// An HS256 token must not be accepted when only RS256 is configured.
+	forged := hsToken(t, jwt.MapClaims{"sub": "x", "role": "admin", "iss": "issuer", "exp": time.Now().Add(time.Hour).Unix()})
+	if rec := doRequest(r, http.MethodGet, "/orders/order-pii", map[string]string{"Authorization": "Bearer " + forged}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for HS256 token, got %d", rec.Code)
+	}
+}
+
+func TestParseAPIKeysRejectsMalformedEntries(t *testing.T) {
+	if _, err := auth.ParseAPIKeys("justakey"); err == nil {
+		t.Fatalf("expected error")
+	}
+	if _, err := auth.ParseAPIKeys("ci:root:k"); err == nil {
+		t.Fatalf("expected unknown role error")
+	}
+}
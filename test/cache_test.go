@@ -46,3 +46,42 @@ func TestCacheLoad(t *testing.T) {
 		}
 	}
 }
+
+func TestCacheDelete(t *testing.T) {
+	c := cache.NewCache(3)
+	c.Load([]order.Order{makeSampleOrder("order1"), makeSampleOrder("order2")})
+
+	c.Delete("order1")
+	if _, ok := c.Get("order1"); ok {
+		t.Fatalf("expected order order1 to be deleted")
+	}
+	recent := c.GetRecent(10)
+	if len(recent) != 1 || recent[0].OrderUID != "order2" {
+		t.Fatalf("unexpected recent orders: %+v", recent)
+	}
+
+	c.Delete("missing")
+	if len(c.GetRecent(10)) != 1 {
+		t.Fatalf("deleting missing key must not change cache")
+	}
+}
+
+func TestCacheSetSize(t *testing.T) {
+	c := cache.NewCache(3)
+	c.Load([]order.Order{makeSampleOrder("order1"), makeSampleOrder("order2"), makeSampleOrder("order3")})
+
+	c.SetSize(1)
+	recent := c.GetRecent(10)
+	if len(recent) != 1 || recent[0].OrderUID != "order3" {
+		t.Fatalf("expected only the newest order, got %+v", recent)
+	}
+	if _, ok := c.Get("order1"); ok {
+		t.Fatalf("evicted orders must be gone")
+	}
+
+	c.SetSize(2)
+	c.Set(makeSampleOrder("order4"))
+	if len(c.GetRecent(10)) != 2 {
+		t.Fatalf("grown cache must keep two orders")
+	}
+}
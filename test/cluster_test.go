@@ -0,0 +1,170 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"L0/internal/db"
+	"L0/internal/health"
+	"L0/internal/order"
+)
+
+// newTestCluster returns a cluster of a primary and two replicas, all
+// healthy.
+func newTestCluster(t *testing.T) (*db.Cluster, *fakeDB, []*fakeDB) {
+	t.Helper()
+	primary := &fakeDB{}
+	replicas := []*fakeDB{{}, {}}
+	c := db.NewCluster(primary, time.Second)
+	c.AddReplica("r1", replicas[0])
+	c.AddReplica("r2", replicas[1])
+	c.CheckReplicas(context.Background())
+	return c, primary, replicas
+}
+
+// readFrom runs a read and reports which client served it last.
+func readFrom(c *db.Cluster, ctx context.Context, fail map[db.Client]error) (db.Client, error) {
+	var used db.Client
+	err := c.Read(ctx, func(client db.Client) error {
+		used = client
+		return fail[client]
+	})
+	return used, err
+}
+
+func TestClusterReadsFromReplicas(t *testing.T) {
+	c, primary, replicas := newTestCluster(t)
+	seen := map[db.Client]int{}
+	for range 4 {
+		used, err := readFrom(c, context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[used]++
+	}
+	if seen[primary] != 0 || seen[replicas[0]] != 2 || seen[replicas[1]] != 2 {
+		t.Fatalf("reads should alternate between replicas, got primary=%d r1=%d r2=%d",
+			seen[primary], seen[replicas[0]], seen[replicas[1]])
+	}
+}
+
+func TestClusterFallsBackToPrimary(t *testing.T) {
+	c, primary, replicas := newTestCluster(t)
+	fail := map[db.Client]error{
+		replicas[0]: order.ErrOrderNotFound,
+		replicas[1]: errors.New("connection reset"),
+	}
+	for range 2 {
+		used, err := readFrom(c, context.Background(), fail)
+		if err != nil || used != primary {
+			t.Fatalf("failed replica read should be retried on the primary, got %v, %v", used, err)
+		}
+	}
+
+	fail[primary] = order.ErrOrderNotFound
+	if _, err := readFrom(c, context.Background(), fail); !errors.Is(err, order.ErrOrderNotFound) {
+		t.Fatalf("primary error should be returned, got %v", err)
+	}
+}
+
+func TestClusterPrimaryRequired(t *testing.T) {
+	c, primary, _ := newTestCluster(t)
+
+	if used, _ := readFrom(c, db.WithPrimary(context.Background()), nil); used != primary {
+		t.Fatalf("WithPrimary should read from the primary")
+	}
+
+	ctx := db.WithSession(context.Background())
+	if used, _ := readFrom(c, ctx, nil); used == primary {
+		t.Fatalf("session without writes should read from a replica")
+	}
+	db.MarkWritten(ctx)
+	if used, _ := readFrom(c, ctx, nil); used != primary {
+		t.Fatalf("session after a write should read from the primary")
+	}
+
+	// Without a session, MarkWritten has nothing to record.
+	plain := context.Background()
+	db.MarkWritten(plain)
+	if used, _ := readFrom(c, plain, nil); used == primary {
+		t.Fatalf("reads outside a session should use replicas")
+	}
+}
+
+func TestClusterExcludesLaggingReplica(t *testing.T) {
+	c, _, replicas := newTestCluster(t)
+	replicas[0].setLag(5, nil)
+	replicas[1].setLag(0, errors.New("connection refused"))
+	c.CheckReplicas(context.Background())
+
+	for _, name := range c.Replicas() {
+		if err := c.ReplicaCheck(name)(context.Background()); err == nil {
+			t.Fatalf("replica %s should be reported unhealthy", name)
+		}
+	}
+	if used, _ := readFrom(c, context.Background(), nil); used == replicas[0] || used == replicas[1] {
+		t.Fatalf("unhealthy replicas should not serve reads")
+	}
+
+	replicas[0].setLag(0.2, nil)
+	c.CheckReplicas(context.Background())
+	if err := c.ReplicaCheck("r1")(context.Background()); err != nil {
+		t.Fatalf("caught up replica should be healthy: %v", err)
+	}
+	if used, _ := readFrom(c, context.Background(), nil); used != replicas[0] {
+		t.Fatalf("caught up replica should serve reads again")
+	}
+}
+
+func TestClusterExcludesReplicaWithoutWALReceiver(t *testing.T) {
+	c, _, replicas := newTestCluster(t)
+	// lagQuery reports an infinite lag for a replica that lost its WAL
+	// receiver before replaying anything.
+	replicas[0].setLag(math.Inf(1), nil)
+	c.CheckReplicas(context.Background())
+	err := c.ReplicaCheck("r1")(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "WAL receiver") {
+		t.Fatalf("replica without WAL receiver should be unhealthy, got %v", err)
+	}
+}
+
+func TestClusterMonitor(t *testing.T) {
+	c, _, replicas := newTestCluster(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Monitor(ctx, 5*time.Millisecond)
+		close(done)
+	}()
+	replicas[0].setLag(5, nil)
+	deadline := time.Now().Add(2 * time.Second)
+	for c.ReplicaCheck("r1")(context.Background()) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("monitor did not recheck the replica")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+func TestCheckerOptionalComponent(t *testing.T) {
+	c := health.NewChecker(time.Second)
+	c.Add("postgres", func(ctx context.Context) error { return nil })
+	c.AddOptional("replica", func(ctx context.Context) error { return errors.New("lag 12s exceeds 10s") })
+
+	r := c.Run(context.Background())
+	if r.Status != health.StatusUp {
+		t.Fatalf("optional component should not fail the report: %+v", r)
+	}
+	if got := r.Components["replica"]; got.Status != health.StatusDown || !got.Optional {
+		t.Fatalf("unexpected replica component %+v", got)
+	}
+	if r.Components["postgres"].Optional {
+		t.Fatalf("required component marked optional")
+	}
+}
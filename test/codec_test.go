@@ -0,0 +1,357 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"L0/internal/config"
+	"L0/internal/kafka"
+	"L0/internal/logger"
+	"L0/internal/order"
+
+	kafkago "github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// fakeRegistry is an in-memory schema registry speaking the subset of the
+// Confluent API the client uses.
+type fakeRegistry struct {
+	mu       sync.Mutex
+	schemas  []string
+	subjects map[string][]int
+	// incompatible makes compatibility checks fail.
+	incompatible bool
+	requests     []string
+}
+
+func newFakeRegistry() *fakeRegistry {
+	return &fakeRegistry{subjects: map[string][]int{}}
+}
+
+// add registers schema under subject directly and returns its id.
+func (f *fakeRegistry) add(subject, schema string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.schemas = append(f.schemas, schema)
+	id := len(f.schemas)
+	f.subjects[subject] = append(f.subjects[subject], id)
+	return id
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	w.Header().Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	fail := func(status, code int, msg string) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]any{"error_code": code, "message": msg})
+	}
+	if user, pass, _ := r.BasicAuth(); user != "registry" || pass != "secret" {
+		fail(http.StatusUnauthorized, 401, "Unauthorized")
+		return
+	}
+	var body struct {
+		Schema string `json:"schema"`
+	}
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			fail(http.StatusUnprocessableEntity, 42201, "Invalid schema")
+			return
+		}
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "schemas" && parts[1] == "ids":
+		id, _ := strconv.Atoi(parts[2])
+		if id < 1 || id > len(f.schemas) {
+			fail(http.StatusNotFound, 40403, "Schema not found")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"schema": f.schemas[id-1]})
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "subjects" && parts[2] == "versions":
+		for _, id := range f.subjects[parts[1]] {
+			if f.schemas[id-1] == body.Schema {
+				json.NewEncoder(w).Encode(map[string]int{"id": id})
+				return
+			}
+		}
+		f.schemas = append(f.schemas, body.Schema)
+		f.subjects[parts[1]] = append(f.subjects[parts[1]], len(f.schemas))
+		json.NewEncoder(w).Encode(map[string]int{"id": len(f.schemas)})
+	case r.Method == http.MethodPost && len(parts) == 5 && parts[0] == "compatibility":
+		if len(f.subjects[parts[2]]) == 0 {
+			fail(http.StatusNotFound, 40401, "Subject not found")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]bool{"is_compatible": !f.incompatible})
+	default:
+		fail(http.StatusNotFound, 404, "Not found")
+	}
+}
+
+func registryConf(t *testing.T, format string) (config.KafkaConf, *fakeRegistry) {
+	t.Helper()
+	reg := newFakeRegistry()
+	srv := httptest.NewServer(reg)
+	t.Cleanup(srv.Close)
+	return config.KafkaConf{
+		Topic:         "orders",
+		MessageFormat: format,
+		SchemaRegistry: config.SchemaRegistryConf{
+			URL: srv.URL, Username: "registry", Password: "secret", Timeout: time.Second,
+		},
+	}, reg
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	want := makeValidOrder("order-codec")
+	want.Products = append(want.Products, order.Product{ChrtID: 2, TrackNumber: want.TrackNumber, Name: "second", Status: 202})
+	want.Payment.PaymentDt = 1637907727
+	want.SmID = 99
+	want.PayloadVersion = order.CurrentPayloadVersion
+	ctx := context.Background()
+
+	for _, tc := range []struct{ format, contentType string }{
+		{"json", kafka.ContentTypeJSON},
+		{"protobuf", kafka.ContentTypeProtobuf},
+		{"avro", kafka.ContentTypeAvro},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			cfg, _ := registryConf(t, tc.format)
+			codecs, err := kafka.NewCodecs(cfg, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg, err := codecs.EncodeMessage(ctx, want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(msg.Headers) != 1 || msg.Headers[0].Key != kafka.ContentTypeHeader || string(msg.Headers[0].Value) != tc.contentType {
+				t.Fatalf("unexpected headers %v", msg.Headers)
+			}
+			got, err := codecs.Decode(ctx, msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("round trip mismatch:\ngot  %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestCodecsSelectByContentType(t *testing.T) {
+	ctx := context.Background()
+	codecs := kafka.DefaultCodecs()
+	o := makeValidOrder("order-header")
+
+	plain := orderMessage(t, o, 1, time.Now())
+	if got, err := codecs.Decode(ctx, plain); err != nil || got.OrderUID != o.OrderUID {
+		t.Fatalf("messages without content type should be JSON: %+v, %v", got, err)
+	}
+
+	plain.Headers = []kafkago.Header{{Key: kafka.ContentTypeHeader, Value: []byte("application/json; charset=utf-8")}}
+	if _, err := codecs.Decode(ctx, plain); err != nil {
+		t.Fatalf("content type parameters should be ignored: %v", err)
+	}
+
+	plain.Headers = []kafkago.Header{{Key: kafka.ContentTypeHeader, Value: []byte(kafka.ContentTypeAvro)}}
+	if _, err := codecs.Decode(ctx, plain); err == nil || !strings.Contains(err.Error(), "unsupported content type") {
+		t.Fatalf("Avro without a registry should be unsupported, got %v", err)
+	}
+
+	if _, err := kafka.NewCodecs(config.KafkaConf{MessageFormat: "avro"}, false); err == nil {
+		t.Fatal("expected avro without a registry to be rejected")
+	}
+}
+
+func TestProtobufSkipsUnknownFields(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.KafkaConf{MessageFormat: "protobuf"}
+	codecs, err := kafka.NewCodecs(cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := makeValidOrder("order-proto")
+	want.PayloadVersion = order.CurrentPayloadVersion
+	msg, err := codecs.EncodeMessage(ctx, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A field added to the schema later, unknown to this consumer.
+	msg.Value = protowire.AppendTag(msg.Value, 99, protowire.BytesType)
+	msg.Value = protowire.AppendString(msg.Value, "future")
+	got, err := codecs.Decode(ctx, msg)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("Decode = %+v, %v", got, err)
+	}
+
+	msg.Value = []byte{0x0a, 0x05, 'x'}
+	if _, err := codecs.Decode(ctx, msg); err == nil {
+		t.Fatal("expected a truncated message to fail")
+	}
+}
+
+func TestAvroChecksCompatibilityBeforePublishing(t *testing.T) {
+	ctx := context.Background()
+	cfg, reg := registryConf(t, "avro")
+	reg.add("orders-value", `{"type": "record", "name": "Order", "namespace": "orders.v1", "fields": [{"name": "order_uid", "type": "string"}]}`)
+	reg.incompatible = true
+	codecs, err := kafka.NewCodecs(cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := codecs.EncodeMessage(ctx, makeValidOrder("order-1")); !errors.Is(err, kafka.ErrIncompatibleSchema) {
+		t.Fatalf("expected ErrIncompatibleSchema, got %v", err)
+	}
+	if len(reg.subjects["orders-value"]) != 1 {
+		t.Fatal("an incompatible schema must not be registered")
+	}
+
+	reg.incompatible = false
+	for range 2 {
+		if _, err := codecs.EncodeMessage(ctx, makeValidOrder("order-1")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"POST /compatibility/subjects/orders-value/versions/latest",
+		"POST /compatibility/subjects/orders-value/versions/latest",
+		"POST /subjects/orders-value/versions",
+	}
+	if !reflect.DeepEqual(reg.requests, want) {
+		t.Fatalf("expected one check and registration per process, got %v", reg.requests)
+	}
+}
+
+func TestAvroReadsOtherWriterSchema(t *testing.T) {
+	ctx := context.Background()
+	cfg, reg := registryConf(t, "avro")
+	codecs, err := kafka.NewCodecs(cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := makeValidOrder("order-avro")
+	want.PayloadVersion = order.CurrentPayloadVersion
+	msg, err := codecs.EncodeMessage(ctx, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A producer with a newer schema adds a trailing string field, which
+	// this consumer does not know and must skip.
+	const last = `{"name": "oof_shard", "type": "string"}`
+	newer := strings.Replace(kafka.OrderSchema, last, last+`, {"name": "note", "type": "string"}`, 1)
+	id := reg.add("orders-value", newer)
+	value := append([]byte{0, 0, 0, 0, byte(id)}, msg.Value[5:]...)
+	value = append(value, 0x04, 'h', 'i')
+	msg.Value = value
+
+	got, err := codecs.Decode(ctx, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("decoded %+v", got)
+	}
+
+	msg.Value = []byte(`{"order_uid": "x"}`)
+	if _, err := codecs.Decode(ctx, msg); err == nil {
+		t.Fatal("expected a message without the wire format header to fail")
+	}
+}
+
+func TestConsumerDecodesByContentType(t *testing.T) {
+	ms := &mockService{}
+	codecs, err := kafka.NewCodecs(config.KafkaConf{MessageFormat: "protobuf"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := codecs.EncodeMessage(context.Background(), makeValidOrder("order-pb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Topic = "orders"
+	r := &fakeReader{msgs: []kafkago.Message{msg}}
+	c := kafka.NewConsumer(r, ms, nil, logger.Discard())
+	c.SetCodecs(codecs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+	waitFor(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.committed) == 1
+	})
+	cancel()
+	<-done
+	if len(ms.saved) != 1 || ms.saved[0].OrderUID != "order-pb" {
+		t.Fatalf("unexpected saved orders %v", ms.saved)
+	}
+}
+
+func TestCreateOrderPublishesWithEncoder(t *testing.T) {
+	w := &writerRec{}
+	svc := order.NewOrderService(&mockRepo{}, &mockCache{}, w, nil, nil)
+	codecs, err := kafka.NewCodecs(config.KafkaConf{MessageFormat: "protobuf"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.SetEncoder(codecs)
+
+	created, err := svc.CreateOrder(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := kafkago.Message{Value: w.last, Headers: w.headers}
+	got, err := codecs.Decode(context.Background(), msg)
+	if err != nil || got.OrderUID != created.OrderUID {
+		t.Fatalf("published message decodes to %+v, %v", got, err)
+	}
+}
+
+func TestRegistryEscapesSubject(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.EscapedPath())
+		mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"id": 1, "is_compatible": true})
+	}))
+	defer srv.Close()
+
+	reg, err := kafka.NewRegistry(config.SchemaRegistryConf{URL: srv.URL + "/registry/", Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	subject := "team/orders value"
+	if ok, err := reg.Compatible(ctx, subject, `"string"`); err != nil || !ok {
+		t.Fatalf("Compatible = %v, %v", ok, err)
+	}
+	if id, err := reg.Register(ctx, subject, `"string"`); err != nil || id != 1 {
+		t.Fatalf("Register = %d, %v", id, err)
+	}
+	want := []string{
+		"/registry/compatibility/subjects/team%2Forders%20value/versions/latest",
+		"/registry/subjects/team%2Forders%20value/versions",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("paths = %v, want %v", paths, want)
+	}
+}
@@ -0,0 +1,297 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"L0/internal/config"
+)
+
+// unsetenv removes name for the duration of the test.
+func unsetenv(t *testing.T, name string) {
+	t.Helper()
+	t.Setenv(name, "")
+	os.Unsetenv(name)
+}
+
+func writeSecret(t *testing.T, value string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte(value), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSecretFromFile(t *testing.T) {
+	t.Setenv("APP_PROFILE", "prod")
+	unsetenv(t, "DB_PASSWORD")
+	t.Setenv("DB_PASSWORD_FILE", writeSecret(t, "from-file\n"))
+	t.Setenv("AUTH_JWT_SECRET_FILE", writeSecret(t, "jwt secret"))
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DB.Password != "from-file" || cfg.Auth.JWTSecret != "jwt secret" {
+		t.Fatalf("unexpected secrets %q %q", cfg.DB.Password, cfg.Auth.JWTSecret)
+	}
+}
+
+func TestLoadSecretFileErrors(t *testing.T) {
+	t.Setenv("APP_PROFILE", "dev")
+	t.Setenv("DB_PASSWORD", "inline")
+	t.Setenv("DB_PASSWORD_FILE", writeSecret(t, "from-file"))
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "DB_PASSWORD_FILE") {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+
+	unsetenv(t, "DB_PASSWORD")
+	t.Setenv("DB_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := config.Load(); err == nil {
+		t.Fatalf("expected error for missing file")
+	}
+}
+
+func TestLoadRefusesDefaultCredentials(t *testing.T) {
+	unsetenv(t, "DB_PASSWORD")
+	unsetenv(t, "DB_PASSWORD_FILE")
+
+	t.Setenv("APP_PROFILE", "prod")
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "DB_PASSWORD") {
+		t.Fatalf("expected default credentials to be refused, got %v", err)
+	}
+	t.Setenv("APP_PROFILE", config.ProfileDev)
+	if _, err := config.Load(); err != nil {
+		t.Fatalf("dev profile should allow defaults: %v", err)
+	}
+}
+
+func TestLoadRequiresAuthOutsideDev(t *testing.T) {
+	t.Setenv("APP_PROFILE", "prod")
+	t.Setenv("DB_PASSWORD", "not-the-default")
+	unsetenv(t, "AUTH_ENABLED")
+	cfg, err := config.Load()
+	if err != nil || !cfg.Auth.Enabled {
+		t.Fatalf("auth must be enabled by default, got %v, %v", cfg.Auth.Enabled, err)
+	}
+
+	t.Setenv("AUTH_ENABLED", "false")
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "AUTH_ENABLED") {
+		t.Fatalf("expected disabled auth to be refused outside dev, got %v", err)
+	}
+	t.Setenv("APP_PROFILE", config.ProfileDev)
+	if _, err := config.Load(); err != nil {
+		t.Fatalf("dev profile should allow disabled auth: %v", err)
+	}
+}
+
+func TestConfigStringRedactsSecrets(t *testing.T) {
+	var cfg config.Config
+	cfg.DB.Password = "db-pass"
+	cfg.Auth.APIKeys = "ci:admin:key-value"
+	cfg.Kafka.SASL.Password = "sasl-pass"
+	cfg.DB.User = "orders"
+
+	s := cfg.String()
+	for _, secret := range []string{"db-pass", "key-value", "sasl-pass"} {
+		if strings.Contains(s, secret) {
+			t.Fatalf("secret %q leaked: %s", secret, s)
+		}
+	}
+	if !strings.Contains(s, `"orders"`) {
+		t.Fatalf("non-secret fields must be kept: %s", s)
+	}
+	if r := cfg.Redacted(); r.Auth.JWTSecret != "" || cfg.DB.Password != "db-pass" {
+		t.Fatalf("empty secrets stay empty and the original is not modified")
+	}
+}
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoaderLayers(t *testing.T) {
+	t.Setenv("APP_PROFILE", config.ProfileDev)
+	unsetenv(t, "CACHE_SIZE")
+	unsetenv(t, "KAFKA_TOPIC")
+	unsetenv(t, "LOG_LEVEL")
+	unsetenv(t, "HTTP_PORT")
+	dotenv := writeConfigFile(t, ".env", "CACHE_SIZE=100\nHTTP_PORT=9090\n")
+	path := writeConfigFile(t, "app.yaml", `
+cache_size: 500
+log_level: warn
+kafka:
+  topic: from-file
+  brokers: [b1:9092, b2:9092]
+  tls:
+    enabled: true
+rate_limit_read_rps: 7.5
+`)
+	t.Setenv("KAFKA_TOPIC", "from-env")
+	t.Setenv("LOG_LEVEL", "info")
+
+	l := config.NewLoader()
+	l.SetDotenv(dotenv)
+	rest, err := l.Parse([]string{"-config", path, "-log-level", "error", "replay", "-from", "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 3 || rest[0] != "replay" {
+		t.Fatalf("unexpected rest %v", rest)
+	}
+	cfg, err := l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CacheSize != 500 || !cfg.Kafka.TLS.Enabled || cfg.RateLimit.ReadRPS != 7.5 {
+		t.Fatalf("file values not applied: %+v", cfg)
+	}
+	if cfg.HTTPPort != "9090" {
+		t.Fatalf(".env values not applied below the file, got %q", cfg.HTTPPort)
+	}
+	if len(cfg.Kafka.Brokers) != 2 || cfg.Kafka.Brokers[1] != "b2:9092" {
+		t.Fatalf("unexpected brokers %v", cfg.Kafka.Brokers)
+	}
+	if cfg.Kafka.Topic != "from-env" {
+		t.Fatalf("env must override the file, got %q", cfg.Kafka.Topic)
+	}
+	if cfg.LogLevel != "error" {
+		t.Fatalf("flags must override env, got %q", cfg.LogLevel)
+	}
+	if cfg.DB.Host != "localhost" {
+		t.Fatalf("defaults must fill the rest, got %q", cfg.DB.Host)
+	}
+}
+
+func TestLoaderTOMLFile(t *testing.T) {
+	t.Setenv("APP_PROFILE", config.ProfileDev)
+	unsetenv(t, "SHUTDOWN_TIMEOUT")
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, "app.toml", `
+shutdown_timeout = "40s"
+
+[db]
+sslmode = "require"
+`))
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ShutdownTimeout.String() != "40s" || cfg.DB.SSLMode != "require" {
+		t.Fatalf("unexpected %v %q", cfg.ShutdownTimeout, cfg.DB.SSLMode)
+	}
+}
+
+func TestLoaderRejectsUnknownFileKey(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, "app.yaml", "kafka:\n  partiton: 3\n"))
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "kafka_partiton") {
+		t.Fatalf("expected unknown key error, got %v", err)
+	}
+}
+
+func TestLoaderReportsAllErrors(t *testing.T) {
+	t.Setenv("APP_PROFILE", config.ProfileDev)
+	unsetenv(t, "CONFIG_FILE")
+	t.Setenv("CACHE_SIZE", "0")
+	t.Setenv("KAFKA_BROKERS", "")
+	t.Setenv("HTTP_PORT", "99999")
+	t.Setenv("TRACING_SAMPLE_RATIO", "2")
+
+	_, err := config.Load()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, name := range []string{"CACHE_SIZE", "KAFKA_BROKERS", "HTTP_PORT", "TRACING_SAMPLE_RATIO"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error does not mention %s: %v", name, err)
+		}
+	}
+
+	t.Setenv("SHUTDOWN_TIMEOUT", "soon")
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "SHUTDOWN_TIMEOUT") {
+		t.Fatalf("expected parse error, got %v", err)
+	}
+}
+
+func TestValidateArchiveSettings(t *testing.T) {
+	t.Setenv("APP_PROFILE", config.ProfileDev)
+	unsetenv(t, "CONFIG_FILE")
+	t.Setenv("ARCHIVE_STORAGE", "s3")
+	t.Setenv("ARCHIVE_S3_ENDPOINT", "minio:9000")
+	t.Setenv("ARCHIVE_AFTER_MONTHS", "6")
+	t.Setenv("ORDER_RETENTION_MONTHS", "6")
+
+	_, err := config.Load()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, name := range []string{"ARCHIVE_S3_ENDPOINT", "ARCHIVE_S3_BUCKET", "ARCHIVE_S3_SECRET_KEY", "ARCHIVE_AFTER_MONTHS"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error does not mention %s: %v", name, err)
+		}
+	}
+
+	t.Setenv("ARCHIVE_STORAGE", "local")
+	t.Setenv("ORDER_RETENTION_MONTHS", "12")
+	if _, err := config.Load(); err != nil {
+		t.Fatalf("local storage needs no S3 settings: %v", err)
+	}
+}
+
+func TestValidateMessageFormat(t *testing.T) {
+	t.Setenv("APP_PROFILE", config.ProfileDev)
+	unsetenv(t, "CONFIG_FILE")
+	t.Setenv("KAFKA_MESSAGE_FORMAT", "avro")
+	t.Setenv("SCHEMA_REGISTRY_URL", "")
+
+	_, err := config.Load()
+	if err == nil || !strings.Contains(err.Error(), "SCHEMA_REGISTRY_URL") {
+		t.Fatalf("expected Avro without a registry to be rejected, got %v", err)
+	}
+
+	t.Setenv("SCHEMA_REGISTRY_URL", "http://schema-registry:8081")
+	if _, err := config.Load(); err != nil {
+		t.Fatalf("Avro with a registry should be valid: %v", err)
+	}
+
+	t.Setenv("KAFKA_MESSAGE_FORMAT", "xml")
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "KAFKA_MESSAGE_FORMAT") {
+		t.Fatalf("expected an unknown format to be rejected, got %v", err)
+	}
+}
+
+func TestConfigDiff(t *testing.T) {
+	var a config.Config
+	b := a
+	b.LogLevel = "warn"
+	b.CacheSize = 10
+	b.HTTPPort = "9000"
+	b.Kafka.Brokers = []string{"b1"}
+
+	reloadable, restart := config.Diff(a, b)
+	if strings.Join(reloadable, ",") != "CACHE_SIZE,LOG_LEVEL" {
+		t.Fatalf("unexpected reloadable %v", reloadable)
+	}
+	if strings.Join(restart, ",") != "KAFKA_BROKERS,HTTP_PORT" {
+		t.Fatalf("unexpected restart %v", restart)
+	}
+}
+
+func TestWriteDocs(t *testing.T) {
+	var b strings.Builder
+	if err := config.WriteDocs(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"`KAFKA_TLS_CA_FILE` | `-kafka-tls-ca-file`", "`CACHE_SIZE`", "`DB_PASSWORD_FILE`", "reloadable"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("docs miss %q", want)
+		}
+	}
+}
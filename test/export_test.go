@@ -0,0 +1,211 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"L0/internal/api"
+	"L0/internal/config"
+	"L0/internal/db"
+	"L0/internal/order"
+	"L0/internal/transfer"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiateExportFormat(t *testing.T) {
+	cases := []struct {
+		accept string
+		want   transfer.Format
+		ok     bool
+	}{
+		{"", transfer.NDJSON, true},
+		{"*/*", transfer.NDJSON, true},
+		{"text/csv", transfer.CSV, true},
+		{"application/json, text/csv;q=0.5", transfer.JSON, true},
+		{"application/json;q=0.2, text/csv;q=0.5", transfer.CSV, true},
+		{"text/html, application/x-ndjson", transfer.NDJSON, true},
+		{"text/*", transfer.CSV, true},
+		{"text/html", "", false},
+		{"text/csv;q=0", "", false},
+	}
+	for _, tc := range cases {
+		got, ok := transfer.Negotiate(tc.accept)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("Negotiate(%q) = %q, %v; want %q, %v", tc.accept, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func exportOrders() []order.Order {
+	first := makeValidOrder("order-1")
+	first.Products = append(first.Products, order.Product{ChrtID: 2, TrackNumber: first.TrackNumber, Name: "second, with comma"})
+	second := makeValidOrder("order-2")
+	second.Products = []order.Product{}
+	return []order.Order{first, second}
+}
+
+func TestExportOrdersNDJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &mockService{orders: exportOrders()}
+	r := authRouter(t, ms, config.AuthConf{APIKeys: "ci:viewer:k1"})
+
+	w := doRequest(r, http.MethodGet, "/orders/export?from=2021-11-01&limit=5", map[string]string{"X-API-Key": "k1"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d: %s", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	if ms.listFilter.Limit != 5 || !ms.listFilter.From.Equal(time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("filter not passed on: %+v", ms.listFilter)
+	}
+	sc := bufio.NewScanner(w.Body)
+	var uids []string
+	for sc.Scan() {
+		var o order.Order
+		if err := json.Unmarshal(sc.Bytes(), &o); err != nil {
+			t.Fatal(err)
+		}
+		uids = append(uids, o.OrderUID)
+		if o.Delivery.Name != order.MaskedValue {
+			t.Fatalf("personal data not masked: %+v", o.Delivery)
+		}
+	}
+	if strings.Join(uids, ",") != "order-1,order-2" {
+		t.Fatalf("unexpected orders %v", uids)
+	}
+}
+
+func TestExportOrdersCSV(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &mockService{orders: exportOrders()}
+	r := api.NewHandler(ms).RegisterOrderRouter()
+
+	w := doRequest(r, http.MethodGet, "/orders/export", map[string]string{"Accept": "text/csv"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d: %s", w.Code, w.Body)
+	}
+	if ms.listFilter.Limit != 0 {
+		t.Fatalf("export should not be limited by default, got %d", ms.listFilter.Limit)
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Header, two items of the first order, one row for the second.
+	if len(rows) != 4 {
+		t.Fatalf("expected 4 rows, got %d: %v", len(rows), rows)
+	}
+	col := map[string]int{}
+	for i, name := range rows[0] {
+		col[name] = i
+	}
+	if rows[1][col["order_uid"]] != "order-1" || rows[2][col["item_name"]] != "second, with comma" {
+		t.Fatalf("unexpected item rows %v", rows[1:3])
+	}
+	if rows[3][col["order_uid"]] != "order-2" || rows[3][col["item_chrt_id"]] != "" || rows[3][col["payment_amount"]] != "1817" {
+		t.Fatalf("unexpected row of order without items %v", rows[3])
+	}
+}
+
+func TestExportOrdersJSONArray(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &mockService{orders: exportOrders()}
+	r := api.NewHandler(ms).RegisterOrderRouter()
+
+	w := doRequest(r, http.MethodGet, "/orders/export?format=json", map[string]string{"Accept": "text/csv"})
+	var got []order.Order
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || len(got) != 2 {
+		t.Fatalf("expected a JSON array of 2 orders, got %s (%v)", w.Body, err)
+	}
+
+	ms.orders = nil
+	w = doRequest(r, http.MethodGet, "/orders/export?format=json", nil)
+	if strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Fatalf("expected an empty array, got %q", w.Body)
+	}
+}
+
+func TestExportOrdersErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &mockService{}
+	r := api.NewHandler(ms).RegisterOrderRouter()
+
+	if w := doRequest(r, http.MethodGet, "/orders/export", map[string]string{"Accept": "text/html"}); w.Code != http.StatusNotAcceptable {
+		t.Fatalf("expected 406 got %d", w.Code)
+	}
+	if w := doRequest(r, http.MethodGet, "/orders/export?format=xml", nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 got %d", w.Code)
+	}
+
+	// Failing before any order is sent gives a plain error response.
+	ms.exportErr = errors.New("connection refused")
+	w := doRequest(r, http.MethodGet, "/orders/export?format=csv", nil)
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "connection refused") {
+		t.Fatalf("expected 500 with the error, got %d: %s", w.Code, w.Body)
+	}
+
+	// Failing later is reported in the trailer.
+	ms.orders = exportOrders()
+	w = doRequest(r, http.MethodGet, "/orders/export", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+	if got := w.Result().Trailer.Get("X-Export-Error"); got != "connection refused" {
+		t.Fatalf("expected the error in the trailer, got %q", got)
+	}
+}
+
+func TestRepositoryStream(t *testing.T) {
+	pool := testPool(t)
+	repo := order.NewOrderRepository(db.NewCluster(pool, time.Second), nil)
+	saved := seedOrders(t, repo, 3, 2)
+	ctx := context.Background()
+
+	var got []order.Order
+	err := repo.Stream(ctx, order.ListFilter{}, func(o order.Order) error {
+		got = append(got, o)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].OrderUID != saved[2].OrderUID || len(got[0].Products) != 2 {
+		t.Fatalf("unexpected stream %+v", got)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = repo.Stream(ctx, order.ListFilter{From: saved[1].DateCreated}, func(o order.Order) error {
+		n++
+		return stop
+	})
+	if !errors.Is(err, stop) || n != 1 {
+		t.Fatalf("expected Stream to stop at the first error, got %v after %d orders", err, n)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	for in, want := range map[string]time.Time{
+		"":                          {},
+		"2025-01-02":                time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC),
+		"2025-01-02T03:04:05Z":      time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		"2025-01-02T03:04:05+03:00": time.Date(2025, 1, 2, 0, 4, 5, 0, time.UTC),
+	} {
+		got, err := transfer.ParseTime(in)
+		if err != nil || !got.Equal(want) {
+			t.Fatalf("ParseTime(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := transfer.ParseTime("02.01.2025"); err == nil {
+		t.Fatal("expected an unknown layout to fail")
+	}
+}
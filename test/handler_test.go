@@ -6,8 +6,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"L0/internal/api"
+	"L0/internal/audit"
 	"L0/internal/order"
 
 	"github.com/gin-gonic/gin"
@@ -67,6 +69,31 @@ func TestGetOrdersWithLimit(t *testing.T) {
 	}
 }
 
+func TestGetOrdersDateRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &mockService{}
+	r := api.NewHandler(ms).RegisterOrderRouter()
+
+	w := doRequest(r, http.MethodGet, "/orders/?limit=5&from=2025-01-01&to=2025-02-01T00:00:00Z", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d: %s", w.Code, w.Body)
+	}
+	want := order.ListFilter{
+		From:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:    time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+		Limit: 5,
+	}
+	if !ms.listFilter.From.Equal(want.From) || !ms.listFilter.To.Equal(want.To) || ms.listFilter.Limit != want.Limit {
+		t.Fatalf("unexpected filter %+v", ms.listFilter)
+	}
+
+	for _, q := range []string{"from=yesterday", "to=2025-13-01", "from=2025-02-01&to=2025-01-01"} {
+		if w := doRequest(r, http.MethodGet, "/orders/?"+q, nil); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400 got %d", q, w.Code)
+		}
+	}
+}
+
 func TestCreateOrder(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	ord := order.Order{OrderUID: "order-new"}
@@ -82,3 +109,77 @@ func TestCreateOrder(t *testing.T) {
 		t.Fatalf("expected 201 got %d", w.Code)
 	}
 }
+
+func TestDeleteOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &mockService{}
+	h := api.NewHandler(ms)
+	r := h.RegisterOrderRouter()
+
+	req := httptest.NewRequest(http.MethodDelete, "/orders/order-del", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 got %d", w.Code)
+	}
+	if len(ms.deleted) != 1 || ms.deleted[0] != "order-del" {
+		t.Fatalf("unexpected deleted ids: %v", ms.deleted)
+	}
+}
+
+func TestEraseOrderNotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &mockService{deleteErr: order.ErrOrderNotFound}
+	h := api.NewHandler(ms)
+	r := h.RegisterOrderRouter()
+
+	req := httptest.NewRequest(http.MethodPost, "/orders/missing/erase", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 got %d", w.Code)
+	}
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &mockService{}
+	h := api.NewHandler(ms)
+	r := h.RegisterOrderRouter()
+
+	req := httptest.NewRequest(http.MethodPatch, "/orders/order-st/status", bytes.NewBufferString(`{"status":0}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 got %d", w.Code)
+	}
+	if st, ok := ms.statuses["order-st"]; !ok || st != 0 {
+		t.Fatalf("unexpected statuses: %v", ms.statuses)
+	}
+}
+
+func TestGetOrderAudit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &mockService{audit: []audit.Entry{{OrderUID: "order-a", Action: audit.ActionCreate}}}
+	h := api.NewHandler(ms)
+	r := h.RegisterOrderRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/order-a/audit", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+	var got []audit.Entry
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode err: %v", err)
+	}
+	if len(got) != 1 || got[0].Action != audit.ActionCreate {
+		t.Fatalf("unexpected entries: %+v", got)
+	}
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"L0/internal/api"
+	"L0/internal/cache"
+	"L0/internal/health"
+	"L0/internal/order"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckerReportsComponents(t *testing.T) {
+	c := health.NewChecker(50 * time.Millisecond)
+	c.Add("db", func(ctx context.Context) error { return nil })
+	c.Add("broker", func(ctx context.Context) error { return errors.New("connection refused") })
+	c.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	r := c.Run(context.Background())
+	if r.Status != health.StatusDown {
+		t.Fatalf("expected down, got %s", r.Status)
+	}
+	if r.Components["db"].Status != health.StatusUp {
+		t.Fatalf("db should be up: %+v", r.Components["db"])
+	}
+	if got := r.Components["broker"]; got.Status != health.StatusDown || got.Error != "connection refused" {
+		t.Fatalf("unexpected broker component %+v", got)
+	}
+	if got := r.Components["slow"]; got.Status != health.StatusDown || got.LatencyMs < 50 {
+		t.Fatalf("slow check should time out: %+v", got)
+	}
+}
+
+func TestHeartbeatCheck(t *testing.T) {
+	var h health.Heartbeat
+	check := h.Check(time.Minute)
+	if err := check(context.Background()); err == nil {
+		t.Fatalf("expected error before first beat")
+	}
+	h.Beat()
+	if err := check(context.Background()); err != nil {
+		t.Fatalf("unexpected error after beat: %v", err)
+	}
+	if err := h.Check(0)(context.Background()); err == nil {
+		t.Fatalf("expected stale heartbeat")
+	}
+}
+
+func TestCacheWarmCheck(t *testing.T) {
+	c := cache.NewCache(10)
+	if err := c.CheckWarm(context.Background()); err == nil {
+		t.Fatalf("expected cold cache")
+	}
+	c.Load(nil)
+	if err := c.CheckWarm(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestProbeEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	live := health.NewChecker(time.Second)
+	live.Add("consumer", func(ctx context.Context) error { return nil })
+	ready := health.NewChecker(time.Second)
+	ready.Add("postgres", func(ctx context.Context) error { return errors.New("no route to host") })
+	r := api.NewHandler(&mockService{order: order.Order{}}, api.WithHealth(live, ready)).RegisterOrderRouter()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("livez: expected 200, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz: expected 503, got %d", rec.Code)
+	}
+	var report health.Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if report.Components["postgres"].Error != "no route to host" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestProbeRouterServesOnlyProbes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	live := health.NewChecker(time.Second)
+	live.Add("consumer", func(ctx context.Context) error { return errors.New("stalled") })
+	r := api.NewHandler(&mockService{}, api.WithHealth(live, health.NewChecker(time.Second))).RegisterProbeRouter()
+
+	for path, want := range map[string]int{
+		"/livez":   http.StatusServiceUnavailable,
+		"/readyz":  http.StatusOK,
+		"/metrics": http.StatusOK,
+		"/orders/": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != want {
+			t.Fatalf("%s: expected %d, got %d", path, want, rec.Code)
+		}
+	}
+}
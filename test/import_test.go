@@ -0,0 +1,368 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"L0/internal/api"
+	"L0/internal/db"
+	"L0/internal/order"
+	"L0/internal/transfer"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ndjsonLines(t *testing.T, orders ...order.Order) []string {
+	t.Helper()
+	lines := make([]string, len(orders))
+	for i, o := range orders {
+		b, err := json.Marshal(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines[i] = string(b)
+	}
+	return lines
+}
+
+func readAll(t *testing.T, dec transfer.Decoder) []transfer.Record {
+	t.Helper()
+	var recs []transfer.Record
+	for {
+		rec, err := dec.Next()
+		if errors.Is(err, io.EOF) {
+			return recs
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+}
+
+func TestDecodeNDJSON(t *testing.T) {
+	lines := ndjsonLines(t, makeValidOrder("order-1"), makeValidOrder("order-2"))
+	file := lines[0] + "\n\n{broken\n" + lines[1] + "\n"
+	dec, err := transfer.NewDecoder(strings.NewReader(file), transfer.NDJSON, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs := readAll(t, dec)
+	if len(recs) != 3 {
+		t.Fatalf("expected 3 records, got %+v", recs)
+	}
+	// Exported lines carry no version, so they are read as version 1.
+	want := makeValidOrder("order-1")
+	want.PayloadVersion = 1
+	if recs[0].Line != 1 || recs[0].Err != nil || !reflect.DeepEqual(recs[0].Order, want) {
+		t.Fatalf("unexpected first record %+v", recs[0])
+	}
+	if recs[1].Line != 3 || recs[1].Err == nil {
+		t.Fatalf("expected a decode error on line 3, got %+v", recs[1])
+	}
+	if recs[2].Line != 4 || recs[2].Order.OrderUID != "order-2" {
+		t.Fatalf("unexpected last record %+v", recs[2])
+	}
+
+	if _, err := transfer.NewDecoder(strings.NewReader("[]"), transfer.JSON, false); err == nil {
+		t.Fatal("expected JSON arrays to be rejected")
+	}
+}
+
+func TestDecodeCSVReadsExport(t *testing.T) {
+	orders := exportOrders()
+	var buf bytes.Buffer
+	enc := transfer.NewEncoder(&buf, transfer.CSV)
+	for _, o := range orders {
+		if err := enc.Encode(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := transfer.NewDecoder(&buf, transfer.CSV, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs := readAll(t, dec)
+	if len(recs) != 2 || recs[0].Line != 2 || recs[1].Line != 4 {
+		t.Fatalf("unexpected records %+v", recs)
+	}
+	for i, rec := range recs {
+		if rec.Err != nil {
+			t.Fatal(rec.Err)
+		}
+		if !reflect.DeepEqual(rec.Order, orders[i]) {
+			t.Fatalf("round trip mismatch:\ngot  %+v\nwant %+v", rec.Order, orders[i])
+		}
+	}
+}
+
+func TestDecodeCSVColumns(t *testing.T) {
+	file := "item_chrt_id,order_uid,payment_amount\n" +
+		"1,order-1,10\n" +
+		"2,order-1,10\n" +
+		"x,order-2,10\n" +
+		"3,order-3\n" +
+		",order-4,20\n"
+	dec, err := transfer.NewDecoder(strings.NewReader(file), transfer.CSV, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs := readAll(t, dec)
+	if len(recs) != 4 {
+		t.Fatalf("expected 4 records, got %+v", recs)
+	}
+	if len(recs[0].Order.Products) != 2 || recs[0].Order.Payment.Amount != 10 {
+		t.Fatalf("rows of one order not merged: %+v", recs[0].Order)
+	}
+	if recs[1].Line != 4 || recs[1].Err == nil || !strings.Contains(recs[1].Err.Error(), "item_chrt_id") {
+		t.Fatalf("expected a column error on line 4, got %+v", recs[1])
+	}
+	if recs[2].Line != 5 || recs[2].Err == nil {
+		t.Fatalf("expected a short row error on line 5, got %+v", recs[2])
+	}
+	if recs[3].Order.OrderUID != "order-4" || len(recs[3].Order.Products) != 0 {
+		t.Fatalf("unexpected order without items %+v", recs[3].Order)
+	}
+
+	for _, header := range []string{"order_uid,colour\n", "track_number\n", ""} {
+		if _, err := transfer.NewDecoder(strings.NewReader(header), transfer.CSV, false); err == nil {
+			t.Fatalf("expected header %q to be rejected", header)
+		}
+	}
+}
+
+// importFile has valid orders on lines 1, 2, 5 and 6, an invalid order on
+// line 3 and a broken line 4.
+func importFile(t *testing.T) string {
+	invalid := makeValidOrder("order-invalid")
+	invalid.Payment.Amount = -1
+	lines := ndjsonLines(t, makeValidOrder("order-1"), makeValidOrder("order-2"), invalid)
+	lines = append(lines, "{broken")
+	lines = append(lines, ndjsonLines(t, makeValidOrder("order-3"), makeValidOrder("order-4"))...)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func TestImportReportsLineErrors(t *testing.T) {
+	ms := &mockService{saveRes: order.SaveInserted, orderErrs: map[string]error{"order-3": errors.New("conflict")}}
+	dec, _ := transfer.NewDecoder(strings.NewReader(importFile(t)), transfer.NDJSON, false)
+	var logged []int
+	report, err := transfer.Import(context.Background(), dec, ms, transfer.ImportOptions{
+		BatchSize: 2,
+		Policy:    order.ConflictOverwrite,
+		OnError:   func(le transfer.LineError) { logged = append(logged, le.Line) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Orders != 6 || report.Inserted != 3 || report.Failed != 3 || report.NextLine != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if ms.batches != 2 || ms.saveOpts[0].Policy != order.ConflictOverwrite {
+		t.Fatalf("expected 2 batches with the policy, got %d: %+v", ms.batches, ms.saveOpts)
+	}
+	if !reflect.DeepEqual(logged, []int{3, 4, 5}) {
+		t.Fatalf("unexpected failed lines %v", logged)
+	}
+	if report.Errors[0].OrderUID != "order-invalid" || !strings.Contains(report.Errors[0].Error, "payment.amount") {
+		t.Fatalf("unexpected validation error %+v", report.Errors[0])
+	}
+	if report.Errors[2].OrderUID != "order-3" || report.Errors[2].Error != "conflict" {
+		t.Fatalf("unexpected save error %+v", report.Errors[2])
+	}
+}
+
+func TestImportResumes(t *testing.T) {
+	ms := &mockService{saveErr: errors.New("connection refused")}
+	dec, _ := transfer.NewDecoder(strings.NewReader(importFile(t)), transfer.NDJSON, false)
+	report, err := transfer.Import(context.Background(), dec, ms, transfer.ImportOptions{BatchSize: 2})
+	if err == nil || report.NextLine != 1 {
+		t.Fatalf("expected the import to stop at line 1, got %+v, %v", report, err)
+	}
+
+	ms = &mockService{saveRes: order.SaveInserted}
+	dec, _ = transfer.NewDecoder(strings.NewReader(importFile(t)), transfer.NDJSON, false)
+	report, err = transfer.Import(context.Background(), dec, ms, transfer.ImportOptions{FromLine: 5, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Orders != 2 || len(ms.saved) != 2 || ms.saved[0].OrderUID != "order-3" {
+		t.Fatalf("expected lines 5 and 6 only, got %+v, saved %d", report, len(ms.saved))
+	}
+	if !report.DryRun || !ms.saveOpts[0].DryRun {
+		t.Fatalf("dry run not passed on: %+v", ms.saveOpts)
+	}
+}
+
+func TestImportResumesAtUnreadableLine(t *testing.T) {
+	ms := &mockService{saveRes: order.SaveInserted}
+	lines := ndjsonLines(t, makeValidOrder("order-1"), makeValidOrder("order-2"))
+	// Longer than the longest line the decoder reads.
+	lines = append(lines, `{"order_uid": "`+strings.Repeat("x", 17*1024*1024)+`"}`)
+	dec, _ := transfer.NewDecoder(strings.NewReader(strings.Join(lines, "\n")+"\n"), transfer.NDJSON, false)
+
+	report, err := transfer.Import(context.Background(), dec, ms, transfer.ImportOptions{BatchSize: 2})
+	var rerr *transfer.ReadError
+	if !errors.As(err, &rerr) || rerr.Line != 3 {
+		t.Fatalf("expected a read error at line 3, got %v", err)
+	}
+	if report.Inserted != 2 || report.NextLine != 3 {
+		t.Fatalf("expected to resume at line 3 after the saved batch, got %+v", report)
+	}
+}
+
+func postImport(r http.Handler, path, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestImportOrdersHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &mockService{saveRes: order.SaveInserted}
+	r := api.NewHandler(ms).RegisterOrderRouter()
+
+	w := postImport(r, "/orders/import?dry_run=true&policy=overwrite", "application/x-ndjson", importFile(t))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d: %s", w.Code, w.Body)
+	}
+	var report transfer.ImportReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Inserted != 4 || report.Failed != 2 || !report.DryRun || len(report.Errors) != 2 {
+		t.Fatalf("unexpected report %s", w.Body)
+	}
+	if opts := ms.saveOpts[0]; !opts.DryRun || opts.Policy != order.ConflictOverwrite {
+		t.Fatalf("options not passed on: %+v", opts)
+	}
+
+	var csvBody bytes.Buffer
+	enc := transfer.NewEncoder(&csvBody, transfer.CSV)
+	for _, o := range exportOrders() {
+		_ = enc.Encode(o)
+	}
+	_ = enc.Close()
+	ms.saved = nil
+	w = postImport(r, "/orders/import", "text/csv; charset=utf-8", csvBody.String())
+	if w.Code != http.StatusOK || len(ms.saved) != 2 || len(ms.saved[0].Products) != 2 {
+		t.Fatalf("CSV import failed with %d: %s", w.Code, w.Body)
+	}
+
+	for _, tc := range []struct {
+		path, contentType, body string
+		code                    int
+	}{
+		{"/orders/import", "application/xml", "", http.StatusUnsupportedMediaType},
+		{"/orders/import?format=json", "", "[]", http.StatusBadRequest},
+		{"/orders/import?from_line=x", "", "", http.StatusBadRequest},
+		{"/orders/import?policy=merge", "", "", http.StatusBadRequest},
+		{"/orders/import?format=csv", "", "order_uid,colour\n", http.StatusBadRequest},
+	} {
+		if w := postImport(r, tc.path, tc.contentType, tc.body); w.Code != tc.code {
+			t.Errorf("%s (%s): expected %d got %d: %s", tc.path, tc.contentType, tc.code, w.Code, w.Body)
+		}
+	}
+
+	ms.saveErr = errors.New("connection refused")
+	w = postImport(r, "/orders/import", "", importFile(t))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), `"next_line":1`) {
+		t.Fatalf("expected 500 with the resume line, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestRepositorySaveBatch(t *testing.T) {
+	pool := testPool(t)
+	repo := order.NewOrderRepository(db.NewCluster(pool, time.Second), nil)
+	saved := seedOrders(t, repo, 1, 1)
+	ctx := context.Background()
+
+	fresh := makeValidOrder("order-fresh")
+	fresh.Products = append(fresh.Products, order.Product{ChrtID: 2, TrackNumber: fresh.TrackNumber})
+	broken := makeValidOrder("order-broken")
+	broken.Products[0].Name = string([]byte{0xff}) // not valid UTF-8
+	batch := []order.Order{saved[0], fresh, broken}
+
+	results, errs, err := repo.SaveBatch(ctx, batch, order.SaveOptions{DryRun: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[1] != order.SaveInserted {
+		t.Fatalf("unexpected dry run results %v", results)
+	}
+	if _, err := repo.GetById(ctx, fresh.OrderUID); !errors.Is(err, order.ErrOrderNotFound) {
+		t.Fatalf("dry run saved the order: %v", err)
+	}
+
+	results, errs, err = repo.SaveBatch(ctx, batch, order.SaveOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []order.SaveResult{order.SaveSkipped, order.SaveInserted, order.SaveSkipped}
+	if !reflect.DeepEqual(results, want) || errs[0] != nil || errs[1] != nil || errs[2] == nil {
+		t.Fatalf("unexpected results %v, errors %v", results, errs)
+	}
+	got, err := repo.GetById(ctx, fresh.OrderUID)
+	if err != nil || len(got.Products) != 2 {
+		t.Fatalf("GetById = %+v, %v", got, err)
+	}
+	if _, err := repo.GetById(ctx, broken.OrderUID); !errors.Is(err, order.ErrOrderNotFound) {
+		t.Fatalf("failed order was saved: %v", err)
+	}
+
+	// Overwrites are audited with the order they replaced, including an
+	// earlier copy of the order in the same batch.
+	first, second := saved[0], saved[0]
+	first.Entry, second.Entry = "FIRST", "SECOND"
+	other := makeValidOrder("order-other")
+	other.TrackNumber = "TRACKOTHER"
+	other.Products[0].TrackNumber = other.TrackNumber
+	var befores []*order.Order
+	audit := func(ctx context.Context, tx db.Client, before, after *order.Order) error {
+		befores = append(befores, before)
+		return nil
+	}
+	results, errs, err = repo.SaveBatch(ctx, []order.Order{first, second, other}, order.SaveOptions{Policy: order.ConflictOverwrite}, audit)
+	if err != nil || errs[0] != nil || errs[1] != nil || errs[2] != nil {
+		t.Fatalf("overwrite batch = %v, %v", errs, err)
+	}
+	if len(befores) != 3 || befores[0] == nil || befores[0].Entry != saved[0].Entry ||
+		befores[1] == nil || befores[1].Entry != "FIRST" || befores[2] != nil {
+		t.Fatalf("unexpected before-images %+v", befores)
+	}
+}
+
+func TestSaveOrdersLeavesCacheAlone(t *testing.T) {
+	repo := &mockRepo{orders: []order.Order{{OrderUID: "order-cached", Entry: "OLD"}}}
+	cache := &mockCache{}
+	cache.Set(repo.orders[0])
+	svc := order.NewOrderService(repo, cache, &writerRec{}, nil, nil)
+
+	batch := []order.Order{{OrderUID: "order-cached", Entry: "NEW"}, {OrderUID: "order-imported"}}
+	results, _, err := svc.SaveOrders(context.Background(), batch, order.SaveOptions{Policy: order.ConflictOverwrite})
+	if err != nil || results[0] != order.SaveUpdated || results[1] != order.SaveInserted {
+		t.Fatalf("SaveOrders = %v, %v", results, err)
+	}
+	if _, ok := cache.Get("order-cached"); ok {
+		t.Fatal("overwritten order should be evicted")
+	}
+	if _, ok := cache.Get("order-imported"); ok {
+		t.Fatal("imported order should not be cached")
+	}
+}
@@ -0,0 +1,203 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"L0/internal/cache"
+	"L0/internal/db"
+	"L0/internal/kafka"
+	"L0/internal/lifecycle"
+	"L0/internal/logger"
+	"L0/internal/order"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func TestShutdownRunsPhasesInOrder(t *testing.T) {
+	m := lifecycle.NewManager(logger.Discard())
+	var steps []string
+	step := func(name string, err error) func(context.Context) error {
+		return func(context.Context) error {
+			steps = append(steps, name)
+			return err
+		}
+	}
+	m.Add(lifecycle.PhaseClose, "postgres", step("postgres", nil))
+	m.Add(lifecycle.PhaseFlush, "writer", step("writer", errors.New("broker down")))
+	m.Add(lifecycle.PhaseIntake, "http", step("http", nil))
+	m.Add(lifecycle.PhaseDrain, "consumer", step("consumer", nil))
+	m.Add(lifecycle.PhaseIntake, "consumer intake", step("consumer intake", nil))
+
+	err := m.Shutdown(context.Background())
+	if err == nil || err.Error() != "writer: broker down" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := []string{"http", "consumer intake", "consumer", "writer", "postgres"}
+	if !reflect.DeepEqual(steps, want) {
+		t.Fatalf("steps %v, want %v", steps, want)
+	}
+	_ = m.Shutdown(context.Background())
+	if len(steps) != len(want) {
+		t.Fatalf("second shutdown must not rerun steps")
+	}
+}
+
+func TestCacheSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	c := cache.NewCache(10)
+	c.Set(order.Order{OrderUID: "old"})
+	c.Set(order.Order{OrderUID: "new"})
+	if n, err := c.SaveSnapshot(path); err != nil || n != 2 {
+		t.Fatalf("save: n=%d err=%v", n, err)
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("snapshot holds personal data and must be private: %v, %v", info.Mode(), err)
+	}
+
+	restored := cache.NewCache(10)
+	if _, err := restored.LoadSnapshot(context.Background(), path, time.Minute, allLive); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	recent := restored.GetRecent(10)
+	if len(recent) != 2 || recent[0].OrderUID != "new" || recent[1].OrderUID != "old" {
+		t.Fatalf("unexpected restored order %v", recent)
+	}
+	if !restored.Warmed() {
+		t.Fatalf("restored cache must be warmed")
+	}
+
+	if _, err := cache.NewCache(10).LoadSnapshot(context.Background(), path, 0, allLive); !errors.Is(err, cache.ErrSnapshotStale) {
+		t.Fatalf("expected stale snapshot, got %v", err)
+	}
+}
+
+// allLive reports every order live.
+func allLive(ctx context.Context, ids []string) ([]string, error) { return ids, nil }
+
+func TestCacheSnapshotDropsOrdersNoLongerLive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	c := cache.NewCache(10)
+	c.Set(order.Order{OrderUID: "kept"})
+	c.Set(order.Order{OrderUID: "erased"})
+	if _, err := c.SaveSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	var asked []string
+	live := func(ctx context.Context, ids []string) ([]string, error) {
+		asked = ids
+		return []string{"kept"}, nil
+	}
+	restored := cache.NewCache(10)
+	if n, err := restored.LoadSnapshot(context.Background(), path, time.Minute, live); err != nil || n != 1 {
+		t.Fatalf("LoadSnapshot = %d, %v", n, err)
+	}
+	if _, ok := restored.Get("erased"); ok || len(asked) != 2 {
+		t.Fatalf("erased order restored, checked %v", asked)
+	}
+
+	failing := func(ctx context.Context, ids []string) ([]string, error) {
+		return nil, errors.New("connection refused")
+	}
+	if _, err := cache.NewCache(10).LoadSnapshot(context.Background(), path, time.Minute, failing); err == nil {
+		t.Fatal("a snapshot that cannot be checked must not be used")
+	}
+}
+
+func TestCacheSnapshotSkipsErasedOrders(t *testing.T) {
+	pool := testPool(t)
+	repo := order.NewOrderRepository(db.NewCluster(pool, time.Second), nil)
+	saved := seedOrders(t, repo, 3, 1)
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "cache.json")
+	c := cache.NewCache(10)
+	c.Load(saved)
+	if _, err := c.SaveSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Erase(ctx, saved[0].OrderUID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(ctx, saved[1].OrderUID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := cache.NewCache(10)
+	n, err := restored.LoadSnapshot(ctx, path, time.Minute, repo.LiveIDs)
+	if err != nil || n != 1 {
+		t.Fatalf("LoadSnapshot = %d, %v", n, err)
+	}
+	if _, ok := restored.Get(saved[0].OrderUID); ok {
+		t.Fatal("erased order restored from the snapshot")
+	}
+	if _, ok := restored.Get(saved[1].OrderUID); ok {
+		t.Fatal("deleted order restored from the snapshot")
+	}
+	if _, ok := restored.Get(saved[2].OrderUID); !ok {
+		t.Fatal("live order not restored")
+	}
+}
+
+// blockingService holds SaveOrder until release is closed or ctx is done.
+type blockingService struct {
+	mockService
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingService) SaveOrder(ctx context.Context, o order.Order, opts order.SaveOptions) (order.SaveResult, error) {
+	close(b.started)
+	select {
+	case <-b.release:
+		return b.mockService.SaveOrder(ctx, o, opts)
+	case <-ctx.Done():
+		return order.SaveSkipped, ctx.Err()
+	}
+}
+
+func startBlockedSupervisor(t *testing.T) (*kafka.Supervisor, *fakeReader, *blockingService, context.CancelFunc) {
+	t.Helper()
+	svc := &blockingService{started: make(chan struct{}), release: make(chan struct{})}
+	r := &fakeReader{msgs: []kafkago.Message{orderMessage(t, makeValidOrder("order1"), 1, time.Now())}}
+	s := kafka.NewSupervisor(func() (kafka.MessageReader, error) { return r, nil }, svc, nil, logger.Discard(), time.Millisecond, time.Millisecond)
+	ctx, stop := context.WithCancel(context.Background())
+	go s.Run(ctx)
+	<-svc.started
+	return s, r, svc, stop
+}
+
+func TestSupervisorDrainsInFlightMessage(t *testing.T) {
+	s, r, svc, stop := startBlockedSupervisor(t)
+	stop()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(svc.release)
+	}()
+	if err := s.Wait(context.Background()); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if len(svc.saved) != 1 || len(r.committed) != 1 || !r.closed {
+		t.Fatalf("in-flight message must be saved, committed and the reader closed: saved=%d committed=%d closed=%v",
+			len(svc.saved), len(r.committed), r.closed)
+	}
+}
+
+func TestSupervisorAbortsDrainOnDeadline(t *testing.T) {
+	s, r, svc, stop := startBlockedSupervisor(t)
+	stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	if len(svc.saved) != 0 || len(r.committed) != 0 || !r.closed {
+		t.Fatalf("aborted message must not be committed and the reader must be closed")
+	}
+}
@@ -0,0 +1,159 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"L0/internal/api"
+	"L0/internal/cache"
+	"L0/internal/kafka"
+	"L0/internal/logger"
+	"L0/internal/order"
+
+	"github.com/gin-gonic/gin"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func decodeLogLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("bad log line %q: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestLoggerLevelAndContextAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := logger.New(&buf, "warn", "json")
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	ctx := logger.With(context.Background(), "request_id", "req-1")
+	ctx = logger.With(ctx, "order_uid", "order-1")
+	l.InfoContext(ctx, "dropped")
+	l.WarnContext(ctx, "kept", "attempt", 2)
+
+	records := decodeLogLines(t, &buf)
+	if len(records) != 1 {
+		t.Fatalf("expected only the warn record, got %v", records)
+	}
+	rec := records[0]
+	if rec["msg"] != "kept" || rec["request_id"] != "req-1" || rec["order_uid"] != "order-1" || rec["attempt"] != float64(2) {
+		t.Fatalf("unexpected record %v", rec)
+	}
+}
+
+func TestLoggerRejectsUnknownSettings(t *testing.T) {
+	if _, err := logger.New(&bytes.Buffer{}, "verbose", "text"); err == nil {
+		t.Fatalf("expected error for unknown level")
+	}
+	if _, err := logger.New(&bytes.Buffer{}, "info", "xml"); err == nil {
+		t.Fatalf("expected error for unknown format")
+	}
+}
+
+func TestSaveOrderLogsFailureWithOrderUID(t *testing.T) {
+	var buf bytes.Buffer
+	l, _ := logger.New(&buf, "debug", "json")
+	repo := &mockRepo{saveErr: errors.New("db down")}
+	svc := order.NewOrderService(repo, cache.NewCache(10), &writerRec{}, nil, l)
+
+	if _, err := svc.SaveOrder(context.Background(), order.Order{OrderUID: "order-x"}, order.SaveOptions{}); err == nil {
+		t.Fatalf("expected save error")
+	}
+	records := decodeLogLines(t, &buf)
+	if len(records) != 1 || records[0]["level"] != "ERROR" || records[0]["order_uid"] != "order-x" {
+		t.Fatalf("unexpected records %v", records)
+	}
+}
+
+func TestRequestIDIsEchoedAndLogged(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	l, _ := logger.New(&buf, "info", "json")
+	ms := &mockService{order: order.Order{OrderUID: "order-l"}}
+	r := api.NewHandler(ms, api.WithLogger(l)).RegisterOrderRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/order-l", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("X-Request-ID"); got != "req-42" {
+		t.Fatalf("expected request id echoed, got %q", got)
+	}
+	records := decodeLogLines(t, &buf)
+	if len(records) != 1 || records[0]["request_id"] != "req-42" || records[0]["status"] != float64(200) {
+		t.Fatalf("unexpected records %v", records)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders/order-l", nil))
+	if rec.Header().Get("X-Request-ID") == "" {
+		t.Fatalf("expected generated request id")
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe to write from a consumer goroutine.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestConsumerDoesNotLogPayloads(t *testing.T) {
+	var buf lockedBuffer
+	l, _ := logger.New(&buf, "debug", "json")
+	payload := `{"order_uid": "order-pii", "delivery": {"phone": "+79990000000"}, "sm_id": "x"}`
+	r := &fakeReader{msgs: []kafkago.Message{{Topic: "orders", Value: []byte(payload)}}}
+	c := kafka.NewConsumer(r, &mockService{}, nil, l)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+	waitFor(t, func() bool { return strings.Contains(buf.String(), "decode order failed") })
+	cancel()
+	<-done
+
+	out := buf.String()
+	if strings.Contains(out, "+79990000000") {
+		t.Fatalf("payload leaked into the log: %s", out)
+	}
+	var rec map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if strings.Contains(line, "decode order failed") {
+			if err := json.Unmarshal([]byte(line), &rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if rec["order_uid"] != "order-pii" || rec["size"] != float64(len(payload)) || rec["content_type"] != "application/json" {
+		t.Fatalf("unexpected record %v", rec)
+	}
+}
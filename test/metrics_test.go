@@ -0,0 +1,45 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"L0/internal/api"
+	"L0/internal/cache"
+	"L0/internal/order"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &mockService{order: order.Order{OrderUID: "order-m"}}
+	r := api.NewHandler(ms).RegisterOrderRouter()
+
+	c := cache.NewCache(1)
+	c.Set(makeSampleOrder("order-m"))
+	c.Get("order-m")
+	c.Get("missing")
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders/order-m", nil))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`orders_http_requests_total{method="GET",route="/orders/:id",status="200"}`,
+		`orders_cache_requests_total{result="hit"}`,
+		`orders_cache_requests_total{result="miss"}`,
+		`orders_cache_hit_ratio`,
+		`orders_cache_size`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %s in metrics output", want)
+		}
+	}
+}
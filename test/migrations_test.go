@@ -0,0 +1,46 @@
+package test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"L0/internal/migrations"
+)
+
+func TestEmbeddedMigrationsOrdered(t *testing.T) {
+	migs, err := migrations.Load()
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if len(migs) == 0 {
+		t.Fatalf("expected embedded migrations")
+	}
+	for i, m := range migs {
+		if m.Version != uint(i+1) {
+			t.Fatalf("expected contiguous versions, got %d at position %d", m.Version, i)
+		}
+		if m.Up == "" || m.Down == "" {
+			t.Fatalf("migration %d has empty script", m.Version)
+		}
+	}
+}
+
+func TestParseMigrationsRequiresPairs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000001_init.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"000001_init.down.sql": {Data: []byte("DROP TABLE a;")},
+		"000002_more.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+	}
+	if _, err := migrations.Parse(fsys); err == nil {
+		t.Fatalf("expected error for missing down migration")
+	}
+
+	fsys["000002_more.down.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE b;")}
+	migs, err := migrations.Parse(fsys)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(migs) != 2 || migs[1].Name != "more" {
+		t.Fatalf("unexpected migrations: %+v", migs)
+	}
+}
@@ -1,20 +1,66 @@
 package test
 
 import (
+	"L0/internal/audit"
+	"L0/internal/db"
 	"L0/internal/order"
 	"context"
 	"errors"
+	"sync"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	kafkago "github.com/segmentio/kafka-go"
 )
 
 type mockService struct {
-	getErr error
-	order  order.Order
-	orders []order.Order
+	getErr     error
+	saveErr    error
+	saveRes    order.SaveResult
+	saved      []order.Order
+	saveOpts   []order.SaveOptions
+	deleteErr  error
+	order      order.Order
+	orders     []order.Order
+	deleted    []string
+	erased     []string
+	statuses   map[string]int
+	audit      []audit.Entry
+	sources    []audit.Source
+	listFilter order.ListFilter
+	// exportErr is returned by ExportOrders after it has passed on orders.
+	exportErr error
+	// orderErrs fails single orders of SaveOrders by order_uid.
+	orderErrs map[string]error
+	batches   int
 }
 
-func (m *mockService) SaveOrder(ctx context.Context, o order.Order) error { return nil }
+func (m *mockService) SaveOrder(ctx context.Context, o order.Order, opts order.SaveOptions) (order.SaveResult, error) {
+	if m.saveErr != nil {
+		return order.SaveSkipped, m.saveErr
+	}
+	m.saved = append(m.saved, o)
+	m.saveOpts = append(m.saveOpts, opts)
+	return m.saveRes, nil
+}
+func (m *mockService) SaveOrders(ctx context.Context, orders []order.Order, opts order.SaveOptions) ([]order.SaveResult, []error, error) {
+	if m.saveErr != nil {
+		return nil, nil, m.saveErr
+	}
+	results := make([]order.SaveResult, len(orders))
+	errs := make([]error, len(orders))
+	for i, o := range orders {
+		if err, ok := m.orderErrs[o.OrderUID]; ok {
+			errs[i] = err
+			continue
+		}
+		m.saved = append(m.saved, o)
+		results[i] = m.saveRes
+	}
+	m.saveOpts = append(m.saveOpts, opts)
+	m.batches++
+	return results, errs, nil
+}
 func (m *mockService) GetOrderById(ctx context.Context, id string) (order.Order, error) {
 	if m.getErr != nil {
 		return order.Order{}, m.getErr
@@ -24,15 +70,98 @@ func (m *mockService) GetOrderById(ctx context.Context, id string) (order.Order,
 func (m *mockService) GetOrdersLimit(ctx context.Context, limit int) ([]order.Order, error) {
 	return m.orders, nil
 }
+func (m *mockService) ListOrders(ctx context.Context, filter order.ListFilter) ([]order.Order, error) {
+	m.listFilter = filter
+	return m.orders, nil
+}
+func (m *mockService) ExportOrders(ctx context.Context, filter order.ListFilter, fn func(order.Order) error) error {
+	m.listFilter = filter
+	for _, o := range m.orders {
+		if err := fn(o); err != nil {
+			return err
+		}
+	}
+	return m.exportErr
+}
 func (m *mockService) CreateOrder(ctx context.Context) (order.Order, error) { return m.order, nil }
+func (m *mockService) DeleteOrder(ctx context.Context, id string) error {
+	if m.deleteErr != nil {
+		return m.deleteErr
+	}
+	m.deleted = append(m.deleted, id)
+	m.sources = append(m.sources, audit.SourceFrom(ctx))
+	return nil
+}
+func (m *mockService) EraseOrder(ctx context.Context, id string) error {
+	if m.deleteErr != nil {
+		return m.deleteErr
+	}
+	m.erased = append(m.erased, id)
+	return nil
+}
+func (m *mockService) UpdateOrderStatus(ctx context.Context, id string, status int) error {
+	if m.statuses == nil {
+		m.statuses = map[string]int{}
+	}
+	m.statuses[id] = status
+	return nil
+}
+func (m *mockService) GetOrderAudit(ctx context.Context, id string) ([]audit.Entry, error) {
+	return m.audit, nil
+}
 
 type mockRepo struct {
 	saveErr error
 	getErr  error
 	orders  []order.Order
+	deleted []string
+	erased  []string
 }
 
-func (m *mockRepo) Save(ctx context.Context, o order.Order) error { return m.saveErr }
+// Writes of mockRepo call their order.AuditFunc without a transaction and
+// are dropped when it fails, as if rolled back.
+func (m *mockRepo) Save(ctx context.Context, o order.Order, opts order.SaveOptions, fn order.AuditFunc) (order.SaveResult, error) {
+	if m.saveErr != nil {
+		return order.SaveSkipped, m.saveErr
+	}
+	for i, existing := range m.orders {
+		if existing.OrderUID != o.OrderUID {
+			continue
+		}
+		if opts.Policy != order.ConflictOverwrite {
+			return order.SaveSkipped, nil
+		}
+		if fn != nil {
+			if err := fn(ctx, nil, &existing, &o); err != nil {
+				return order.SaveSkipped, err
+			}
+		}
+		if !opts.DryRun {
+			m.orders[i] = o
+		}
+		return order.SaveUpdated, nil
+	}
+	if fn != nil {
+		if err := fn(ctx, nil, nil, &o); err != nil {
+			return order.SaveSkipped, err
+		}
+	}
+	if !opts.DryRun {
+		m.orders = append(m.orders, o)
+	}
+	return order.SaveInserted, nil
+}
+func (m *mockRepo) SaveBatch(ctx context.Context, orders []order.Order, opts order.SaveOptions, fn order.AuditFunc) ([]order.SaveResult, []error, error) {
+	if m.saveErr != nil {
+		return nil, nil, m.saveErr
+	}
+	results := make([]order.SaveResult, len(orders))
+	errs := make([]error, len(orders))
+	for i, o := range orders {
+		results[i], errs[i] = m.Save(ctx, o, opts, fn)
+	}
+	return results, errs, nil
+}
 func (m *mockRepo) GetById(ctx context.Context, id string) (order.Order, error) {
 	if m.getErr != nil {
 		return order.Order{}, m.getErr
@@ -42,7 +171,7 @@ func (m *mockRepo) GetById(ctx context.Context, id string) (order.Order, error)
 			return o, nil
 		}
 	}
-	return order.Order{}, errors.New("order not found")
+	return order.Order{}, order.ErrOrderNotFound
 }
 func (m *mockRepo) GetLimit(ctx context.Context, limit int) ([]order.Order, error) {
 	if m.getErr != nil {
@@ -53,6 +182,81 @@ func (m *mockRepo) GetLimit(ctx context.Context, limit int) ([]order.Order, erro
 	}
 	return m.orders[:limit], nil
 }
+func (m *mockRepo) List(ctx context.Context, filter order.ListFilter) ([]order.Order, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	var res []order.Order
+	for _, o := range m.orders {
+		if (filter.From.IsZero() || !o.DateCreated.Before(filter.From)) && (filter.To.IsZero() || o.DateCreated.Before(filter.To)) {
+			res = append(res, o)
+		}
+	}
+	if filter.Limit > 0 && len(res) > filter.Limit {
+		res = res[:filter.Limit]
+	}
+	return res, nil
+}
+func (m *mockRepo) Stream(ctx context.Context, filter order.ListFilter, fn func(order.Order) error) error {
+	orders, err := m.List(ctx, filter)
+	if err != nil {
+		return err
+	}
+	for _, o := range orders {
+		if err := fn(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (m *mockRepo) Delete(ctx context.Context, id string, fn order.AuditFunc) error {
+	for _, o := range m.orders {
+		if o.OrderUID == id {
+			if fn != nil {
+				if err := fn(ctx, nil, &o, nil); err != nil {
+					return err
+				}
+			}
+			m.deleted = append(m.deleted, id)
+			return nil
+		}
+	}
+	return order.ErrOrderNotFound
+}
+func (m *mockRepo) Erase(ctx context.Context, id string, fn order.AuditFunc) error {
+	for _, o := range m.orders {
+		if o.OrderUID == id {
+			if fn != nil {
+				if err := fn(ctx, nil, nil, nil); err != nil {
+					return err
+				}
+			}
+			m.erased = append(m.erased, id)
+			return nil
+		}
+	}
+	return order.ErrOrderNotFound
+}
+func (m *mockRepo) UpdateStatus(ctx context.Context, id string, status int, fn order.AuditFunc) error {
+	for i, o := range m.orders {
+		if o.OrderUID == id {
+			after := o
+			after.Products = make([]order.Product, len(o.Products))
+			for j, p := range o.Products {
+				p.Status = status
+				after.Products[j] = p
+			}
+			if fn != nil {
+				if err := fn(ctx, nil, &o, &after); err != nil {
+					return err
+				}
+			}
+			m.orders[i] = after
+			return nil
+		}
+	}
+	return order.ErrOrderNotFound
+}
 
 type mockCache struct {
 	store map[string]order.Order
@@ -72,6 +276,10 @@ func (m *mockCache) Get(key string) (*order.Order, bool) {
 	return &v, true
 }
 
+func (m *mockCache) Delete(key string) {
+	delete(m.store, key)
+}
+
 func (m *mockCache) GetRecent(limit int) []order.Order {
 	if m.store == nil || limit <= 0 {
 		return []order.Order{}
@@ -87,13 +295,177 @@ func (m *mockCache) GetRecent(limit int) []order.Order {
 }
 
 type writerRec struct {
-	last []byte
-	err  error
+	last    []byte
+	headers []kafkago.Header
+	err     error
 }
 
 func (w *writerRec) WriteMessages(ctx context.Context, msgs ...kafkago.Message) error {
 	if len(msgs) > 0 {
 		w.last = msgs[0].Value
+		w.headers = msgs[0].Headers
 	}
 	return w.err
 }
+
+type mockAuditor struct {
+	entries  []audit.Entry
+	redacted map[string][]string
+	// err fails Record.
+	err error
+}
+
+func (m *mockAuditor) Record(ctx context.Context, client db.Client, e audit.Entry) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.entries = append(m.entries, e)
+	return nil
+}
+func (m *mockAuditor) History(ctx context.Context, id string) ([]audit.Entry, error) {
+	res := make([]audit.Entry, 0)
+	for _, e := range m.entries {
+		if e.OrderUID == id {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+func (m *mockAuditor) Redact(ctx context.Context, client db.Client, id string, paths []string) error {
+	if m.redacted == nil {
+		m.redacted = map[string][]string{}
+	}
+	m.redacted[id] = paths
+	return nil
+}
+
+type mockArchive struct {
+	orders  map[string]order.Order
+	calls   int
+	removed []string
+}
+
+func (m *mockArchive) Get(ctx context.Context, id string) (order.Order, error) {
+	m.calls++
+	if o, ok := m.orders[id]; ok {
+		return o, nil
+	}
+	return order.Order{}, order.ErrOrderNotFound
+}
+
+func (m *mockArchive) Remove(ctx context.Context, id string, fn order.AuditFunc) error {
+	o, ok := m.orders[id]
+	if !ok {
+		return order.ErrOrderNotFound
+	}
+	if fn != nil {
+		if err := fn(ctx, nil, &o, nil); err != nil {
+			return err
+		}
+	}
+	delete(m.orders, id)
+	m.removed = append(m.removed, id)
+	return nil
+}
+
+// fakeReader serves msgs, then fails with err or, when err is nil, blocks
+// until the context is cancelled.
+type fakeReader struct {
+	mu        sync.Mutex
+	msgs      []kafkago.Message
+	err       error
+	committed []kafkago.Message
+	closed    bool
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafkago.Message, error) {
+	r.mu.Lock()
+	if len(r.msgs) > 0 {
+		m := r.msgs[0]
+		r.msgs = r.msgs[1:]
+		r.mu.Unlock()
+		return m, nil
+	}
+	err := r.err
+	r.mu.Unlock()
+	if err != nil {
+		return kafkago.Message{}, err
+	}
+	<-ctx.Done()
+	return kafkago.Message{}, ctx.Err()
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = append(r.committed, msgs...)
+	return nil
+}
+
+func (r *fakeReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+// fakeDB is a db.Client whose QueryRow scans lag into the first destination
+// or fails with err. The other methods fail with "not implemented".
+type fakeDB struct {
+	mu      sync.Mutex
+	lag     float64
+	err     error
+	queries int
+}
+
+func (f *fakeDB) setLag(lag float64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lag, f.err = lag, err
+}
+
+func (f *fakeDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries++
+	return fakeRow{lag: f.lag, err: f.err}
+}
+
+func (f *fakeDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, errors.New("not implemented")
+}
+
+func (f *fakeDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeDB) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	return failedBatch{err: errors.New("not implemented")}
+}
+
+// failedBatch is a pgx.BatchResults whose every result is err.
+type failedBatch struct {
+	err error
+}
+
+func (b failedBatch) Exec() (pgconn.CommandTag, error) { return pgconn.CommandTag{}, b.err }
+func (b failedBatch) Query() (pgx.Rows, error)         { return nil, b.err }
+func (b failedBatch) QueryRow() pgx.Row                { return fakeRow{err: b.err} }
+func (b failedBatch) Close() error                     { return b.err }
+
+type fakeRow struct {
+	lag float64
+	err error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*float64) = r.lag
+	return nil
+}
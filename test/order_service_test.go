@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
+	"L0/internal/audit"
+	"L0/internal/cache"
 	"L0/internal/order"
 )
 
@@ -12,10 +15,10 @@ func TestSaveOrderCallsRepoAndCache(t *testing.T) {
 	repo := &mockRepo{}
 	cache := &mockCache{}
 	writer := &writerRec{}
-	svc := order.NewOrderService(repo, cache, writer, nil)
+	svc := order.NewOrderService(repo, cache, writer, nil, nil)
 
 	o := order.Order{OrderUID: "some-order"}
-	if err := svc.SaveOrder(context.Background(), o); err != nil {
+	if _, err := svc.SaveOrder(context.Background(), o, order.SaveOptions{}); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if _, ok := cache.Get("some-order"); !ok {
@@ -27,7 +30,7 @@ func TestGetOrderByIdFromCache(t *testing.T) {
 	repo := &mockRepo{getErr: errors.New("should not be called")}
 	cache := &mockCache{store: map[string]order.Order{"order-cache": {OrderUID: "order-cache"}}}
 	writer := &writerRec{}
-	svc := order.NewOrderService(repo, cache, writer, nil)
+	svc := order.NewOrderService(repo, cache, writer, nil, nil)
 
 	got, err := svc.GetOrderById(context.Background(), "order-cache")
 	if err != nil {
@@ -43,7 +46,7 @@ func TestGetOrdersLimitCallsRepo(t *testing.T) {
 	repo := &mockRepo{orders: orders}
 	cache := &mockCache{}
 	writer := &writerRec{}
-	svc := order.NewOrderService(repo, cache, writer, nil)
+	svc := order.NewOrderService(repo, cache, writer, nil, nil)
 
 	res, err := svc.GetOrdersLimit(context.Background(), 2)
 	if err != nil {
@@ -54,11 +57,65 @@ func TestGetOrdersLimitCallsRepo(t *testing.T) {
 	}
 }
 
+func TestUncachedReadsSeeWritesOfOtherProcesses(t *testing.T) {
+	ctx := context.Background()
+	repo := &mockRepo{orders: []order.Order{{OrderUID: "order-old"}}}
+	c := cache.NewCache(10)
+	c.Load(repo.orders)
+	svc := order.NewOrderService(repo, c, &writerRec{}, nil, nil)
+	svc.SetCacheReads(false)
+
+	// Written by a consume-only instance after this one warmed up.
+	repo.orders = []order.Order{{OrderUID: "order-new"}}
+
+	list, err := svc.GetOrdersLimit(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].OrderUID != "order-new" {
+		t.Fatalf("expected the order saved after warm-up, got %+v", list)
+	}
+	if _, err := svc.GetOrderById(ctx, "order-old"); !errors.Is(err, order.ErrOrderNotFound) {
+		t.Fatalf("an order gone from the database must not be served from the cache, got %v", err)
+	}
+}
+
+func TestListOrdersByDate(t *testing.T) {
+	jan := makeValidOrder("order-jan")
+	jan.DateCreated = time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+	feb := makeValidOrder("order-feb")
+	feb.DateCreated = time.Date(2025, 2, 15, 0, 0, 0, 0, time.UTC)
+	repo := &mockRepo{orders: []order.Order{feb, jan}}
+	cache := &mockCache{}
+	cache.Set(feb)
+	svc := order.NewOrderService(repo, cache, &writerRec{}, nil, nil)
+
+	res, err := svc.ListOrders(context.Background(), order.ListFilter{
+		From:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:    time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+		Limit: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].OrderUID != "order-jan" {
+		t.Fatalf("date range should be read from the repository, got %+v", res)
+	}
+
+	res, err = svc.ListOrders(context.Background(), order.ListFilter{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || res[0].OrderUID != "order-feb" {
+		t.Fatalf("unbounded list should come from the cache, got %+v", res)
+	}
+}
+
 func TestCreateOrderWritesToWriter(t *testing.T) {
 	repo := &mockRepo{}
 	cache := &mockCache{}
 	w := &writerRec{}
-	svc := order.NewOrderService(repo, cache, w, nil)
+	svc := order.NewOrderService(repo, cache, w, nil, nil)
 
 	ord, err := svc.CreateOrder(context.Background())
 	if err != nil {
@@ -71,3 +128,158 @@ func TestCreateOrderWritesToWriter(t *testing.T) {
 		t.Fatalf("expected writer to receive payload")
 	}
 }
+
+func TestDeleteOrderEvictsCache(t *testing.T) {
+	repo := &mockRepo{orders: []order.Order{{OrderUID: "order-del"}}}
+	cache := &mockCache{store: map[string]order.Order{"order-del": {OrderUID: "order-del"}}}
+	svc := order.NewOrderService(repo, cache, &writerRec{}, nil, nil)
+
+	if err := svc.DeleteOrder(context.Background(), "order-del"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, ok := cache.Get("order-del"); ok {
+		t.Fatalf("expected order to be evicted from cache")
+	}
+	if len(repo.deleted) != 1 {
+		t.Fatalf("expected repo delete to be called")
+	}
+}
+
+func TestEraseOrderNotFoundKeepsCache(t *testing.T) {
+	repo := &mockRepo{}
+	cache := &mockCache{store: map[string]order.Order{"order-erase": {OrderUID: "order-erase"}}}
+	svc := order.NewOrderService(repo, cache, &writerRec{}, nil, nil)
+
+	err := svc.EraseOrder(context.Background(), "order-erase")
+	if !errors.Is(err, order.ErrOrderNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if _, ok := cache.Get("order-erase"); !ok {
+		t.Fatalf("cache must not change when erase fails")
+	}
+}
+
+func TestSaveOrderRecordsCreateOnce(t *testing.T) {
+	repo := &mockRepo{}
+	auditor := &mockAuditor{}
+	svc := order.NewOrderService(repo, &mockCache{}, &writerRec{}, auditor, nil)
+
+	ctx := audit.WithSource(context.Background(), audit.KafkaSource("orders", 0, 42))
+	o := order.Order{OrderUID: "order-audit"}
+	for i := 0; i < 2; i++ {
+		if _, err := svc.SaveOrder(ctx, o, order.SaveOptions{}); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	if len(auditor.entries) != 1 {
+		t.Fatalf("expected 1 audit entry for duplicate saves, got %d", len(auditor.entries))
+	}
+	e := auditor.entries[0]
+	if e.Action != audit.ActionCreate || e.Source.Kind != audit.SourceKafka || e.Source.Ref != "orders/0/42" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+	if _, ok := e.Diff["order_uid"]; !ok {
+		t.Fatalf("expected order_uid in create diff, got %v", e.Diff)
+	}
+}
+
+func TestUpdateOrderStatusRecordsDiff(t *testing.T) {
+	repo := &mockRepo{orders: []order.Order{{
+		OrderUID: "order-status",
+		Products: []order.Product{{ChrtID: 1, Status: 202}},
+	}}}
+	auditor := &mockAuditor{}
+	svc := order.NewOrderService(repo, &mockCache{}, &writerRec{}, auditor, nil)
+
+	if err := svc.UpdateOrderStatus(context.Background(), "order-status", 300); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	history, _ := svc.GetOrderAudit(context.Background(), "order-status")
+	if len(history) != 1 || history[0].Action != audit.ActionStatusChange {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+	if _, ok := history[0].Diff["items"]; !ok || len(history[0].Diff) != 1 {
+		t.Fatalf("expected only items to change, got %v", history[0].Diff)
+	}
+}
+
+func TestEraseOrderRedactsAuditHistory(t *testing.T) {
+	repo := &mockRepo{orders: []order.Order{{OrderUID: "order-gdpr"}}}
+	auditor := &mockAuditor{}
+	svc := order.NewOrderService(repo, &mockCache{}, &writerRec{}, auditor, nil)
+
+	if err := svc.EraseOrder(context.Background(), "order-gdpr"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(auditor.redacted["order-gdpr"]) == 0 {
+		t.Fatalf("expected audit history to be redacted")
+	}
+	if len(auditor.entries) != 1 || auditor.entries[0].Action != audit.ActionErase || auditor.entries[0].Before != nil {
+		t.Fatalf("unexpected erase entry: %+v", auditor.entries)
+	}
+}
+
+func TestSaveOrderOverwriteRecordsUpdate(t *testing.T) {
+	repo := &mockRepo{orders: []order.Order{{OrderUID: "order-ow", Entry: "WBIL"}}}
+	cache := &mockCache{}
+	auditor := &mockAuditor{}
+	svc := order.NewOrderService(repo, cache, &writerRec{}, auditor, nil)
+	svc.SetConflictPolicy(order.ConflictOverwrite)
+
+	res, err := svc.SaveOrder(context.Background(), order.Order{OrderUID: "order-ow", Entry: "WBX"}, order.SaveOptions{})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if res != order.SaveUpdated {
+		t.Fatalf("expected updated, got %s", res)
+	}
+	if got, ok := cache.Get("order-ow"); !ok || got.Entry != "WBX" {
+		t.Fatalf("expected updated order in cache")
+	}
+	if len(auditor.entries) != 1 || auditor.entries[0].Action != audit.ActionUpdate {
+		t.Fatalf("unexpected audit entries: %+v", auditor.entries)
+	}
+	if ch := auditor.entries[0].Diff["entry"]; ch.Before != "WBIL" || ch.After != "WBX" {
+		t.Fatalf("unexpected diff: %+v", auditor.entries[0].Diff)
+	}
+}
+
+func TestSaveOrderDryRunHasNoSideEffects(t *testing.T) {
+	repo := &mockRepo{}
+	cache := &mockCache{}
+	auditor := &mockAuditor{}
+	svc := order.NewOrderService(repo, cache, &writerRec{}, auditor, nil)
+
+	res, err := svc.SaveOrder(context.Background(), order.Order{OrderUID: "order-dry"}, order.SaveOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if res != order.SaveInserted {
+		t.Fatalf("expected inserted, got %s", res)
+	}
+	if _, ok := cache.Get("order-dry"); ok || len(repo.orders) != 0 || len(auditor.entries) != 0 {
+		t.Fatalf("dry run must not change cache, repository or audit log")
+	}
+}
+
+func TestAuditFailureFailsTheWrite(t *testing.T) {
+	repo := &mockRepo{orders: []order.Order{{OrderUID: "order-kept"}}}
+	cache := &mockCache{}
+	auditor := &mockAuditor{err: errors.New("audit down")}
+	svc := order.NewOrderService(repo, cache, &writerRec{}, auditor, nil)
+
+	if _, err := svc.SaveOrder(context.Background(), order.Order{OrderUID: "order-new"}, order.SaveOptions{}); err == nil {
+		t.Fatal("expected the save to fail with its audit entry")
+	}
+	if _, ok := cache.Get("order-new"); ok || len(repo.orders) != 1 {
+		t.Fatalf("failed save must not reach the repository or the cache")
+	}
+	if err := svc.DeleteOrder(context.Background(), "order-kept"); err == nil || len(repo.deleted) != 0 {
+		t.Fatalf("expected the delete to fail with its audit entry, got %v", err)
+	}
+	if err := svc.EraseOrder(context.Background(), "order-kept"); err == nil || len(repo.erased) != 0 {
+		t.Fatalf("expected the erase to fail with its audit entry, got %v", err)
+	}
+}
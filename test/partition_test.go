@@ -0,0 +1,198 @@
+package test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"L0/internal/config"
+	"L0/internal/db"
+	"L0/internal/order"
+	"L0/internal/partition"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func month(year int, m time.Month) time.Time {
+	return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestPartitionName(t *testing.T) {
+	if got := partition.Name("orders", month(2025, time.March)); got != "orders_p2025_03" {
+		t.Fatalf("unexpected name %s", got)
+	}
+	at := time.Date(2025, 3, 31, 23, 30, 0, 0, time.FixedZone("MSK", -3*3600))
+	if got := partition.Month(at); !got.Equal(month(2025, time.April)) {
+		t.Fatalf("months are UTC, got %s", got)
+	}
+}
+
+func TestPartitionPlan(t *testing.T) {
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	existing := []time.Time{
+		month(2024, time.December), month(2025, time.January), month(2025, time.February),
+		month(2025, time.June), month(2025, time.July),
+	}
+
+	create, detach := partition.Plan(existing, now, 3, 4)
+	if want := []time.Time{month(2025, time.August), month(2025, time.September)}; !reflect.DeepEqual(create, want) {
+		t.Fatalf("create = %v, want %v", create, want)
+	}
+	if want := []time.Time{month(2024, time.December), month(2025, time.January)}; !reflect.DeepEqual(detach, want) {
+		t.Fatalf("detach = %v, want %v", detach, want)
+	}
+
+	if _, detach := partition.Plan(existing, now, 3, 0); detach != nil {
+		t.Fatalf("zero retention keeps everything, got %v", detach)
+	}
+}
+
+func TestPartitionMaintenance(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	now := time.Now()
+	current := partition.Month(now)
+	repo := order.NewOrderRepository(db.NewCluster(pool, time.Second), nil)
+
+	// Orders beyond the premade months land in the default partition and
+	// move to their own when it is created.
+	future := makeValidOrder("order-future")
+	future.TrackNumber = "TRACKFUTURE"
+	future.Products[0].TrackNumber = future.TrackNumber
+	future.DateCreated = current.AddDate(0, 5, 2)
+	if _, err := repo.Save(ctx, future, order.SaveOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := testArchiveSchema(t, pool)
+	m := partition.NewMaintainer(pool, config.PartitionConf{MonthsAhead: 6, RetentionMonths: 2, ArchiveSchema: archive}, nil)
+	old := current.AddDate(0, -3, 0)
+	if err := m.Create(ctx, old); err != nil {
+		t.Fatal(err)
+	}
+	past := makeValidOrder("order-past")
+	past.DateCreated = old.AddDate(0, 0, 1)
+	if _, err := repo.Save(ctx, past, order.SaveOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := m.RunOnce(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Created) != 3 {
+		t.Fatalf("expected months 4 to 6 ahead created, got %v", report.Created)
+	}
+	if want := []string{partition.Name("orders", old)}; !reflect.DeepEqual(report.Detached, want) {
+		t.Fatalf("detached = %v, want %v", report.Detached, want)
+	}
+
+	var n int
+	name := partition.Name("products", future.DateCreated)
+	if err := pool.QueryRow(ctx, `SELECT count(*) FROM `+name).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("future items should move to %s: %d, %v", name, n, err)
+	}
+	if _, err := repo.GetById(ctx, future.OrderUID); err != nil {
+		t.Fatalf("moved order should still be found: %v", err)
+	}
+	if _, err := repo.GetById(ctx, past.OrderUID); err != order.ErrOrderNotFound {
+		t.Fatalf("detached order should be gone, got %v", err)
+	}
+	name = archive + "." + partition.Name("orders", old)
+	if err := pool.QueryRow(ctx, `SELECT count(*) FROM `+name).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("detached order should be in %s: %d, %v", name, n, err)
+	}
+	// Its order_uid stays taken: a redelivery does not bring it back.
+	if res, err := repo.Save(ctx, past, order.SaveOptions{}, nil); err != nil || res != order.SaveSkipped {
+		t.Fatalf("save of a detached order = %v, %v", res, err)
+	}
+
+	from := current.AddDate(0, 5, 0)
+	page, err := repo.List(ctx, order.ListFilter{From: from, To: from.AddDate(0, 1, 0), Limit: 10})
+	if err != nil || len(page) != 1 || page[0].OrderUID != future.OrderUID {
+		t.Fatalf("date filtered list = %+v, %v", page, err)
+	}
+
+	// A second run has nothing left to do.
+	if report, err := m.RunOnce(ctx, now); err != nil || len(report.Created)+len(report.Detached) != 0 {
+		t.Fatalf("second run = %+v, %v", report, err)
+	}
+}
+
+// testArchiveSchema names an archive schema for the test, dropped when it
+// ends.
+func testArchiveSchema(t *testing.T, pool *pgxpool.Pool) string {
+	var schema string
+	if err := pool.QueryRow(context.Background(), `SELECT current_schema() || '_archive'`).Scan(&schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _, _ = pool.Exec(context.Background(), "DROP SCHEMA IF EXISTS "+schema+" CASCADE") })
+	return schema
+}
+
+func TestSaveKeepsOrderUIDUnique(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	repo := order.NewOrderRepository(db.NewCluster(pool, time.Second), nil)
+
+	o := makeValidOrder("order-moved")
+	o.DateCreated = time.Now()
+	if _, err := repo.Save(ctx, o, order.SaveOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	moved := o
+	moved.DateCreated = o.DateCreated.AddDate(0, -1, 0)
+	if res, err := repo.Save(ctx, moved, order.SaveOptions{}, nil); err != nil || res != order.SaveSkipped {
+		t.Fatalf("same order_uid in another month should be skipped, got %v, %v", res, err)
+	}
+	if res, err := repo.Save(ctx, moved, order.SaveOptions{Policy: order.ConflictOverwrite}, nil); err != nil || res != order.SaveUpdated {
+		t.Fatalf("overwrite should move the order, got %v, %v", res, err)
+	}
+	var n int
+	if err := pool.QueryRow(ctx, `SELECT count(*) FROM orders WHERE order_uid = $1`, o.OrderUID).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("expected one row, got %d, %v", n, err)
+	}
+}
+
+func TestItemsFollowOrderWhenTrackNumberRecurs(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	repo := order.NewOrderRepository(db.NewCluster(pool, time.Second), nil)
+
+	// A track number is unique only within a month; items must still come
+	// back with their own order.
+	first := makeValidOrder("order-track-1")
+	first.DateCreated = time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC)
+	first.Products = []order.Product{{ChrtID: 1, TrackNumber: first.TrackNumber, Price: 10}}
+	second := makeValidOrder("order-track-2")
+	second.DateCreated = time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	second.Products = []order.Product{{ChrtID: 2, TrackNumber: second.TrackNumber, Price: 20}}
+	for _, o := range []order.Order{first, second} {
+		if res, err := repo.Save(ctx, o, order.SaveOptions{}, nil); err != nil || res != order.SaveInserted {
+			t.Fatalf("save %s: %v, %v", o.OrderUID, res, err)
+		}
+	}
+
+	for _, want := range []order.Order{first, second} {
+		got, err := repo.GetById(ctx, want.OrderUID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Products) != 1 || got.Products[0].ChrtID != want.Products[0].ChrtID {
+			t.Fatalf("%s: unexpected items %+v", want.OrderUID, got.Products)
+		}
+	}
+	list, err := repo.List(ctx, order.ListFilter{From: first.DateCreated, To: second.DateCreated.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected both orders, got %d", len(list))
+	}
+	for _, o := range list {
+		if len(o.Products) != 1 || (o.OrderUID == first.OrderUID) != (o.Products[0].ChrtID == 1) {
+			t.Fatalf("%s: items of another order %+v", o.OrderUID, o.Products)
+		}
+	}
+}
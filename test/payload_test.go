@@ -0,0 +1,150 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"L0/internal/api"
+	"L0/internal/order"
+	"L0/internal/transfer"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readFixture returns a file of testdata. payload_unversioned.json is an
+// order as published before payloads named their version, payload_v1.json
+// the same order as published now.
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestUnmarshalPayloadReadsUnversionedAsV1(t *testing.T) {
+	legacy, err := order.UnmarshalPayload([]byte(readFixture(t, "payload_unversioned.json")), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy.PayloadVersion != 1 || legacy.ShardKey != "9" || legacy.Payment.PaymentDt != 1637907727 ||
+		len(legacy.Products) != 1 || legacy.Products[0].ChrtID != 9934930 {
+		t.Fatalf("unversioned payload not mapped: %+v", legacy)
+	}
+
+	v1, err := order.UnmarshalPayload([]byte(readFixture(t, "payload_v1.json")), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v1, legacy) {
+		t.Fatalf("version 1 mismatch:\ngot  %+v\nwant %+v", v1, legacy)
+	}
+}
+
+// TestMarshalPayloadMatchesV1 pins the published format: it changes only
+// with a new version.
+func TestMarshalPayloadMatchesV1(t *testing.T) {
+	want := readFixture(t, "payload_v1.json")
+	o, err := order.UnmarshalPayload([]byte(want), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := order.MarshalPayload(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, doc any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, doc) {
+		t.Fatalf("published payload differs from version 1:\ngot  %s\nwant %s", data, want)
+	}
+}
+
+func TestUnmarshalPayloadVersions(t *testing.T) {
+	payload := readFixture(t, "payload_unversioned.json")
+	newer := strings.Replace(payload, `"order_uid"`, `"version": 2, "order_uid"`, 1)
+	o, err := order.UnmarshalPayload([]byte(newer), false)
+	if !errors.Is(err, order.ErrUnsupportedPayloadVersion) {
+		t.Fatalf("expected ErrUnsupportedPayloadVersion, got %v", err)
+	}
+	if o.OrderUID != "b563feb7b2b84b6test" {
+		t.Fatalf("order_uid not kept for error reports: %+v", o)
+	}
+
+	if _, err := order.UnmarshalPayload([]byte(`{"version": "1"}`), false); err == nil {
+		t.Fatal("expected a non-numeric version to fail")
+	}
+}
+
+func TestUnmarshalPayloadStrict(t *testing.T) {
+	payload := readFixture(t, "payload_v1.json")
+	for name, doc := range map[string]string{
+		"unknown field": strings.Replace(payload, `"oof_shard": "1"`, `"oof_shard": "1", "colour": "red"`, 1),
+		"nested field":  strings.Replace(payload, `"bank": "alpha"`, `"bank": "alpha", "card": "4242"`, 1),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := order.UnmarshalPayload([]byte(doc), false); err != nil {
+				t.Fatalf("lenient decoding failed: %v", err)
+			}
+			_, err := order.UnmarshalPayload([]byte(doc), true)
+			if err == nil || !strings.Contains(err.Error(), "unknown field") {
+				t.Fatalf("expected an unknown field error, got %v", err)
+			}
+		})
+	}
+
+	if _, err := order.UnmarshalPayload([]byte(payload+` {}`), true); err == nil {
+		t.Fatal("expected data after the payload to fail")
+	}
+}
+
+func TestImportStrictPayloads(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &mockService{saveRes: order.SaveInserted}
+	r := api.NewHandler(ms, api.WithStrictPayloads(true)).RegisterOrderRouter()
+
+	o := makeValidOrder("order-strict")
+	o.DateCreated = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	line := ndjsonLines(t, o)[0]
+	extra := strings.Replace(line, `"order_uid"`, `"colour": "red", "order_uid"`, 1)
+	body := line + "\n" + extra + "\n"
+
+	w := postImport(r, "/orders/import", "application/x-ndjson", body)
+	var report transfer.ImportReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || report.Inserted != 1 || report.Failed != 1 || report.Errors[0].Line != 2 ||
+		report.Errors[0].OrderUID != "order-strict" {
+		t.Fatalf("expected line 2 to fail in strict mode, got %d: %s", w.Code, w.Body)
+	}
+	if ms.saved[0].PayloadVersion != 1 {
+		t.Fatalf("payload version not passed on: %+v", ms.saved[0])
+	}
+
+	ms.saved = nil
+	w = postImport(r, "/orders/import?strict=false", "application/x-ndjson", body)
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Inserted != 2 || report.Failed != 0 {
+		t.Fatalf("strict=false should ignore unknown fields: %s", w.Body)
+	}
+
+	if w = postImport(r, "/orders/import?strict=maybe", "application/x-ndjson", body); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid strict, got %d", w.Code)
+	}
+}
@@ -0,0 +1,132 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"L0/internal/api"
+	"L0/internal/auth"
+	"L0/internal/config"
+	"L0/internal/order"
+	"L0/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLimiterPerKey(t *testing.T) {
+	l := ratelimit.New(1, 2)
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d within burst must pass", i+1)
+		}
+	}
+	ok, retry := l.Allow("a")
+	if ok || retry <= 0 || retry > 1e9 {
+		t.Fatalf("expected rejection with retry within a second, got ok=%v retry=%s", ok, retry)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Fatalf("other clients have their own bucket")
+	}
+
+	l.SetLimit(1, 5)
+	if ok, _ := l.Allow("c"); !ok {
+		t.Fatalf("new limits apply to new clients")
+	}
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	l := ratelimit.New(0, 0)
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("zero rate must not limit")
+		}
+	}
+	l.SetLimit(1, 1)
+	l.Allow("a")
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatalf("limit set at runtime must apply")
+	}
+	l.SetLimit(0, 0)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatalf("limit removed at runtime must stop limiting")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := &mockService{order: order.Order{OrderUID: "order-r"}}
+	r := api.NewHandler(ms, api.WithRateLimits(ratelimit.New(100, 5), ratelimit.New(0.1, 1))).RegisterOrderRouter()
+
+	if rec := doRequest(r, http.MethodPost, "/orders/", nil); rec.Code != http.StatusCreated {
+		t.Fatalf("first write: expected 201, got %d", rec.Code)
+	}
+	rec := doRequest(r, http.MethodPost, "/orders/", nil)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second write: expected 429, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "10" {
+		t.Fatalf("expected Retry-After 10, got %q", got)
+	}
+	if rec := doRequest(r, http.MethodGet, "/orders/order-r", nil); rec.Code != http.StatusOK {
+		t.Fatalf("reads use their own limit, got %d", rec.Code)
+	}
+	if rec := doRequest(r, http.MethodPost, "/orders/", map[string]string{"X-Forwarded-For": "10.0.0.9"}); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("untrusted X-Forwarded-For must not change the client key, got %d", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/orders/", nil)
+	req.RemoteAddr = "10.0.0.9:1234"
+	other := httptest.NewRecorder()
+	r.ServeHTTP(other, req)
+	if other.Code != http.StatusCreated {
+		t.Fatalf("another client IP must not be limited, got %d", other.Code)
+	}
+}
+
+func TestIPRateLimitRunsBeforeAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a, err := auth.New(config.AuthConf{Enabled: true, APIKeys: "ci:admin:k1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := api.NewHandler(&mockService{}, api.WithAuth(a), api.WithIPRateLimit(ratelimit.New(0.1, 1))).RegisterOrderRouter()
+
+	if rec := doRequest(r, http.MethodGet, "/orders/x", map[string]string{"X-API-Key": "guess-1"}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("first guess: expected 401, got %d", rec.Code)
+	}
+	if rec := doRequest(r, http.MethodGet, "/orders/x", map[string]string{"X-API-Key": "guess-2"}); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("unauthenticated requests must be limited by IP, got %d", rec.Code)
+	}
+	if rec := doRequest(r, http.MethodGet, "/orders/x", map[string]string{"X-API-Key": "k1"}); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("a valid key must not reset the IP bucket, got %d", rec.Code)
+	}
+}
+
+func TestRateLimitKeysByPrincipal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a, err := auth.New(config.AuthConf{Enabled: true, APIKeys: "ci:admin:k1,bot:admin:k2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := &mockService{order: order.Order{OrderUID: "order-r"}}
+	r := api.NewHandler(ms, api.WithAuth(a), api.WithIPRateLimit(ratelimit.New(100, 100)),
+		api.WithRateLimits(ratelimit.New(0.1, 1), nil)).RegisterOrderRouter()
+
+	get := func(key, ip string) int {
+		req := httptest.NewRequest(http.MethodGet, "/orders/order-r", nil)
+		req.Header.Set("X-API-Key", key)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := get("k1", "10.0.0.1"); code != http.StatusOK {
+		t.Fatalf("first read: expected 200, got %d", code)
+	}
+	if code := get("k2", "10.0.0.1"); code != http.StatusOK {
+		t.Fatalf("another key behind the same IP has its own bucket, got %d", code)
+	}
+	if code := get("k1", "10.0.0.2"); code != http.StatusTooManyRequests {
+		t.Fatalf("a key used from another IP shares its bucket, got %d", code)
+	}
+}
@@ -0,0 +1,63 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"L0/internal/config"
+	"L0/internal/kafka"
+	"L0/internal/logger"
+	"L0/internal/order"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func orderMessage(t *testing.T, o order.Order, offset int64, at time.Time) kafkago.Message {
+	t.Helper()
+	payload, err := json.Marshal(o)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return kafkago.Message{Topic: "orders", Offset: offset, Value: payload, Time: at}
+}
+
+func TestReplayerCountsOutcomes(t *testing.T) {
+	ms := &mockService{saveRes: order.SaveUpdated}
+	to := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := kafka.NewReplayer(config.KafkaConf{Topic: "orders"}, ms, kafka.ReplayOptions{
+		DryRun: true,
+		Policy: order.ConflictOverwrite,
+		To:     to,
+	}, logger.Discard())
+	ctx := context.Background()
+
+	if !r.Process(ctx, orderMessage(t, makeValidOrder("order1"), 1, to.Add(-time.Hour))) {
+		t.Fatalf("message inside the range must be processed")
+	}
+	r.Process(ctx, orderMessage(t, order.Order{OrderUID: "broken"}, 2, to.Add(-time.Hour)))
+	r.Process(ctx, kafkago.Message{Topic: "orders", Offset: 3, Value: []byte("{"), Time: to})
+	if r.Process(ctx, orderMessage(t, makeValidOrder("order2"), 4, to.Add(time.Second))) {
+		t.Fatalf("message after To must stop the partition")
+	}
+
+	report := r.Report()
+	if report.Updated != 1 || report.Failed != 2 || report.Inserted != 0 || report.Skipped != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.NextOffsets[0] != 4 {
+		t.Fatalf("expected to resume partition 0 at 4, got %v", report.NextOffsets)
+	}
+	if len(ms.saveOpts) != 1 || !ms.saveOpts[0].DryRun || ms.saveOpts[0].Policy != order.ConflictOverwrite {
+		t.Fatalf("expected dry-run overwrite save, got %+v", ms.saveOpts)
+	}
+}
+
+func TestReplayerRejectsLiveGroup(t *testing.T) {
+	cfg := config.KafkaConf{Topic: "orders", GroupID: "orders-consumer"}
+	r := kafka.NewReplayer(cfg, &mockService{}, kafka.ReplayOptions{GroupID: cfg.GroupID}, logger.Discard())
+	if _, err := r.Run(context.Background()); err == nil {
+		t.Fatal("committing replay progress under the live group must be refused")
+	}
+}
@@ -0,0 +1,186 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"L0/internal/db"
+	"L0/internal/migrations"
+	"L0/internal/order"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testPool connects to TEST_PG_DSN and migrates a schema of its own, dropped
+// when the test ends. Tests using it are skipped without TEST_PG_DSN.
+func testPool(tb testing.TB) *pgxpool.Pool {
+	tb.Helper()
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		tb.Skip("TEST_PG_DSN not set")
+	}
+	ctx := context.Background()
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	admin, err := pgxpool.NewWithConfig(ctx, cfg.Copy())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(admin.Close)
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _, _ = admin.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE") })
+
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(pool.Close)
+	m, err := migrations.NewMigrator(pool)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := m.Up(ctx); err != nil {
+		tb.Fatal(err)
+	}
+	return pool
+}
+
+// seedOrders saves n orders with items products each, one second apart.
+func seedOrders(tb testing.TB, repo *order.OrderRepository, n, items int) []order.Order {
+	tb.Helper()
+	orders := make([]order.Order, n)
+	for i := range orders {
+		o := makeValidOrder(fmt.Sprintf("order-%05d", i))
+		o.TrackNumber = fmt.Sprintf("TRACK%05d", i)
+		o.DateCreated = o.DateCreated.Add(time.Duration(i) * time.Second)
+		// Unknown versions, 0, are stored as NULL and read back as 0.
+		o.PayloadVersion = i % (order.CurrentPayloadVersion + 1)
+		o.Products = make([]order.Product, items)
+		for j := range o.Products {
+			o.Products[j] = order.Product{ChrtID: i*items + j + 1, TrackNumber: o.TrackNumber, Price: 100 + j, Name: "item"}
+		}
+		if _, err := repo.Save(context.Background(), o, order.SaveOptions{}, nil); err != nil {
+			tb.Fatal(err)
+		}
+		orders[i] = o
+	}
+	return orders
+}
+
+func TestRepositoryReadsChildren(t *testing.T) {
+	pool := testPool(t)
+	repo := order.NewOrderRepository(db.NewCluster(pool, time.Second), nil)
+	saved := seedOrders(t, repo, 3, 2)
+	ctx := context.Background()
+
+	got, err := repo.GetById(ctx, saved[1].OrderUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.DateCreated = got.DateCreated.UTC()
+	if !reflect.DeepEqual(got, saved[1]) {
+		t.Fatalf("GetById mismatch:\ngot  %+v\nwant %+v", got, saved[1])
+	}
+	if _, err := repo.GetById(ctx, "missing"); err != order.ErrOrderNotFound {
+		t.Fatalf("expected ErrOrderNotFound, got %v", err)
+	}
+
+	page, err := repo.GetLimit(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || page[0].OrderUID != saved[2].OrderUID || page[1].OrderUID != saved[1].OrderUID {
+		t.Fatalf("GetLimit should return the newest orders first, got %d orders", len(page))
+	}
+	for _, o := range page {
+		if len(o.Products) != 2 || o.Delivery.Name == "" || o.Payment.Transaction != o.OrderUID {
+			t.Fatalf("children missing from %+v", o)
+		}
+	}
+}
+
+// BenchmarkGetLimit compares the batched reads of GetLimit with the former
+// single query aggregating the children into JSON.
+func BenchmarkGetLimit(b *testing.B) {
+	pool := testPool(b)
+	repo := order.NewOrderRepository(db.NewCluster(pool, time.Second), nil)
+	seedOrders(b, repo, 1000, 5)
+	ctx := context.Background()
+
+	for _, limit := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("batch/%d", limit), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := repo.GetLimit(ctx, limit); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("json_agg/%d", limit), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := getLimitJSON(ctx, pool, limit); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// getLimitJSON is the former GetLimit, kept as the benchmark baseline.
+func getLimitJSON(ctx context.Context, pool *pgxpool.Pool, limit int) ([]order.Order, error) {
+	query := `
+		SELECT
+			o.order_uid, o.track_number, o.entry,
+			o.locale, COALESCE(o.internal_signature, ''), o.customer_id,
+			o.delivery_service, o.shardkey, o.sm_id,
+			o.date_created, o.oof_shard,
+			to_jsonb(d.*) AS delivery,
+			to_jsonb(p.*) AS payment,
+			COALESCE(json_agg(pr.*) FILTER (WHERE pr.chrt_id IS NOT NULL), '[]') AS products
+		FROM orders o
+		LEFT JOIN deliveries d ON o.order_uid = d.order_uid
+		LEFT JOIN payments p ON o.order_uid = p.order_uid
+		LEFT JOIN products pr ON o.track_number = pr.track_number
+		WHERE o.deleted_at IS NULL
+		GROUP BY o.order_uid, d.*, p.*
+		ORDER BY o.date_created DESC
+		LIMIT $1
+	`
+	rows, err := pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []order.Order
+	for rows.Next() {
+		var o order.Order
+		var delivery, payment, products []byte
+		if err := rows.Scan(&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature, &o.CustomerID,
+			&o.DeliveryService, &o.ShardKey, &o.SmID, &o.DateCreated, &o.OofShard,
+			&delivery, &payment, &products); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(delivery, &o.Delivery); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(payment, &o.Payment); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(products, &o.Products); err != nil {
+			return nil, err
+		}
+		result = append(result, o)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,108 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"L0/internal/config"
+	"L0/internal/kafka"
+)
+
+// writeCert writes a self-signed certificate and its key as PEM files.
+func writeCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestKafkaDialerTLS(t *testing.T) {
+	certFile, keyFile := writeCert(t)
+	d, err := kafka.NewDialer(config.KafkaConf{TLS: config.KafkaTLSConf{
+		Enabled:  true,
+		CAFile:   certFile,
+		CertFile: certFile,
+		KeyFile:  keyFile,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.TLS == nil || d.TLS.RootCAs == nil || len(d.TLS.Certificates) != 1 {
+		t.Fatalf("unexpected tls config %+v", d.TLS)
+	}
+
+	d, err = kafka.NewDialer(config.KafkaConf{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.TLS != nil || d.SASLMechanism != nil {
+		t.Fatalf("security must be off by default")
+	}
+}
+
+func TestKafkaDialerTLSErrors(t *testing.T) {
+	certFile, _ := writeCert(t)
+	for name, tlsCfg := range map[string]config.KafkaTLSConf{
+		"missing ca":      {Enabled: true, CAFile: filepath.Join(t.TempDir(), "none.pem")},
+		"key without pem": {Enabled: true, CertFile: certFile, KeyFile: certFile},
+	} {
+		if _, err := kafka.NewDialer(config.KafkaConf{TLS: tlsCfg}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestKafkaSASLMechanisms(t *testing.T) {
+	for mech, want := range map[string]string{
+		"PLAIN":         "PLAIN",
+		"scram-sha-256": "SCRAM-SHA-256",
+		"SCRAM-SHA-512": "SCRAM-SHA-512",
+	} {
+		d, err := kafka.NewDialer(config.KafkaConf{SASL: config.KafkaSASLConf{Mechanism: mech, Username: "u", Password: "p"}})
+		if err != nil {
+			t.Fatalf("%s: %v", mech, err)
+		}
+		if d.SASLMechanism == nil || d.SASLMechanism.Name() != want {
+			t.Fatalf("%s: unexpected mechanism %v", mech, d.SASLMechanism)
+		}
+	}
+	if _, err := kafka.NewTransport(config.KafkaConf{SASL: config.KafkaSASLConf{Mechanism: "GSSAPI"}}); err == nil {
+		t.Fatalf("expected error for unsupported mechanism")
+	}
+}
@@ -0,0 +1,133 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"L0/internal/kafka"
+	"L0/internal/logger"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func TestConsumerRunStopsOnCancel(t *testing.T) {
+	ms := &mockService{}
+	r := &fakeReader{msgs: []kafkago.Message{orderMessage(t, makeValidOrder("order1"), 1, time.Now())}}
+	c := kafka.NewConsumer(r, ms, nil, logger.Discard())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+
+	waitFor(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.committed) == 1
+	})
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("expected nil on cancel, got %v", err)
+	}
+	if len(ms.saved) != 1 || ms.saved[0].OrderUID != "order1" {
+		t.Fatalf("unexpected saved orders %v", ms.saved)
+	}
+}
+
+func TestSupervisorRestartsFailedConsumer(t *testing.T) {
+	ms := &mockService{}
+	readers := []*fakeReader{
+		{err: errors.New("broker went away")},
+		{msgs: []kafkago.Message{orderMessage(t, makeValidOrder("order2"), 7, time.Now())}},
+	}
+	created := make(chan *fakeReader, len(readers))
+	next := 0
+	newReader := func() (kafka.MessageReader, error) {
+		r := readers[next]
+		next++
+		created <- r
+		return r, nil
+	}
+	s := kafka.NewSupervisor(newReader, ms, nil, logger.Discard(), time.Millisecond, 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	<-created
+	second := <-created
+	waitFor(t, func() bool {
+		second.mu.Lock()
+		defer second.mu.Unlock()
+		return len(second.committed) == 1
+	})
+	if err := s.Check(time.Minute)(ctx); err != nil {
+		t.Fatalf("restarted consumer should be healthy: %v", err)
+	}
+	st := s.Status()
+	if st.State != kafka.StateRunning || st.Restarts != 1 || st.LastError == "" {
+		t.Fatalf("unexpected status %+v", st)
+	}
+
+	cancel()
+	<-done
+	if !readers[0].closed || !readers[1].closed {
+		t.Fatalf("every reader must be closed")
+	}
+	if s.Status().State != kafka.StateStopped {
+		t.Fatalf("expected stopped, got %s", s.Status().State)
+	}
+	if err := s.Check(time.Minute)(context.Background()); err == nil {
+		t.Fatalf("stopped consumer must not be ready")
+	}
+	if err := s.LiveCheck(time.Minute)(context.Background()); err != nil {
+		t.Fatalf("stopped consumer is not a liveness failure: %v", err)
+	}
+}
+
+func TestSupervisorRetriesReaderFactoryError(t *testing.T) {
+	ms := &mockService{}
+	r := &fakeReader{msgs: []kafkago.Message{orderMessage(t, makeValidOrder("order3"), 1, time.Now())}}
+	calls := 0
+	newReader := func() (kafka.MessageReader, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("bad sasl config")
+		}
+		return r, nil
+	}
+	s := kafka.NewSupervisor(newReader, ms, nil, logger.Discard(), time.Millisecond, 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	waitFor(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.committed) == 1
+	})
+	cancel()
+	<-done
+	if st := s.Status(); st.Restarts != 1 || !strings.Contains(st.LastError, "bad sasl config") {
+		t.Fatalf("unexpected status %+v", st)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
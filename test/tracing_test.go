@@ -0,0 +1,90 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"L0/internal/api"
+	"L0/internal/cache"
+	"L0/internal/config"
+	"L0/internal/order"
+	"L0/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+	kafkago "github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func setupTracing(t *testing.T) (*tracetest.InMemoryExporter, func()) {
+	t.Helper()
+	if _, err := tracing.Setup(context.Background(), config.TracingConf{}); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	exp := tracetest.NewInMemoryExporter()
+	tp := tracing.NewProvider(exp, "test", 1)
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	flush := func() {
+		if err := tp.ForceFlush(context.Background()); err != nil {
+			t.Fatalf("flush: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		_ = tp.Shutdown(context.Background())
+	})
+	return exp, flush
+}
+
+func TestCreateOrderInjectsTraceContext(t *testing.T) {
+	exp, flush := setupTracing(t)
+	w := &writerRec{}
+	svc := order.NewOrderService(&mockRepo{}, cache.NewCache(10), w, nil, nil)
+
+	if _, err := svc.CreateOrder(context.Background()); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	flush()
+
+	spans := exp.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "order.create" {
+		t.Fatalf("unexpected spans: %+v", spans)
+	}
+	ctx := tracing.ExtractMessage(context.Background(), kafkago.Message{Headers: w.headers})
+	got := trace.SpanContextFromContext(ctx)
+	if !got.IsValid() || got.TraceID() != spans[0].SpanContext.TraceID() {
+		t.Fatalf("expected trace %s in headers, got %v", spans[0].SpanContext.TraceID(), w.headers)
+	}
+}
+
+func TestHTTPSpanContinuesIncomingTrace(t *testing.T) {
+	exp, flush := setupTracing(t)
+	gin.SetMode(gin.TestMode)
+	ms := &mockService{order: order.Order{OrderUID: "order-t"}}
+	r := api.NewHandler(ms).RegisterOrderRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/order-t", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	flush()
+
+	spans := exp.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	s := spans[0]
+	if s.Name != "GET /orders/:id" {
+		t.Fatalf("unexpected span name %q", s.Name)
+	}
+	if s.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("trace not continued: %s", s.SpanContext.TraceID())
+	}
+	if s.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected parent %s", s.Parent.SpanID())
+	}
+}
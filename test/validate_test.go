@@ -0,0 +1,57 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"L0/internal/order"
+)
+
+func makeValidOrder(id string) order.Order {
+	return order.Order{
+		OrderUID:        id,
+		TrackNumber:     "WBILMTESTTRACK",
+		Entry:           "WBIL",
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		Delivery: order.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+		},
+		Payment: order.Payment{
+			Transaction: id,
+			Currency:    "USD",
+			Provider:    "wbpay",
+			Amount:      1817,
+		},
+		Products: []order.Product{{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: 453}},
+	}
+}
+
+func TestValidateAcceptsCompleteOrder(t *testing.T) {
+	if err := order.Validate(makeValidOrder("order-valid")); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	o := makeValidOrder("")
+	o.Payment.Amount = -1
+	o.Products[0].TrackNumber = "OTHER"
+
+	err := order.Validate(o)
+	if !errors.Is(err, order.ErrInvalidOrder) {
+		t.Fatalf("expected ErrInvalidOrder, got %v", err)
+	}
+	for _, want := range []string{"order_uid", "payment.amount", "items[0].track_number"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in error, got %v", want, err)
+		}
+	}
+}